@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type AttachCommandOpt struct {
+	refName      string
+	filePath     string
+	artifactType string
+	mediaType    string
+	platform     string
+	annotations  []string
+	username     string
+	password     string
+	plainHTTP    bool
+}
+
+var attachCommandOpt AttachCommandOpt
+
+// attachCmd represents the attach command
+var attachCmd = &cobra.Command{
+	Use:   "attach",
+	Short: "Attach a file to a package as a referrer artifact",
+	Long: `push a file (e.g. an SBOM, a provenance, a signature or docs) as an OCI 1.1 artifact
+referring to a package, to the manifest of --platform or to the whole index if --platform is blank.
+
+Registries without the referrers API get the sha256-<digest> tag schema instead.
+
+Example:
+  blob-uploader attach -r ghcr.io/example/hello:1.2.0 --platform linux/amd64 \
+    --artifact-type application/spdx+json --file ./sbom.spdx.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refName, r, err := parseRefName(attachCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		var platform *util.Platform
+		if attachCommandOpt.platform != "" {
+			platform = util.ParsePlatform(attachCommandOpt.platform)
+			if platform == nil {
+				return fmt.Errorf("%s is not allowed", attachCommandOpt.platform)
+			}
+		}
+		annotations := map[string]string{
+			oci.AnnotationCreated: time.Now().UTC().Format(time.RFC3339),
+		}
+		flagAnnotations, err := util.ParseKeyValues(attachCommandOpt.annotations)
+		if err != nil {
+			return fmt.Errorf("invalid annotation: %w", err)
+		}
+		maps.Copy(annotations, flagAnnotations)
+		reg := regctl.NewRegistry(r.Registry, attachCommandOpt.username, attachCommandOpt.password, regctlOptions(attachCommandOpt.plainHTTP)...)
+		digest, err := reg.Attach(context.Background(), refName, platform, attachCommandOpt.filePath, regctl.Attachment{
+			ArtifactType: attachCommandOpt.artifactType,
+			MediaType:    attachCommandOpt.mediaType,
+			Annotations:  annotations,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Successfully attach %s to %s: %s\n", attachCommandOpt.filePath, refName, digest)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+
+	attachCmd.Flags().StringVarP(&attachCommandOpt.refName, "ref-name", "r", "", "the package to attach to (e.g. ghcr.io/example/hello:1.2.0)")
+	attachCmd.Flags().StringVarP(&attachCommandOpt.filePath, "file", "", "", "the file to attach")
+	attachCmd.Flags().StringVarP(&attachCommandOpt.artifactType, "artifact-type", "", "", "the artifactType of the artifact (e.g. application/spdx+json)")
+	attachCmd.Flags().StringVarP(&attachCommandOpt.mediaType, "media-type", "", "application/octet-stream", "the media type of the file")
+	attachCmd.Flags().StringVarP(&attachCommandOpt.platform, "platform", "", "", "attach to the manifest of this platform (e.g. linux/amd64), blank for the whole index")
+	attachCmd.Flags().StringArrayVarP(&attachCommandOpt.annotations, "annotation", "a", nil, "add an annotation to the artifact in the form of key=value, can be repeated")
+	attachCmd.Flags().StringVarP(&attachCommandOpt.username, "username", "u", "", "the username of registry, not needed by a registry without authentication such as serve-registry")
+	attachCmd.Flags().StringVarP(&attachCommandOpt.password, "password", "p", "", "the password of registry")
+	attachCmd.Flags().BoolVarP(&attachCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+
+	requires := []string{
+		"ref-name",
+		"file",
+		"artifact-type",
+	}
+
+	for _, i := range requires {
+		attachCmd.MarkFlagRequired(i)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type DeleteCommandOpt struct {
+	refName      string
+	dryRun       bool
+	username     string
+	password     string
+	token        string
+	githubAPIURL string
+	plainHTTP    bool
+}
+
+var deleteCommandOpt DeleteCommandOpt
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:   "delete <ref>",
+	Short: "Delete a version of a package",
+	Long: `delete the version of a package which the tag or the digest of the ref points to.
+Every tag of the version is deleted with it.
+
+Packages on ghcr.io are deleted with the GitHub Packages API, authenticated with --token, $GITHUB_TOKEN
+or --password, other registries with the DELETE manifest endpoint.
+
+Example:
+  blob-uploader delete ghcr.io/example/hello:nightly-20240601 --token $GITHUB_TOKEN`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			deleteCommandOpt.refName = args[0]
+		}
+		if deleteCommandOpt.refName == "" {
+			return fmt.Errorf("a ref is required, e.g. blob-uploader delete ghcr.io/example/hello:1.2.0")
+		}
+		repo, refName, err := packageRepository(deleteCommandOpt.refName, deleteCommandOpt.username, deleteCommandOpt.password,
+			deleteCommandOpt.token, deleteCommandOpt.githubAPIURL, deleteCommandOpt.plainHTTP)
+		if err != nil {
+			return err
+		}
+		_, r, err := parseRefName(refName)
+		if err != nil {
+			return err
+		}
+		reference := r.Tag
+		if r.Digest != "" {
+			reference = r.Digest
+		}
+		ctx := context.Background()
+		v, err := repo.Version(ctx, reference)
+		if err != nil {
+			return err
+		}
+		if deleteCommandOpt.dryRun {
+			fmt.Printf("Would delete %s (%s)\n", v.Digest, strings.Join(v.Tags, ", "))
+			return nil
+		}
+		err = repo.Delete(ctx, v)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Successfully deleted %s (%s)\n", v.Digest, strings.Join(v.Tags, ", "))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.Flags().StringVarP(&deleteCommandOpt.refName, "ref-name", "r", "", "the version to delete (e.g. ghcr.io/example/hello:1.2.0), instead of the argument")
+	deleteCmd.Flags().BoolVarP(&deleteCommandOpt.dryRun, "dry-run", "", false, "print what would be deleted without deleting anything")
+	addPackageRepositoryFlags(deleteCmd, &deleteCommandOpt.username, &deleteCommandOpt.password, &deleteCommandOpt.token, &deleteCommandOpt.githubAPIURL, &deleteCommandOpt.plainHTTP)
+}
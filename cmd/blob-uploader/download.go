@@ -5,10 +5,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
 
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/trust"
 	"github.com/akkuman/blob-uploader/pkg/util"
 	"github.com/akkuman/blob-uploader/storage"
 	"github.com/regclient/regclient/types/ref"
@@ -19,6 +22,11 @@ type DownloadCommandOpt struct {
 	outFile string
 	refName string
 	platform string
+	metadataOut string
+	fileName string
+	plainHTTP bool
+	verifyKey string
+	trustPolicy string
 }
 
 var downloadCommandOpt DownloadCommandOpt
@@ -32,39 +40,142 @@ var downloadCmd = &cobra.Command{
 ref: https://github.com/orgs/Homebrew/discussions/4335
 	`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		downloadCommandOpt.refName = strings.ToLower(downloadCommandOpt.refName)
-		if !strings.HasPrefix(downloadCommandOpt.refName, "ghcr.io") {
-			return fmt.Errorf("ref-name must start with ghcr.io")
-		}
-		if _, err := ref.New(downloadCommandOpt.refName); err != nil {
+		refName, r, err := parseRefName(downloadCommandOpt.refName)
+		if err != nil {
 			return err
 		}
-		
+		downloadCommandOpt.refName = refName
+
 		platform := util.ParsePlatform(downloadCommandOpt.platform)
 		if platform == nil {
 			return fmt.Errorf("%s is not allowed", downloadCommandOpt.platform)
 		}
-		stge := storage.NewGithubPackageStorage(nil, nil)
+		reg := regctl.NewRegistry(r.Registry, "", "", regctlOptions(downloadCommandOpt.plainHTTP)...)
+		var stge storage.Storage = storage.NewGithubPackageStorage(nil, reg)
+		if storage.IsLayoutRef(downloadCommandOpt.refName) {
+			stge = storage.NewOCILayoutStorage(nil)
+		}
+		var downloadOpts []storage.DownloadOption
+		if downloadCommandOpt.fileName != "" {
+			downloadOpts = append(downloadOpts, storage.WithFileName(downloadCommandOpt.fileName))
+		}
+		if downloadCommandOpt.verifyKey != "" {
+			if storage.IsLayoutRef(downloadCommandOpt.refName) {
+				return fmt.Errorf("--verify-key is not supported for ocidir:// refs")
+			}
+			verifier, err := signatureVerifier(reg, downloadCommandOpt.verifyKey)
+			if err != nil {
+				return err
+			}
+			downloadOpts = append(downloadOpts, storage.WithVerifier(verifier))
+		}
+		if downloadCommandOpt.trustPolicy != "" {
+			if storage.IsLayoutRef(downloadCommandOpt.refName) {
+				return fmt.Errorf("--trust-policy is not supported for ocidir:// refs")
+			}
+			verifier, err := trustVerifier(reg, downloadCommandOpt.trustPolicy, *platform)
+			if err != nil {
+				return err
+			}
+			downloadOpts = append(downloadOpts, storage.WithVerifier(verifier))
+		}
+		var md storage.Metadata
+		if downloadCommandOpt.metadataOut != "" {
+			downloadOpts = append(downloadOpts, storage.WithMetadataOut(&md))
+		}
 		w, err := os.Create(downloadCommandOpt.outFile)
 		if err != nil {
 			return err
 		}
 		defer w.Close()
-		err = stge.Download(context.Background(), downloadCommandOpt.refName, *platform, w)
+		err = stge.Download(context.Background(), downloadCommandOpt.refName, *platform, w, downloadOpts...)
 		if err != nil {
+			// don't leave an unverified or partial file behind
+			w.Close()
+			os.Remove(downloadCommandOpt.outFile)
+			if errors.Is(err, storage.ErrNoArchive) {
+				return fmt.Errorf("%w, use --file to download one of its files", err)
+			}
 			return err
 		}
 		fmt.Println("Successfully download tgz from registry!")
+		if downloadCommandOpt.metadataOut != "" {
+			data, err := json.MarshalIndent(&md, "", "  ")
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(downloadCommandOpt.metadataOut, data, 0664)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Package metadata written to %s\n", downloadCommandOpt.metadataOut)
+		}
 		return nil
 	},
 }
 
+// trustVerifier returns a storage.Verifier refusing the packages which violate the trust policy at policyFile,
+// the referrers required by the policy are looked up on the index and on the manifest of platform
+func trustVerifier(reg *regctl.Registry, policyFile string, platform util.Platform) (storage.Verifier, error) {
+	policy, err := trust.Load(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, refName string, digest string) error {
+		r, err := ref.New(refName)
+		if err != nil {
+			return err
+		}
+		pkg := &trust.Package{
+			Repository: fmt.Sprintf("%s/%s", r.Registry, r.Repository),
+			Tag:        r.Tag,
+			Digest:     digest,
+		}
+		rule, err := policy.Rule(pkg.Repository)
+		if err != nil {
+			return err
+		}
+		// look the index up by digest so that it is the one which was verified
+		pinned := r.SetDigest(digest).CommonName()
+		_, manifests, err := reg.ResolveIndex(ctx, pinned)
+		if err != nil {
+			return err
+		}
+		for _, m := range manifests {
+			pkg.ManifestDigests = append(pkg.ManifestDigests, m.Digest)
+		}
+		if rule.Signed() {
+			pkg.Signatures, err = reg.Signatures(ctx, refName, digest)
+			if err != nil {
+				return err
+			}
+		}
+		if rule.NeedsReferrers() {
+			for _, p := range []*util.Platform{nil, &platform} {
+				referrers, err := reg.Referrers(ctx, pinned, p, "")
+				if err != nil {
+					return err
+				}
+				for _, x := range referrers {
+					pkg.ArtifactTypes = append(pkg.ArtifactTypes, x.ArtifactType)
+				}
+			}
+		}
+		return policy.Check(pkg)
+	}, nil
+}
+
 func init() {
 	rootCmd.AddCommand(downloadCmd)
 
 	downloadCmd.Flags().StringVarP(&downloadCommandOpt.outFile, "out-file", "o", "", "file path for tgz")
-	downloadCmd.Flags().StringVarP(&downloadCommandOpt.refName, "ref-name", "r", "", "the ref that you want download from (e.g.: ghcr.io/example/hello:1.2.0)")
+	downloadCmd.Flags().StringVarP(&downloadCommandOpt.refName, "ref-name", "r", "", "the ref that you want download from (e.g.: ghcr.io/example/hello:1.2.0 or ocidir:///srv/packages:hello:1.2.0)")
 	downloadCmd.Flags().StringVarP(&downloadCommandOpt.platform, "platform", "", "linux/amd64", "Specify platform (e.g. linux/amd64)")
+	downloadCmd.Flags().StringVarP(&downloadCommandOpt.fileName, "file", "", "", "download only the layer of this file name instead of the whole package")
+	downloadCmd.Flags().BoolVarP(&downloadCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+	downloadCmd.Flags().StringVarP(&downloadCommandOpt.verifyKey, "verify-key", "", "", "refuse the package unless it is signed by the private key of this PEM encoded public key")
+	downloadCmd.Flags().StringVarP(&downloadCommandOpt.trustPolicy, "trust-policy", "", "", "refuse the package unless it satisfies this trust policy file (YAML)")
+	downloadCmd.Flags().StringVarP(&downloadCommandOpt.metadataOut, "metadata-out", "", "", "write the package metadata as JSON to this file")
 
 	requires := []string{
 		"out-file",
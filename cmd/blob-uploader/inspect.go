@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/spf13/cobra"
+)
+
+type InspectCommandOpt struct {
+	refName   string
+	format    string
+	username  string
+	password  string
+	plainHTTP bool
+}
+
+var inspectCommandOpt InspectCommandOpt
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <ref>",
+	Short: "Show what was pushed for a package",
+	Long: `show the resolved digest of a package, every platform entry of its index with its size,
+layer media types, annotations and config, and the referrers attached to all of them.
+The ref is either the argument or --ref-name, it may be pinned to a digest.
+
+Example:
+  blob-uploader inspect ghcr.io/example/hello:1.2.0
+  blob-uploader inspect ghcr.io/example/hello:1.2.0 --format json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			inspectCommandOpt.refName = args[0]
+		}
+		if inspectCommandOpt.refName == "" {
+			return fmt.Errorf("a ref is required, e.g. blob-uploader inspect ghcr.io/example/hello:1.2.0")
+		}
+		if inspectCommandOpt.format != "table" && inspectCommandOpt.format != "json" {
+			return fmt.Errorf("unknown format %q, expected table or json", inspectCommandOpt.format)
+		}
+		if storage.IsLayoutRef(inspectCommandOpt.refName) {
+			return fmt.Errorf("inspect is not supported for ocidir:// refs")
+		}
+		refName, r, err := parseRefName(inspectCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		reg := regctl.NewRegistry(r.Registry, inspectCommandOpt.username, inspectCommandOpt.password, regctlOptions(inspectCommandOpt.plainHTTP)...)
+		ins, err := reg.Inspect(context.Background(), refName)
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", refName, err)
+		}
+		if inspectCommandOpt.format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(ins)
+		}
+		return printInspection(os.Stdout, ins)
+	},
+}
+
+// printInspection writes ins as human readable tables
+func printInspection(w io.Writer, ins *regctl.Inspection) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Ref:\t%s\n", ins.Ref)
+	fmt.Fprintf(tw, "Digest:\t%s\n", ins.Digest)
+	fmt.Fprintf(tw, "Media type:\t%s\n", ins.MediaType)
+	if ins.ArtifactType != "" {
+		fmt.Fprintf(tw, "Artifact type:\t%s\n", ins.ArtifactType)
+	}
+	printAnnotations(tw, "", ins.Annotations)
+	printReferrers(tw, "", ins.Referrers)
+	for _, m := range ins.Manifests {
+		fmt.Fprintln(tw)
+		if m.Platform != "" {
+			fmt.Fprintf(tw, "Platform %s\n", m.Platform)
+		} else {
+			fmt.Fprintf(tw, "Manifest %s\n", m.Digest)
+		}
+		fmt.Fprintf(tw, "  Digest:\t%s\n", m.Digest)
+		fmt.Fprintf(tw, "  Media type:\t%s\n", m.MediaType)
+		if m.ArtifactType != "" {
+			fmt.Fprintf(tw, "  Artifact type:\t%s\n", m.ArtifactType)
+		}
+		fmt.Fprintf(tw, "  Size:\t%d\n", m.Size)
+		fmt.Fprintf(tw, "  Config:\t%s %s (%d bytes)\n", m.Config.MediaType, m.Config.Digest, m.Config.Size)
+		if len(m.Config.Content) > 0 {
+			fmt.Fprintf(tw, "  \t%s\n", m.Config.Content)
+		}
+		fmt.Fprintln(tw, "  Layers:")
+		fmt.Fprintln(tw, "    MEDIA TYPE\tDIGEST\tSIZE\tTITLE")
+		for _, l := range m.Layers {
+			fmt.Fprintf(tw, "    %s\t%s\t%d\t%s\n", l.MediaType, l.Digest, l.Size, l.Title)
+		}
+		printAnnotations(tw, "  ", m.Annotations)
+		printReferrers(tw, "  ", m.Referrers)
+	}
+	return tw.Flush()
+}
+
+func printAnnotations(tw *tabwriter.Writer, indent string, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(tw, "%sAnnotations:\n", indent)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s  %s\t%s\n", indent, k, annotations[k])
+	}
+}
+
+func printReferrers(tw *tabwriter.Writer, indent string, referrers []regctl.Referrer) {
+	if len(referrers) == 0 {
+		return
+	}
+	fmt.Fprintf(tw, "%sReferrers:\n", indent)
+	fmt.Fprintf(tw, "%s  DIGEST\tARTIFACT TYPE\tSIZE\tCREATED\n", indent)
+	for _, x := range referrers {
+		fmt.Fprintf(tw, "%s  %s\t%s\t%d\t%s\n", indent, x.Digest, x.ArtifactType, x.Size, x.Annotations[oci.AnnotationCreated])
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().StringVarP(&inspectCommandOpt.refName, "ref-name", "r", "", "the package to inspect (e.g. ghcr.io/example/hello:1.2.0), instead of the argument")
+	inspectCmd.Flags().StringVarP(&inspectCommandOpt.format, "format", "", "table", "output format, table or json")
+	inspectCmd.Flags().StringVarP(&inspectCommandOpt.username, "username", "u", "", "the username of registry, only for private packages")
+	inspectCmd.Flags().StringVarP(&inspectCommandOpt.password, "password", "p", "", "the password of registry")
+	inspectCmd.Flags().BoolVarP(&inspectCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+}
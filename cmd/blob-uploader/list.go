@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/ghpackages"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/spf13/cobra"
+)
+
+type ListCommandOpt struct {
+	refName      string
+	deleted      bool
+	format       string
+	username     string
+	password     string
+	token        string
+	githubAPIURL string
+	plainHTTP    bool
+}
+
+var listCommandOpt ListCommandOpt
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list <ref>",
+	Short: "List the versions of a package",
+	Long: `list the versions of a package, newest first, with their id, tags, digest and creation time.
+
+Packages on ghcr.io are listed with the GitHub Packages API, authenticated with --token, $GITHUB_TOKEN
+or --password, along with their visibility and the repository they are linked to. --deleted lists the
+deleted versions which can still be restored with the restore command.
+Other registries list the tagged manifests with the distribution API.
+
+Example:
+  blob-uploader list ghcr.io/example/hello
+  blob-uploader list ghcr.io/example/hello --deleted --format json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			listCommandOpt.refName = args[0]
+		}
+		if listCommandOpt.refName == "" {
+			return fmt.Errorf("a ref is required, e.g. blob-uploader list ghcr.io/example/hello")
+		}
+		if listCommandOpt.format != "table" && listCommandOpt.format != "json" {
+			return fmt.Errorf("unknown format %q, expected table or json", listCommandOpt.format)
+		}
+		if storage.IsLayoutRef(listCommandOpt.refName) {
+			return fmt.Errorf("list is not supported for ocidir:// refs")
+		}
+		refName, r, err := parseRefName(listCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+		l := &listing{Ref: r.SetTag("").CommonName()}
+		if r.Registry == "ghcr.io" {
+			err = listGitHubPackage(ctx, l, r.Repository)
+		} else {
+			err = listRegistry(ctx, l, refName)
+		}
+		if err != nil {
+			return err
+		}
+		if listCommandOpt.format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(l)
+		}
+		return printListing(os.Stdout, l)
+	},
+}
+
+// listing is the output of the list command
+type listing struct {
+	Ref string `json:"ref"`
+	// Package is the package on GitHub Packages, nil for other registries
+	Package  *ghpackages.Package `json:"package,omitempty"`
+	Versions []listedVersion     `json:"versions"`
+}
+
+type listedVersion struct {
+	// ID is the id of the version on GitHub Packages, zero for other registries
+	ID      int64     `json:"id,omitempty"`
+	Digest  string    `json:"digest"`
+	Tags    []string  `json:"tags"`
+	Created time.Time `json:"created"`
+}
+
+func listGitHubPackage(ctx context.Context, l *listing, repository string) error {
+	client, err := githubPackagesClient(listCommandOpt.password, listCommandOpt.token, listCommandOpt.githubAPIURL)
+	if err != nil {
+		return err
+	}
+	owner, name, err := ghpackages.SplitRepository(repository)
+	if err != nil {
+		return err
+	}
+	l.Package, err = client.Package(ctx, owner, name)
+	if err != nil {
+		return err
+	}
+	list := client.Versions
+	if listCommandOpt.deleted {
+		list = client.DeletedVersions
+	}
+	versions, err := list(ctx, owner, name)
+	if err != nil {
+		return err
+	}
+	l.Versions = make([]listedVersion, 0, len(versions))
+	for _, v := range versions {
+		l.Versions = append(l.Versions, listedVersion{ID: v.ID, Digest: v.Name, Tags: v.Tags(), Created: v.CreatedAt})
+	}
+	return nil
+}
+
+func listRegistry(ctx context.Context, l *listing, refName string) error {
+	if listCommandOpt.deleted {
+		return fmt.Errorf("--deleted is only supported for ghcr.io, other registries don't keep the deleted versions")
+	}
+	repo, _, err := packageRepository(refName, listCommandOpt.username, listCommandOpt.password,
+		listCommandOpt.token, listCommandOpt.githubAPIURL, listCommandOpt.plainHTTP)
+	if err != nil {
+		return err
+	}
+	versions, err := repo.Versions(ctx)
+	if err != nil {
+		return err
+	}
+	l.Versions = make([]listedVersion, 0, len(versions))
+	for _, v := range versions {
+		l.Versions = append(l.Versions, listedVersion{Digest: v.Digest, Tags: v.Tags, Created: v.Created})
+	}
+	return nil
+}
+
+// printListing writes l as a human readable table
+func printListing(w io.Writer, l *listing) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Ref:\t%s\n", l.Ref)
+	if l.Package != nil {
+		fmt.Fprintf(tw, "Visibility:\t%s\n", l.Package.Visibility)
+		repository := "-"
+		if l.Package.Repository != nil {
+			repository = l.Package.Repository.FullName
+		}
+		fmt.Fprintf(tw, "Repository:\t%s\n", repository)
+		fmt.Fprintf(tw, "URL:\t%s\n", l.Package.HTMLURL)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "ID\tTAGS\tDIGEST\tCREATED")
+	for _, v := range l.Versions {
+		id := "-"
+		if v.ID != 0 {
+			id = strconv.FormatInt(v.ID, 10)
+		}
+		tags := "-"
+		if len(v.Tags) > 0 {
+			tags = strings.Join(v.Tags, ",")
+		}
+		created := "-"
+		if !v.Created.IsZero() {
+			created = v.Created.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", id, tags, v.Digest, created)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringVarP(&listCommandOpt.refName, "ref-name", "r", "", "the package to list (e.g. ghcr.io/example/hello), instead of the argument, the tag is ignored")
+	listCmd.Flags().BoolVarP(&listCommandOpt.deleted, "deleted", "", false, "list the deleted versions which can be restored, ghcr.io only")
+	listCmd.Flags().StringVarP(&listCommandOpt.format, "format", "", "table", "output format, table or json")
+	addPackageRepositoryFlags(listCmd, &listCommandOpt.username, &listCommandOpt.password, &listCommandOpt.token, &listCommandOpt.githubAPIURL, &listCommandOpt.plainHTTP)
+}
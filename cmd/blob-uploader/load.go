@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/compress"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+type LoadCommandOpt struct {
+	target   string
+	username string
+	password string
+	plainHTTP bool
+}
+
+var loadCommandOpt LoadCommandOpt
+
+// loadCmd represents the load command
+var loadCmd = &cobra.Command{
+	Use:   "load <layout-dir|archive.tar>",
+	Short: "Push packages saved by save to another registry",
+	Long: `push every package of an OCI layout directory or an oci-archive tar created by save to another registry.
+
+The registry host of each saved ref is replaced by --target,
+e.g. ghcr.io/example/hello:1.2.0 is pushed to registry.local/mirror/example/hello:1.2.0 with --target registry.local/mirror`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		loadCommandOpt.target = strings.ToLower(strings.TrimSuffix(loadCommandOpt.target, "/"))
+		r, err := ref.NewHost(loadCommandOpt.target)
+		if err != nil {
+			return err
+		}
+		layoutDir := args[0]
+		fi, err := os.Stat(layoutDir)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			tmpDir, err := os.MkdirTemp("", "oci-archive")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(tmpDir)
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			err = compress.Untar(f, tmpDir)
+			if err != nil {
+				return fmt.Errorf("extract %s failed: %w", args[0], err)
+			}
+			layoutDir = tmpDir
+		}
+		reg := regctl.NewRegistry(r.Registry, loadCommandOpt.username, loadCommandOpt.password, regctlOptions(loadCommandOpt.plainHTTP)...)
+		err = reg.Login()
+		if err != nil {
+			return fmt.Errorf("connect registry error: %v", err)
+		}
+		pushed, err := reg.LoadLayout(context.Background(), layoutDir, loadCommandOpt.target)
+		for _, refName := range pushed {
+			fmt.Printf("Loaded %s\n", refName)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Successfully load %d package(s) to %s\n", len(pushed), loadCommandOpt.target)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loadCmd)
+
+	loadCmd.Flags().StringVarP(&loadCommandOpt.target, "target", "t", "", "the registry host and optional path prefix to push to (e.g. registry.local/mirror)")
+	loadCmd.Flags().StringVarP(&loadCommandOpt.username, "username", "u", "", "the username of registry")
+	loadCmd.Flags().StringVarP(&loadCommandOpt.password, "password", "p", "", "the password of registry")
+
+	loadCmd.Flags().BoolVarP(&loadCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+
+	loadCmd.MarkFlagRequired("target")
+}
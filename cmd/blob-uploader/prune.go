@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/ghpackages"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/retention"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/spf13/cobra"
+)
+
+type PruneCommandOpt struct {
+	refName      string
+	keepLast     int
+	keepWithin   string
+	keepReleases bool
+	match        string
+	dryRun       bool
+	username     string
+	password     string
+	token        string
+	githubAPIURL string
+	plainHTTP    bool
+}
+
+var pruneCommandOpt PruneCommandOpt
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete the versions of a package which no retention rule keeps",
+	Long: `delete the tagged versions of a package which none of the retention rules keeps:
+--keep-last N keeps the N most recent matching versions, --keep-within keeps the versions created
+less than this duration ago (e.g. 72h, 30d or 2w), --keep-releases keeps the semver releases (e.g. 1.2.0)
+and --match restricts the deletion to the versions having a tag matching this regex.
+Untagged versions are never deleted, they may be the platform manifests or the referrers of another version.
+
+Packages on ghcr.io are deleted with the GitHub Packages API, authenticated with --token, $GITHUB_TOKEN
+or --password, other registries with the DELETE manifest endpoint. Use --dry-run to review the plan first.
+
+Example:
+  blob-uploader prune -r ghcr.io/example/hello --match '^nightly-' --keep-last 10 --keep-within 30d --dry-run`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy := &retention.Policy{
+			KeepLast:     pruneCommandOpt.keepLast,
+			KeepReleases: pruneCommandOpt.keepReleases,
+		}
+		var err error
+		if pruneCommandOpt.keepWithin != "" {
+			policy.KeepWithin, err = retention.ParseDuration(pruneCommandOpt.keepWithin)
+			if err != nil {
+				return err
+			}
+		}
+		if pruneCommandOpt.match != "" {
+			policy.Match, err = regexp.Compile(pruneCommandOpt.match)
+			if err != nil {
+				return fmt.Errorf("--match: %w", err)
+			}
+		}
+		if policy.Empty() {
+			return fmt.Errorf("no retention rule is given, refusing to delete every version")
+		}
+		repo, refName, err := packageRepository(pruneCommandOpt.refName, pruneCommandOpt.username, pruneCommandOpt.password,
+			pruneCommandOpt.token, pruneCommandOpt.githubAPIURL, pruneCommandOpt.plainHTTP)
+		if err != nil {
+			return err
+		}
+		decisions, pruneErr := retention.Prune(context.Background(), repo, policy, time.Now(), pruneCommandOpt.dryRun)
+		action := "DELETE"
+		if pruneCommandOpt.dryRun {
+			action = "WOULD DELETE"
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACTION\tTAGS\tDIGEST\tCREATED\tREASON")
+		count := 0
+		for _, d := range decisions {
+			a := "KEEP"
+			if d.Delete {
+				a = action
+				count++
+			}
+			created := "-"
+			if !d.Created.IsZero() {
+				created = d.Created.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", a, strings.Join(d.Tags, ","), d.Digest, created, d.Reason)
+		}
+		tw.Flush()
+		if pruneErr != nil {
+			return pruneErr
+		}
+		if pruneCommandOpt.dryRun {
+			fmt.Printf("%d of %d versions of %s would be deleted\n", count, len(decisions), refName)
+		} else {
+			fmt.Printf("Successfully deleted %d of %d versions of %s\n", count, len(decisions), refName)
+		}
+		return nil
+	},
+}
+
+// packageRepository returns the retention.Repository of the package of refName, the GitHub Packages API
+// for ghcr.io and the distribution API for other registries, and the normalized refName
+func packageRepository(refName string, username string, password string, token string, githubAPIURL string, plainHTTP bool) (retention.Repository, string, error) {
+	if storage.IsLayoutRef(refName) {
+		return nil, "", fmt.Errorf("ocidir:// refs are not supported, delete the directory instead")
+	}
+	refName, r, err := parseRefName(refName)
+	if err != nil {
+		return nil, "", err
+	}
+	if r.Registry == "ghcr.io" {
+		client, err := githubPackagesClient(password, token, githubAPIURL)
+		if err != nil {
+			return nil, "", err
+		}
+		repo, err := retention.NewGitHubPackages(client, r.Repository)
+		return repo, refName, err
+	}
+	reg := regctl.NewRegistry(r.Registry, username, password, regctlOptions(plainHTTP)...)
+	repo, err := retention.NewRegistry(reg, refName)
+	return repo, refName, err
+}
+
+// githubPackagesClient returns the client of the GitHub Packages API, authenticated with token, $GITHUB_TOKEN or password
+func githubPackagesClient(password string, token string, githubAPIURL string) (*ghpackages.Client, error) {
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+	if token == "" {
+		token = password
+	}
+	if token == "" {
+		return nil, fmt.Errorf("a GitHub token is required for ghcr.io, give --token, $GITHUB_TOKEN or --password")
+	}
+	return ghpackages.New(token, ghpackages.WithBaseURL(githubAPIURL)), nil
+}
+
+// addPackageRepositoryFlags registers the flags of packageRepository
+func addPackageRepositoryFlags(cmd *cobra.Command, username *string, password *string, token *string, githubAPIURL *string, plainHTTP *bool) {
+	cmd.Flags().StringVarP(username, "username", "u", "", "the username of registry")
+	cmd.Flags().StringVarP(password, "password", "p", "", "the password of registry, also the GitHub token for ghcr.io when --token and $GITHUB_TOKEN are blank")
+	cmd.Flags().StringVarP(token, "token", "", "", "the GitHub token of the GitHub Packages API for ghcr.io, default to $GITHUB_TOKEN")
+	cmd.Flags().StringVarP(githubAPIURL, "github-api-url", "", ghpackages.DefaultBaseURL, "the URL of the GitHub REST API, e.g. of a GitHub Enterprise Server")
+	cmd.Flags().BoolVarP(plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().StringVarP(&pruneCommandOpt.refName, "ref-name", "r", "", "the package to prune (e.g. ghcr.io/example/hello), the tag is ignored")
+	pruneCmd.Flags().IntVarP(&pruneCommandOpt.keepLast, "keep-last", "", 0, "keep the N most recent matching versions")
+	pruneCmd.Flags().StringVarP(&pruneCommandOpt.keepWithin, "keep-within", "", "", "keep the versions created less than this duration ago (e.g. 72h, 30d or 2w), and those of unknown age")
+	pruneCmd.Flags().BoolVarP(&pruneCommandOpt.keepReleases, "keep-releases", "", false, "keep the versions having a semver release tag (e.g. 1.2.0 or v1.2.0)")
+	pruneCmd.Flags().StringVarP(&pruneCommandOpt.match, "match", "", "", "delete only the versions having a tag matching this regex (e.g. '^nightly-')")
+	pruneCmd.Flags().BoolVarP(&pruneCommandOpt.dryRun, "dry-run", "", false, "print what would be deleted without deleting anything")
+	addPackageRepositoryFlags(pruneCmd, &pruneCommandOpt.username, &pruneCommandOpt.password, &pruneCommandOpt.token, &pruneCommandOpt.githubAPIURL, &pruneCommandOpt.plainHTTP)
+
+	requires := []string{
+		"ref-name",
+	}
+
+	for _, i := range requires {
+		pruneCmd.MarkFlagRequired(i)
+	}
+}
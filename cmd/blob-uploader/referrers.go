@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type ReferrersCommandOpt struct {
+	refName      string
+	platform     string
+	artifactType string
+	download     string
+	outFile      string
+	jsonOutput   bool
+	username     string
+	password     string
+	plainHTTP    bool
+}
+
+var referrersCommandOpt ReferrersCommandOpt
+
+// referrersCmd represents the referrers command
+var referrersCmd = &cobra.Command{
+	Use:   "referrers",
+	Short: "List or download the artifacts attached to a package",
+	Long: `list the referrer artifacts of a package, of the manifest of --platform or of the whole index
+if --platform is blank. Give --download <digest> and --out-file to download the file of one of them.
+
+Example:
+  blob-uploader referrers -r ghcr.io/example/hello:1.2.0 --platform linux/amd64
+  blob-uploader referrers -r ghcr.io/example/hello:1.2.0 --download sha256:... -o sbom.spdx.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refName, r, err := parseRefName(referrersCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		reg := regctl.NewRegistry(r.Registry, referrersCommandOpt.username, referrersCommandOpt.password, regctlOptions(referrersCommandOpt.plainHTTP)...)
+		if referrersCommandOpt.download != "" {
+			if referrersCommandOpt.outFile == "" {
+				return fmt.Errorf("--out-file is required with --download")
+			}
+			w, err := os.Create(referrersCommandOpt.outFile)
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			name, err := reg.DownloadReferrer(context.Background(), refName, referrersCommandOpt.download, w)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Successfully download %s to %s\n", name, referrersCommandOpt.outFile)
+			return nil
+		}
+		var platform *util.Platform
+		if referrersCommandOpt.platform != "" {
+			platform = util.ParsePlatform(referrersCommandOpt.platform)
+			if platform == nil {
+				return fmt.Errorf("%s is not allowed", referrersCommandOpt.platform)
+			}
+		}
+		referrers, err := reg.Referrers(context.Background(), refName, platform, referrersCommandOpt.artifactType)
+		if err != nil {
+			return err
+		}
+		if referrersCommandOpt.jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(referrers)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "DIGEST\tARTIFACT TYPE\tSIZE\tCREATED")
+		for _, x := range referrers {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", x.Digest, x.ArtifactType, x.Size, x.Annotations[oci.AnnotationCreated])
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(referrersCmd)
+
+	referrersCmd.Flags().StringVarP(&referrersCommandOpt.refName, "ref-name", "r", "", "the package (e.g. ghcr.io/example/hello:1.2.0)")
+	referrersCmd.Flags().StringVarP(&referrersCommandOpt.platform, "platform", "", "", "list the referrers of the manifest of this platform (e.g. linux/amd64), blank for the whole index")
+	referrersCmd.Flags().StringVarP(&referrersCommandOpt.artifactType, "artifact-type", "", "", "list only the referrers of this artifactType")
+	referrersCmd.Flags().StringVarP(&referrersCommandOpt.download, "download", "", "", "download the file of the referrer with this digest")
+	referrersCmd.Flags().StringVarP(&referrersCommandOpt.outFile, "out-file", "o", "", "file path for --download")
+	referrersCmd.Flags().BoolVarP(&referrersCommandOpt.jsonOutput, "json", "", false, "print the referrers as JSON")
+	referrersCmd.Flags().StringVarP(&referrersCommandOpt.username, "username", "u", "", "the username of registry, only for private packages")
+	referrersCmd.Flags().StringVarP(&referrersCommandOpt.password, "password", "p", "", "the password of registry")
+	referrersCmd.Flags().BoolVarP(&referrersCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+
+	requires := []string{
+		"ref-name",
+	}
+
+	for _, i := range requires {
+		referrersCmd.MarkFlagRequired(i)
+	}
+}
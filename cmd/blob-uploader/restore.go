@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/ghpackages"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/spf13/cobra"
+)
+
+type RestoreCommandOpt struct {
+	refName      string
+	id           int64
+	password     string
+	token        string
+	githubAPIURL string
+}
+
+var restoreCommandOpt RestoreCommandOpt
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <ref>",
+	Short: "Restore a deleted version of a package on ghcr.io",
+	Long: `restore the deleted version of a package on ghcr.io which had the tag or the digest of the ref,
+or the version --id as printed by list --deleted. GitHub keeps the deleted versions for 30 days.
+
+The version is restored with the GitHub Packages API, authenticated with --token, $GITHUB_TOKEN or --password,
+other registries don't keep the deleted versions.
+
+Example:
+  blob-uploader restore ghcr.io/example/hello:1.2.0 --token $GITHUB_TOKEN
+  blob-uploader restore ghcr.io/example/hello --id 123456`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			restoreCommandOpt.refName = args[0]
+		}
+		if restoreCommandOpt.refName == "" {
+			return fmt.Errorf("a ref is required, e.g. blob-uploader restore ghcr.io/example/hello:1.2.0")
+		}
+		if storage.IsLayoutRef(restoreCommandOpt.refName) {
+			return fmt.Errorf("restore is not supported for ocidir:// refs")
+		}
+		_, r, err := parseRefName(restoreCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		if r.Registry != "ghcr.io" {
+			return fmt.Errorf("restore is only supported for ghcr.io, %s doesn't keep the deleted versions", r.Registry)
+		}
+		owner, name, err := ghpackages.SplitRepository(r.Repository)
+		if err != nil {
+			return err
+		}
+		client, err := githubPackagesClient(restoreCommandOpt.password, restoreCommandOpt.token, restoreCommandOpt.githubAPIURL)
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+		versions, err := client.DeletedVersions(ctx, owner, name)
+		if err != nil {
+			return err
+		}
+		reference := r.Tag
+		if r.Digest != "" {
+			reference = r.Digest
+		}
+		if restoreCommandOpt.id != 0 {
+			reference = fmt.Sprint(restoreCommandOpt.id)
+		}
+		var found *ghpackages.Version
+		// the most recently deleted version wins when a tag was deleted several times
+		for i, v := range versions {
+			if v.ID == restoreCommandOpt.id || (restoreCommandOpt.id == 0 && (v.Name == reference || slices.Contains(v.Tags(), reference))) {
+				found = &versions[i]
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf("no deleted version of %s/%s matches %s", owner, name, reference)
+		}
+		err = client.RestoreVersion(ctx, owner, name, found.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Successfully restored %s (%s)\n", found.Name, strings.Join(found.Tags(), ", "))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringVarP(&restoreCommandOpt.refName, "ref-name", "r", "", "the version to restore (e.g. ghcr.io/example/hello:1.2.0), instead of the argument")
+	restoreCmd.Flags().Int64VarP(&restoreCommandOpt.id, "id", "", 0, "the id of the version to restore, as printed by list --deleted, instead of the tag or the digest of the ref")
+	restoreCmd.Flags().StringVarP(&restoreCommandOpt.password, "password", "p", "", "the GitHub token when --token and $GITHUB_TOKEN are blank")
+	restoreCmd.Flags().StringVarP(&restoreCommandOpt.token, "token", "", "", "the GitHub token of the GitHub Packages API, default to $GITHUB_TOKEN")
+	restoreCmd.Flags().StringVarP(&restoreCommandOpt.githubAPIURL, "github-api-url", "", ghpackages.DefaultBaseURL, "the URL of the GitHub REST API, e.g. of a GitHub Enterprise Server")
+}
@@ -8,6 +8,9 @@ import (
 	"os"
 	"strings"
 
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/regclient/regclient/types/ref"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -77,3 +80,23 @@ func bindFlags(cmd *cobra.Command, v *viper.Viper) {
 		}
 	})
 }
+
+// parseRefName parses the ref of a package, either a registry ref which is lower-cased,
+// or a local OCI layout ref such as ocidir:///srv/packages:wget:1.2
+func parseRefName(refName string) (string, ref.Ref, error) {
+	if storage.IsLayoutRef(refName) {
+		r, err := storage.ParseLayoutRef(refName)
+		return refName, r, err
+	}
+	refName = strings.ToLower(refName)
+	r, err := ref.New(refName)
+	return refName, r, err
+}
+
+// regctlOptions returns the options of the registry clients
+func regctlOptions(plainHTTP bool) []regctl.Option {
+	if plainHTTP {
+		return []regctl.Option{regctl.WithPlainHTTP()}
+	}
+	return nil
+}
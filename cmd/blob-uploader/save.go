@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/compress"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+type SaveCommandOpt struct {
+	output   string
+	username string
+	password string
+	plainHTTP bool
+}
+
+var saveCommandOpt SaveCommandOpt
+
+// saveCmd represents the save command
+var saveCmd = &cobra.Command{
+	Use:   "save <ref>...",
+	Short: "Save packages to an OCI layout or an oci-archive tar",
+	Long: `save one or more packages, with all platforms and referrers, to a local OCI layout directory,
+or to a single oci-archive tar when the output ends with .tar.
+
+The result can be carried to an air-gapped network and pushed to another registry with load.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var refNames []string
+		for _, arg := range args {
+			refName := strings.ToLower(arg)
+			if _, err := ref.New(refName); err != nil {
+				return err
+			}
+			refNames = append(refNames, refName)
+		}
+		r, _ := ref.New(refNames[0])
+		reg := regctl.NewRegistry(r.Registry, saveCommandOpt.username, saveCommandOpt.password, regctlOptions(saveCommandOpt.plainHTTP)...)
+		layoutDir := saveCommandOpt.output
+		isArchive := strings.HasSuffix(saveCommandOpt.output, ".tar")
+		if isArchive {
+			tmpDir, err := os.MkdirTemp("", "oci-archive")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(tmpDir)
+			layoutDir = tmpDir
+		}
+		err := reg.SaveLayout(context.Background(), layoutDir, refNames...)
+		if err != nil {
+			return err
+		}
+		if isArchive {
+			f, err := os.Create(saveCommandOpt.output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			err = compress.TarDir(layoutDir, f)
+			if err != nil {
+				return err
+			}
+		}
+		for _, refName := range refNames {
+			fmt.Printf("Saved %s\n", refName)
+		}
+		fmt.Printf("Successfully save to %s\n", saveCommandOpt.output)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(saveCmd)
+
+	saveCmd.Flags().StringVarP(&saveCommandOpt.output, "output", "o", "", "OCI layout directory, or oci-archive file if it ends with .tar")
+	saveCmd.Flags().StringVarP(&saveCommandOpt.username, "username", "u", "", "the username of registry, blank for anonymous pull")
+	saveCmd.Flags().StringVarP(&saveCommandOpt.password, "password", "p", "", "the password of registry")
+
+	saveCmd.Flags().BoolVarP(&saveCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+
+	saveCmd.MarkFlagRequired("output")
+}
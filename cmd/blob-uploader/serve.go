@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/proxy"
+	"github.com/spf13/cobra"
+)
+
+type ServeCommandOpt struct {
+	addr       string
+	upstream   string
+	cacheDir   string
+	plainHTTP  bool
+	resolveTTL time.Duration
+}
+
+var serveCommandOpt ServeCommandOpt
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the packages of a registry on plain download URLs",
+	Long: `serve the packages of the upstream registry on URLs like /<repository>/<tag>/<os>/<arch>,
+where tag may be latest, so that they can be fetched with curl or wget.
+
+The blob is fetched from the upstream on the first request, verified against its digest and
+cached in --cache-dir, later requests are served from the cache. The resolution of a tag is
+reused for --resolve-ttl, and up to a day longer when the upstream is unavailable.
+
+Example:
+  blob-uploader serve --upstream ghcr.io/pkgforge --cache-dir /var/cache/blob-uploader
+  curl -O http://127.0.0.1:8080/wget/latest/linux/amd64`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := proxy.New(serveCommandOpt.upstream, serveCommandOpt.cacheDir,
+			proxy.WithResolveTTL(serveCommandOpt.resolveTTL),
+			proxy.WithRegistryOptions(regctlOptions(serveCommandOpt.plainHTTP)...))
+		if err != nil {
+			return err
+		}
+		srv := &http.Server{
+			Addr:              serveCommandOpt.addr,
+			Handler:           logRequests(p),
+			ReadHeaderTimeout: 30 * time.Second,
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+		log.Printf("Serving %s on %s", serveCommandOpt.upstream, serveCommandOpt.addr)
+		err = srv.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVarP(&serveCommandOpt.addr, "addr", "", ":8080", "the address to listen on")
+	serveCmd.Flags().StringVarP(&serveCommandOpt.upstream, "upstream", "", "ghcr.io", "the upstream registry, with an optional repository prefix, e.g. ghcr.io/pkgforge")
+	serveCmd.Flags().StringVarP(&serveCommandOpt.cacheDir, "cache-dir", "", "", "the directory caching the blobs")
+	serveCmd.Flags().BoolVarP(&serveCommandOpt.plainHTTP, "plain-http", "", false, "use plain HTTP to connect to the upstream registry")
+	serveCmd.Flags().DurationVarP(&serveCommandOpt.resolveTTL, "resolve-ttl", "", 5*time.Minute, "how long the resolution of a tag is reused")
+
+	requires := []string{
+		"cache-dir",
+	}
+
+	for _, i := range requires {
+		serveCmd.MarkFlagRequired(i)
+	}
+}
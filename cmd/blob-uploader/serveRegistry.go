@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+type ServeRegistryCommandOpt struct {
+	addr     string
+	rootDir  string
+	username string
+	password string
+	tlsCert  string
+	tlsKey   string
+}
+
+var serveRegistryCommandOpt ServeRegistryCommandOpt
+
+// serveRegistryCmd represents the serve-registry command
+var serveRegistryCmd = &cobra.Command{
+	Use:   "serve-registry",
+	Short: "Run an OCI registry backed by a local directory",
+	Long: `run a minimal OCI distribution registry for air-gapped sites and CI caches.
+
+Every repository is stored as an OCI layout in <root>/<repository>, so that a package pushed to
+the registry can also be read with ocidir://<root>:<repository>. Pulls are anonymous, pushes and
+deletes require basic auth when --username and --password are given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (serveRegistryCommandOpt.username == "") != (serveRegistryCommandOpt.password == "") {
+			return fmt.Errorf("--username and --password must be given together")
+		}
+		if (serveRegistryCommandOpt.tlsCert == "") != (serveRegistryCommandOpt.tlsKey == "") {
+			return fmt.Errorf("--tls-cert and --tls-key must be given together")
+		}
+		store, err := registry.NewDirStore(serveRegistryCommandOpt.rootDir)
+		if err != nil {
+			return err
+		}
+		opts := []registry.Option{registry.WithStore(store)}
+		if serveRegistryCommandOpt.username != "" {
+			opts = append(opts, registry.WithBasicAuth(serveRegistryCommandOpt.username, serveRegistryCommandOpt.password))
+		}
+		srv := &http.Server{
+			Addr:              serveRegistryCommandOpt.addr,
+			Handler:           logRequests(registry.New(opts...)),
+			ReadHeaderTimeout: 30 * time.Second,
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+		log.Printf("Serving registry of %s on %s", serveRegistryCommandOpt.rootDir, serveRegistryCommandOpt.addr)
+		if serveRegistryCommandOpt.tlsCert != "" {
+			err = srv.ListenAndServeTLS(serveRegistryCommandOpt.tlsCert, serveRegistryCommandOpt.tlsKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	},
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs the method, path, status and duration of every request
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(serveRegistryCmd)
+
+	serveRegistryCmd.Flags().StringVarP(&serveRegistryCommandOpt.addr, "addr", "", ":5000", "the address to listen on")
+	serveRegistryCmd.Flags().StringVarP(&serveRegistryCommandOpt.rootDir, "root", "", "", "the directory storing the repositories as OCI layouts")
+	serveRegistryCmd.Flags().StringVarP(&serveRegistryCommandOpt.username, "username", "u", "", "the username required to push, blank for no auth")
+	serveRegistryCmd.Flags().StringVarP(&serveRegistryCommandOpt.password, "password", "p", "", "the password required to push")
+	serveRegistryCmd.Flags().StringVarP(&serveRegistryCommandOpt.tlsCert, "tls-cert", "", "", "TLS certificate file, serve plain HTTP if blank")
+	serveRegistryCmd.Flags().StringVarP(&serveRegistryCommandOpt.tlsKey, "tls-key", "", "", "TLS key file")
+
+	requires := []string{
+		"root",
+	}
+
+	for _, i := range requires {
+		serveRegistryCmd.MarkFlagRequired(i)
+	}
+}
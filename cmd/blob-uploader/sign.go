@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/sign"
+	"github.com/spf13/cobra"
+)
+
+type SignCommandOpt struct {
+	refName   string
+	keyFile   string
+	username  string
+	password  string
+	plainHTTP bool
+}
+
+var signCommandOpt SignCommandOpt
+
+// signCmd represents the sign command
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign a package with a local key",
+	Long: `sign the manifest digest of a package with a local ed25519 or ECDSA private key (PEM, PKCS #8 or SEC 1).
+
+The signature is stored like cosign does, as a simple signing payload in the sha256-<digest>.sig tag,
+so it can be checked with verify, download --verify-key or cosign verify --key.
+
+A key pair can be generated with openssl:
+  openssl genpkey -algorithm ed25519 -out key.pem
+  openssl pkey -in key.pem -pubout -out pub.pem`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refName, r, err := parseRefName(signCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		key, err := sign.LoadPrivateKey(signCommandOpt.keyFile)
+		if err != nil {
+			return err
+		}
+		reg := regctl.NewRegistry(r.Registry, signCommandOpt.username, signCommandOpt.password, regctlOptions(signCommandOpt.plainHTTP)...)
+		digest, err := reg.Digest(context.Background(), refName)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", refName, err)
+		}
+		payload, err := sign.Payload(fmt.Sprintf("%s/%s", r.Registry, r.Repository), digest)
+		if err != nil {
+			return err
+		}
+		signature, err := sign.Sign(key, payload)
+		if err != nil {
+			return err
+		}
+		err = reg.PushSignature(context.Background(), refName, digest, sign.Signature{Payload: payload, Signature: signature})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Successfully sign %s@%s\n", refName, digest)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+
+	signCmd.Flags().StringVarP(&signCommandOpt.refName, "ref-name", "r", "", "the package to sign (e.g. ghcr.io/example/hello:1.2.0)")
+	signCmd.Flags().StringVarP(&signCommandOpt.keyFile, "key", "", "", "the PEM encoded ed25519 or ECDSA private key")
+	signCmd.Flags().StringVarP(&signCommandOpt.username, "username", "u", "", "the username of registry")
+	signCmd.Flags().StringVarP(&signCommandOpt.password, "password", "p", "", "the password of registry")
+	signCmd.Flags().BoolVarP(&signCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+
+	requires := []string{
+		"ref-name",
+		"key",
+		"username",
+		"password",
+	}
+
+	for _, i := range requires {
+		signCmd.MarkFlagRequired(i)
+	}
+}
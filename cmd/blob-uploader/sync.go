@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/akkuman/blob-uploader/pkg/mirror"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/spf13/cobra"
+)
+
+type SyncCommandOpt struct {
+	match        string
+	concurrency  int
+	stateFile    string
+	srcUsername  string
+	srcPassword  string
+	srcPlainHTTP bool
+	dstUsername  string
+	dstPassword  string
+	dstPlainHTTP bool
+}
+
+var syncCommandOpt SyncCommandOpt
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync <src-repo> <dst-repo>",
+	Short: "Mirror the tags of a repository to another registry",
+	Long: `copy every tag of the source repository, or the tags matching --match, to the destination repository
+with all their platforms, signatures and referrers. The tags having the same digest in the destination already
+are skipped, so that the sync can be run periodically, e.g. to keep a copy of GitHub Packages on a self-hosted registry.
+
+--state records the synced tags in a file, an interrupted sync run again with the same file resumes
+without checking the tags done already.
+
+Example:
+  blob-uploader sync ghcr.io/example/hello registry.example.com/mirror/hello --dst-username admin --dst-password secret --concurrency 4 --state hello.sync.json`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if storage.IsLayoutRef(args[0]) || storage.IsLayoutRef(args[1]) {
+			return fmt.Errorf("sync is not supported for ocidir:// refs, use save and load instead")
+		}
+		srcRepo, rSrc, err := parseRefName(args[0])
+		if err != nil {
+			return err
+		}
+		dstRepo, rDst, err := parseRefName(args[1])
+		if err != nil {
+			return err
+		}
+		src := regctl.NewRegistry(rSrc.Registry, syncCommandOpt.srcUsername, syncCommandOpt.srcPassword, regctlOptions(syncCommandOpt.srcPlainHTTP)...)
+		dst := regctl.NewRegistry(rDst.Registry, syncCommandOpt.dstUsername, syncCommandOpt.dstPassword, regctlOptions(syncCommandOpt.dstPlainHTTP)...)
+		opts := []mirror.Option{mirror.WithConcurrency(syncCommandOpt.concurrency)}
+		if syncCommandOpt.match != "" {
+			re, err := regexp.Compile(syncCommandOpt.match)
+			if err != nil {
+				return fmt.Errorf("--match: %w", err)
+			}
+			opts = append(opts, mirror.WithMatch(re))
+		}
+		if syncCommandOpt.stateFile != "" {
+			state, err := mirror.LoadState(syncCommandOpt.stateFile, rSrc.SetTag("").CommonName(), rDst.SetTag("").CommonName())
+			if err != nil {
+				return err
+			}
+			opts = append(opts, mirror.WithState(state))
+		}
+		m, err := mirror.New(src, srcRepo, dst, dstRepo, opts...)
+		if err != nil {
+			return err
+		}
+		counts := make(map[mirror.Status]int)
+		results, err := m.Run(context.Background(), func(res mirror.Result) {
+			counts[res.Status]++
+			if res.Err != nil {
+				fmt.Printf("%-7s %s: %v\n", res.Status, res.Tag, res.Err)
+				return
+			}
+			fmt.Printf("%-7s %s %s\n", res.Status, res.Tag, res.Digest)
+		})
+		if results != nil {
+			fmt.Printf("%d tags: %d copied, %d skipped, %d failed\n", len(results), counts[mirror.Copied], counts[mirror.Skipped], counts[mirror.Failed])
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().StringVarP(&syncCommandOpt.match, "match", "", "", "sync only the tags matching this regex (e.g. '^v?[0-9]+\\.')")
+	syncCmd.Flags().IntVarP(&syncCommandOpt.concurrency, "concurrency", "c", 4, "the number of tags to copy at once")
+	syncCmd.Flags().StringVarP(&syncCommandOpt.stateFile, "state", "", "", "the file recording the synced tags, to resume an interrupted sync")
+	syncCmd.Flags().StringVarP(&syncCommandOpt.srcUsername, "src-username", "", "", "the username of the source registry")
+	syncCmd.Flags().StringVarP(&syncCommandOpt.srcPassword, "src-password", "", "", "the password of the source registry")
+	syncCmd.Flags().BoolVarP(&syncCommandOpt.srcPlainHTTP, "src-plain-http", "", false, "use HTTP instead of HTTPS for the source registry")
+	syncCmd.Flags().StringVarP(&syncCommandOpt.dstUsername, "dst-username", "", "", "the username of the destination registry")
+	syncCmd.Flags().StringVarP(&syncCommandOpt.dstPassword, "dst-password", "", "", "the password of the destination registry")
+	syncCmd.Flags().BoolVarP(&syncCommandOpt.dstPlainHTTP, "dst-plain-http", "", false, "use HTTP instead of HTTPS for the destination registry")
+}
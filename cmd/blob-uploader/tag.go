@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/spf13/cobra"
+)
+
+type TagCommandOpt struct {
+	username      string
+	password      string
+	plainHTTP     bool
+	force         bool
+	immutableTags []string
+}
+
+var tagCommandOpt TagCommandOpt
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag <src-ref> <dst-tag>...",
+	Short: "Promote a package to other tags without uploading it again",
+	Long: `put the existing manifest of the source ref under new tags, nothing is downloaded nor uploaded again.
+A destination is either a tag of the same repository (e.g. 1.2.3) or a full ref in another repository of the
+same registry (e.g. ghcr.io/example/stable/wget:1.2.3), the blobs are then mounted from the source repository
+and the platform manifests, signatures and referrers are copied along.
+Like upload, tagging refuses to move an immutable tag which points to another digest unless --force is given.
+The manifest is put unchanged, so a moved tag doesn't record the digest it replaces.
+
+Example:
+  blob-uploader tag ghcr.io/example/wget:1.2.3-rc1 1.2.3 stable
+  blob-uploader tag ghcr.io/example/staging/wget:1.2.3 ghcr.io/example/stable/wget:1.2.3`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if storage.IsLayoutRef(args[0]) {
+			return fmt.Errorf("tag is not supported for ocidir:// refs")
+		}
+		srcRefName, r, err := parseRefName(args[0])
+		if err != nil {
+			return err
+		}
+		var dstRefNames []string
+		for _, dst := range args[1:] {
+			if !strings.Contains(dst, "/") {
+				// a tag of the source repository
+				dstRefNames = append(dstRefNames, r.SetTag(dst).CommonName())
+				continue
+			}
+			dstRefName, _, err := parseRefName(dst)
+			if err != nil {
+				return err
+			}
+			dstRefNames = append(dstRefNames, dstRefName)
+		}
+		immutableTags, err := compileImmutableTags(tagCommandOpt.immutableTags)
+		if err != nil {
+			return err
+		}
+		tagOpts := []regctl.TagOption{regctl.WithImmutableTags(immutableTags...)}
+		if tagCommandOpt.force {
+			tagOpts = append(tagOpts, regctl.WithOverwrite())
+		}
+		reg := regctl.NewRegistry(r.Registry, tagCommandOpt.username, tagCommandOpt.password, regctlOptions(tagCommandOpt.plainHTTP)...)
+		digest, err := reg.Tag(context.Background(), srcRefName, dstRefNames, tagOpts...)
+		if errors.Is(err, regctl.ErrImmutableTag) {
+			return fmt.Errorf("tag %s: %w, use --force to overwrite it", srcRefName, err)
+		}
+		if err != nil {
+			return fmt.Errorf("tag %s: %w", srcRefName, err)
+		}
+		for _, dstRefName := range dstRefNames {
+			fmt.Printf("Successfully tagged %s as %s\n", digest, dstRefName)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+
+	tagCmd.Flags().StringVarP(&tagCommandOpt.username, "username", "u", "", "the username of registry")
+	tagCmd.Flags().StringVarP(&tagCommandOpt.password, "password", "p", "", "the password of registry")
+	tagCmd.Flags().BoolVarP(&tagCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+	tagCmd.Flags().BoolVarP(&tagCommandOpt.force, "force", "", false, "move the tags even if they are immutable and point to another digest")
+	tagCmd.Flags().StringArrayVarP(&tagCommandOpt.immutableTags, "immutable-tag", "", []string{util.SemverRelease}, "refuse to move the tags matching this regex once they point to a digest, can be repeated, '' makes every tag mutable")
+}
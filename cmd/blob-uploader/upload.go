@@ -4,15 +4,31 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
-	"strings"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/archive"
+	"github.com/akkuman/blob-uploader/pkg/policy"
+	"github.com/akkuman/blob-uploader/pkg/provenance"
 	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/sbom"
+	"github.com/akkuman/blob-uploader/pkg/sign"
 	"github.com/akkuman/blob-uploader/pkg/util"
 	"github.com/akkuman/blob-uploader/storage"
+	"github.com/regclient/regclient/types/ref"
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +39,25 @@ type UploadCommandOpt struct {
 	password string
 	platform string
 	imageSource string
+	force bool
+	skipValidation bool
+	skipPolicy bool
+	policyFile string
+	annotations []string
+	annotationFile string
+	description string
+	licenses string
+	metadataFile string
+	manifestFormat string
+	artifactType string
+	files []string
+	dryRun bool
+	keepLayout string
+	plainHTTP bool
+	sbomFormat string
+	provenance bool
+	provenanceKey string
+	immutableTags []string
 }
 
 var uploadCommandOpt UploadCommandOpt
@@ -31,38 +66,147 @@ var uploadCommandOpt UploadCommandOpt
 var uploadCmd = &cobra.Command{
 	Use:   "upload",
 	Short: "Upload file to github packages",
-	Long: `upload file bolb to github packages
+	Long: `upload file bolb to github packages, or to any OCI registry such as serve-registry
 
 ref: https://github.com/Homebrew/brew/blob/b753315b0b1e78b361612bf4985502bf9dca5582/Library/Homebrew/github_packages.rb#L196-L428`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		uploadCommandOpt.refName = strings.ToLower(uploadCommandOpt.refName)
-		if !strings.HasPrefix(uploadCommandOpt.refName, "ghcr.io") {
-			return fmt.Errorf("ref-name must start with ghcr.io")
+		refName, r, err := parseRefName(uploadCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		uploadCommandOpt.refName = refName
+		if uploadCommandOpt.tgzFilePath == "" && len(uploadCommandOpt.files) == 0 {
+			return fmt.Errorf("either --tgz-file or --file must be given")
+		}
+		for _, filePath := range append([]string{uploadCommandOpt.tgzFilePath}, uploadCommandOpt.files...) {
+			if filePath != "" && !util.FileExist(filePath) {
+				return fmt.Errorf("%s is not exist", filePath)
+			}
 		}
-		if uploadCommandOpt.tgzFilePath == ""|| !util.FileExist(uploadCommandOpt.tgzFilePath) {
-			return fmt.Errorf("%s is not exist", uploadCommandOpt.tgzFilePath)
+		if uploadCommandOpt.tgzFilePath != "" {
+			err = validateArchive(uploadCommandOpt.tgzFilePath, uploadCommandOpt.skipValidation)
+			if err != nil {
+				return err
+			}
 		}
 		platform := util.ParsePlatform(uploadCommandOpt.platform)
 		if platform == nil {
 			return fmt.Errorf("%s is not allowed", uploadCommandOpt.platform)
 		}
-		reg := regctl.NewRegistry("ghcr.io", uploadCommandOpt.username, uploadCommandOpt.password)
-		err := reg.Login()
+		var sbomFormat sbom.Format
+		if uploadCommandOpt.sbomFormat != "" {
+			if storage.IsLayoutRef(uploadCommandOpt.refName) {
+				return fmt.Errorf("--sbom is not supported for ocidir:// refs")
+			}
+			sbomFormat, err = sbom.ParseFormat(uploadCommandOpt.sbomFormat)
+			if err != nil {
+				return err
+			}
+		}
+		var predicate *provenance.Predicate
+		var provenanceKey crypto.Signer
+		if uploadCommandOpt.provenance || uploadCommandOpt.provenanceKey != "" {
+			if storage.IsLayoutRef(uploadCommandOpt.refName) {
+				return fmt.Errorf("--provenance is not supported for ocidir:// refs")
+			}
+			predicate, err = provenance.FromGitHubActions(os.Getenv)
+			if err != nil {
+				return fmt.Errorf("build provenance failed: %w", err)
+			}
+			if uploadCommandOpt.provenanceKey != "" {
+				provenanceKey, err = sign.LoadPrivateKey(uploadCommandOpt.provenanceKey)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		annotations, err := uploadAnnotations(r)
 		if err != nil {
-			return fmt.Errorf("connect github package error: %v", err)
+			return err
+		}
+		if uploadCommandOpt.policyFile != "" {
+			pushedAnnotations := oci.StandardAnnotations(r.Tag, uploadCommandOpt.imageSource, time.Now())
+			maps.Copy(pushedAnnotations, annotations)
+			err = checkPolicy(uploadCommandOpt.policyFile, uploadCommandOpt.tgzFilePath, uploadCommandOpt.files, pushedAnnotations, uploadCommandOpt.skipPolicy)
+			if err != nil {
+				return err
+			}
 		}
-		ociInstance := oci.NewOCI()
-		stge := storage.NewGithubPackageStorage(ociInstance, reg)
-		f, err := os.Open(uploadCommandOpt.tgzFilePath)
+		uploadOpts, err := uploadStorageOptions(annotations)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		err = stge.Upload(context.Background(), uploadCommandOpt.refName, *platform, uploadCommandOpt.imageSource, f)
+		var reg *regctl.Registry
+		if uploadCommandOpt.dryRun {
+			uploadOpts = append(uploadOpts, storage.WithDryRun())
+		} else if !storage.IsLayoutRef(uploadCommandOpt.refName) {
+			if uploadCommandOpt.username == "" || uploadCommandOpt.password == "" {
+				return fmt.Errorf("username and password are required unless --dry-run is given")
+			}
+			reg = regctl.NewRegistry(r.Registry, uploadCommandOpt.username, uploadCommandOpt.password, regctlOptions(uploadCommandOpt.plainHTTP)...)
+			err = reg.Login()
+			if err != nil {
+				return fmt.Errorf("connect registry error: %v", err)
+			}
+		}
+		var ociInstance *oci.OCI
+		if uploadCommandOpt.keepLayout != "" {
+			ociInstance, err = oci.NewOCIWithRootDir(uploadCommandOpt.keepLayout)
+			if err != nil {
+				return err
+			}
+		} else {
+			ociInstance = oci.NewOCI()
+		}
+		defer ociInstance.Close()
+		var stge storage.Storage = storage.NewGithubPackageStorage(ociInstance, reg)
+		if storage.IsLayoutRef(uploadCommandOpt.refName) {
+			stge = storage.NewOCILayoutStorage(ociInstance)
+		}
+		var reader io.Reader
+		if uploadCommandOpt.tgzFilePath != "" {
+			f, err := os.Open(uploadCommandOpt.tgzFilePath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			reader = f
+		}
+		err = stge.Upload(context.Background(), uploadCommandOpt.refName, *platform, uploadCommandOpt.imageSource, reader, uploadOpts...)
+		if errors.Is(err, storage.ErrImmutableTag) {
+			return fmt.Errorf("%w, use --force to overwrite it", err)
+		}
+		if errors.Is(err, storage.ErrUpToDate) {
+			// the SBOM and the provenance were attached by the upload which pushed it
+			fmt.Printf("%s is up to date, nothing is pushed\n", uploadCommandOpt.refName)
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-		fmt.Println("Successfully upload tgz to registry!")
+		if uploadCommandOpt.dryRun {
+			err = printDryRun(ociInstance)
+			if err != nil {
+				return err
+			}
+		} else {
+			fmt.Println("Successfully upload tgz to registry!")
+		}
+		if sbomFormat != "" {
+			err = attachSBOM(reg, r, platform, sbomFormat)
+			if err != nil {
+				return err
+			}
+		}
+		if predicate != nil {
+			err = attachProvenance(reg, predicate, provenanceKey)
+			if err != nil {
+				return err
+			}
+		}
+		if uploadCommandOpt.keepLayout != "" {
+			fmt.Printf("OCI layout is kept in %s\n", uploadCommandOpt.keepLayout)
+		}
 		return nil
 	},
 }
@@ -70,18 +214,34 @@ ref: https://github.com/Homebrew/brew/blob/b753315b0b1e78b361612bf4985502bf9dca5
 func init() {
 	rootCmd.AddCommand(uploadCmd)
 
-	uploadCmd.Flags().StringVarP(&uploadCommandOpt.tgzFilePath, "tgz-file", "f", "", "file path for tgz which will be uploaded")
-	uploadCmd.Flags().StringVarP(&uploadCommandOpt.refName, "ref-name", "r", "", "the ref that you will push (e.g. ghcr.io/example/hello:1.2.0)")
-	uploadCmd.Flags().StringVarP(&uploadCommandOpt.username, "username", "u", "", "the username of registry")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.tgzFilePath, "tgz-file", "f", "", "file path for tgz which will be uploaded, optional when --file is given")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.refName, "ref-name", "r", "", "the ref that you will push (e.g. ghcr.io/example/hello:1.2.0 or ocidir:///srv/packages:hello:1.2.0)")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.username, "username", "u", "", "the username of registry, not required for ocidir:// refs")
 	uploadCmd.Flags().StringVarP(&uploadCommandOpt.password, "password", "p", "", "the password of registry")
 	uploadCmd.Flags().StringVarP(&uploadCommandOpt.platform, "platform", "", "linux/amd64", "Specify platform (e.g. linux/amd64)")
 	uploadCmd.Flags().StringVarP(&uploadCommandOpt.imageSource, "image-source", "", "", "value of org.opencontainers.image.source, if blank, default to current repo url")
+	uploadCmd.Flags().BoolVarP(&uploadCommandOpt.force, "force", "", false, "overwrite the tag even if it is immutable and points to another digest")
+	uploadCmd.Flags().BoolVarP(&uploadCommandOpt.skipValidation, "skip-validation", "", false, "upload even if the archive fails validation")
+	uploadCmd.Flags().BoolVarP(&uploadCommandOpt.skipPolicy, "skip-policy", "", false, "upload even if the package violates an error rule of the content policy")
+	uploadCmd.Flags().StringArrayVarP(&uploadCommandOpt.immutableTags, "immutable-tag", "", []string{util.SemverRelease}, "refuse to overwrite the tags matching this regex once they point to a digest, can be repeated, '' makes every tag mutable")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.policyFile, "policy", "", "", "content policy file (YAML) which the upload must satisfy")
+	uploadCmd.Flags().StringArrayVarP(&uploadCommandOpt.annotations, "annotation", "a", nil, "add an annotation in the form of key=value, can be repeated")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.annotationFile, "annotation-file", "", "", "file containing one annotation key=value per line")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.description, "description", "", "", "value of org.opencontainers.image.description")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.licenses, "licenses", "", "", "value of org.opencontainers.image.licenses (SPDX license expression)")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.manifestFormat, "manifest-format", "", "image", "image: image-style manifest for compatibility, artifact: OCI 1.1 artifact manifest")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.artifactType, "artifact-type", "", oci.ArtifactTypePackage, "the artifactType of the artifact manifest, used with --manifest-format artifact or --file")
+	uploadCmd.Flags().StringArrayVarP(&uploadCommandOpt.files, "file", "", nil, "add a file as a separate layer named after the file (e.g. a man page or completions), can be repeated, the package is then an artifact manifest")
+	uploadCmd.Flags().BoolVarP(&uploadCommandOpt.dryRun, "dry-run", "", false, "build the OCI layout and print what would be pushed without contacting the registry")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.keepLayout, "keep-layout", "", "", "build the OCI layout in this empty directory and keep it after upload")
+	uploadCmd.Flags().BoolVarP(&uploadCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.sbomFormat, "sbom", "", "", "generate a SBOM of the package files in this format (spdx or cyclonedx) and attach it to the platform manifest")
+	uploadCmd.Flags().BoolVarP(&uploadCommandOpt.provenance, "provenance", "", false, "attach a SLSA provenance built from the GitHub Actions environment to the index")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.provenanceKey, "provenance-key", "", "", "sign the provenance in a DSSE envelope with this PEM encoded ed25519 or ECDSA private key, implies --provenance")
+	uploadCmd.Flags().StringVarP(&uploadCommandOpt.metadataFile, "metadata-file", "", "", "JSON file of the package metadata (name, version, description, homepage, license, maintainers, dependencies, binaries)")
 
 	requires := []string{
-		"tgz-file",
 		"ref-name",
-		"username",
-		"password",
 	}
 
 	for _, i := range requires {
@@ -99,3 +259,285 @@ func init() {
 		}
 	}
 }
+
+// uploadAnnotations collects the annotations of the package, from lowest to highest precedence:
+// the defaults derived from the ref and the GitHub Actions environment, --annotation-file and --annotation
+func uploadAnnotations(r ref.Ref) (map[string]string, error) {
+	annotations := make(map[string]string)
+	annotations[oci.AnnotationTitle] = path.Base(r.Repository)
+	if uploadCommandOpt.imageSource != "" {
+		annotations[oci.AnnotationURL] = uploadCommandOpt.imageSource
+	}
+	if sha, ok := os.LookupEnv("GITHUB_SHA"); ok && sha != "" {
+		annotations[oci.AnnotationRevision] = sha
+	}
+	// https://reproducible-builds.org/docs/source-date-epoch/
+	if epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok && epoch != "" {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %w", err)
+		}
+		annotations[oci.AnnotationCreated] = time.Unix(sec, 0).UTC().Format(time.RFC3339)
+	}
+	if uploadCommandOpt.description != "" {
+		annotations[oci.AnnotationDescription] = uploadCommandOpt.description
+	}
+	if uploadCommandOpt.licenses != "" {
+		annotations[oci.AnnotationLicenses] = uploadCommandOpt.licenses
+	}
+	if uploadCommandOpt.annotationFile != "" {
+		fileAnnotations, err := util.ReadKeyValueFile(uploadCommandOpt.annotationFile)
+		if err != nil {
+			return nil, fmt.Errorf("read annotation file failed: %w", err)
+		}
+		maps.Copy(annotations, fileAnnotations)
+	}
+	flagAnnotations, err := util.ParseKeyValues(uploadCommandOpt.annotations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotation: %w", err)
+	}
+	maps.Copy(annotations, flagAnnotations)
+	return annotations, nil
+}
+
+func uploadStorageOptions(annotations map[string]string) ([]storage.UploadOption, error) {
+	uploadOpts := []storage.UploadOption{storage.WithAnnotations(annotations)}
+	if len(uploadCommandOpt.files) > 0 {
+		uploadOpts = append(uploadOpts, storage.WithFiles(uploadCommandOpt.files...))
+	}
+	switch uploadCommandOpt.manifestFormat {
+	case "image":
+		// the files aren't tar layers, the package is an artifact anyway
+		if len(uploadCommandOpt.files) > 0 {
+			uploadOpts = append(uploadOpts, storage.WithArtifactType(uploadCommandOpt.artifactType))
+		}
+	case "artifact":
+		uploadOpts = append(uploadOpts, storage.WithArtifactType(uploadCommandOpt.artifactType))
+	default:
+		return nil, fmt.Errorf("unknown manifest format: %s", uploadCommandOpt.manifestFormat)
+	}
+	if uploadCommandOpt.metadataFile != "" {
+		md, err := storage.LoadMetadata(uploadCommandOpt.metadataFile)
+		if err != nil {
+			return nil, err
+		}
+		uploadOpts = append(uploadOpts, storage.WithMetadata(md))
+	}
+	immutableTags, err := compileImmutableTags(uploadCommandOpt.immutableTags)
+	if err != nil {
+		return nil, err
+	}
+	uploadOpts = append(uploadOpts, storage.WithImmutableTags(immutableTags...))
+	if uploadCommandOpt.force {
+		uploadOpts = append(uploadOpts, storage.WithOverwrite())
+	}
+	return uploadOpts, nil
+}
+
+func printDryRun(ociInstance *oci.OCI) error {
+	documents, err := ociInstance.Documents()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Dry run, nothing is pushed to %s\n", uploadCommandOpt.refName)
+	for _, doc := range documents {
+		d := doc.Descriptor
+		extra := d.MediaType
+		if d.Platform != nil {
+			extra = fmt.Sprintf("%s/%s", d.Platform.OS, d.Platform.Architecture)
+		}
+		if title := d.Annotations[oci.AnnotationTitle]; doc.Kind == "layer" && title != "" {
+			extra = fmt.Sprintf("%s %s", extra, title)
+		}
+		fmt.Printf("%-8s %s %10d %s\n", doc.Kind, d.Digest, d.Size, extra)
+	}
+	for _, doc := range documents {
+		if doc.Data == nil {
+			continue
+		}
+		var pretty bytes.Buffer
+		err = json.Indent(&pretty, doc.Data, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n%s %s:\n%s\n", doc.Kind, doc.Descriptor.Digest, pretty.String())
+	}
+	return nil
+}
+
+// attachSBOM generates the SBOM of the uploaded files and attaches it to the manifest of platform,
+// reg is nil with --dry-run, the SBOM is only generated then
+func attachSBOM(reg *regctl.Registry, r ref.Ref, platform *util.Platform, format sbom.Format) error {
+	var files []sbom.File
+	var err error
+	if uploadCommandOpt.tgzFilePath != "" {
+		files, err = sbom.ScanArchive(uploadCommandOpt.tgzFilePath)
+		if err != nil {
+			return fmt.Errorf("scan %s failed: %w", uploadCommandOpt.tgzFilePath, err)
+		}
+	}
+	for _, filePath := range uploadCommandOpt.files {
+		f, err := sbom.ScanFile(filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	name := path.Base(r.Repository)
+	data, err := sbom.Generate(format, &sbom.Package{Name: name, Version: r.Tag, Files: files, Created: time.Now()})
+	if err != nil {
+		return err
+	}
+	if reg == nil {
+		fmt.Printf("SBOM (%s) of %d file(s) would be attached to %s\n", format, len(files), platform.String())
+		return nil
+	}
+	tmpDir, err := os.MkdirTemp("", "sbom")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	sbomPath := filepath.Join(tmpDir, format.FileName(name))
+	err = os.WriteFile(sbomPath, data, 0664)
+	if err != nil {
+		return err
+	}
+	digest, err := reg.Attach(context.Background(), uploadCommandOpt.refName, platform, sbomPath, regctl.Attachment{
+		ArtifactType: format.ArtifactType(),
+		MediaType:    format.ArtifactType(),
+		Annotations:  map[string]string{oci.AnnotationCreated: time.Now().UTC().Format(time.RFC3339)},
+	})
+	if err != nil {
+		return fmt.Errorf("attach SBOM failed: %w", err)
+	}
+	fmt.Printf("Successfully attach SBOM (%s) of %d file(s): %s\n", format, len(files), digest)
+	return nil
+}
+
+// attachProvenance attaches the provenance of the uploaded index and its platform manifests to the index,
+// signed in a DSSE envelope when key isn't nil, reg is nil with --dry-run
+func attachProvenance(reg *regctl.Registry, predicate *provenance.Predicate, key crypto.Signer) error {
+	if reg == nil {
+		fmt.Printf("SLSA provenance of %s would be attached\n", predicate.BuildDefinition.ExternalParameters.Workflow.Repository)
+		return nil
+	}
+	ctx := context.Background()
+	indexDigest, manifests, err := reg.ResolveIndex(ctx, uploadCommandOpt.refName)
+	if err != nil {
+		return fmt.Errorf("resolve %s failed: %w", uploadCommandOpt.refName, err)
+	}
+	subjects := []provenance.Subject{provenance.NewSubject(uploadCommandOpt.refName, indexDigest, nil)}
+	for _, m := range manifests {
+		subjects = append(subjects, provenance.NewSubject(uploadCommandOpt.refName, m.Digest, map[string]string{"platform": m.Platform.String()}))
+	}
+	statement := provenance.NewStatement(predicate, subjects...)
+	artifactType := provenance.ArtifactTypeStatement
+	fileName := "provenance.intoto.json"
+	var data []byte
+	if key != nil {
+		envelope, err := provenance.SignStatement(statement, key)
+		if err != nil {
+			return err
+		}
+		artifactType = provenance.ArtifactTypeEnvelope
+		fileName = "provenance.dsse.json"
+		data, err = json.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err = json.Marshal(statement)
+		if err != nil {
+			return err
+		}
+	}
+	tmpDir, err := os.MkdirTemp("", "provenance")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	filePath := filepath.Join(tmpDir, fileName)
+	err = os.WriteFile(filePath, data, 0664)
+	if err != nil {
+		return err
+	}
+	digest, err := reg.Attach(ctx, uploadCommandOpt.refName, nil, filePath, regctl.Attachment{
+		ArtifactType: artifactType,
+		MediaType:    artifactType,
+		Annotations:  map[string]string{oci.AnnotationCreated: time.Now().UTC().Format(time.RFC3339)},
+	})
+	if err != nil {
+		return fmt.Errorf("attach provenance failed: %w", err)
+	}
+	fmt.Printf("Successfully attach provenance of %d subject(s): %s\n", len(subjects), digest)
+	return nil
+}
+
+func validateArchive(tgzFilePath string, skip bool) error {
+	report, err := archive.Validate(tgzFilePath)
+	if err != nil {
+		return fmt.Errorf("validate %s failed: %w", tgzFilePath, err)
+	}
+	fmt.Printf("Archive %s: %s\n", tgzFilePath, report)
+	if report.OK() {
+		return nil
+	}
+	for _, problem := range report.Problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	if skip {
+		fmt.Println("Archive validation failed, uploading anyway because of --skip-validation")
+		return nil
+	}
+	return fmt.Errorf("archive validation failed with %d problem(s), use --skip-validation to upload anyway", len(report.Problems))
+}
+
+func checkPolicy(policyFile string, tgzFilePath string, files []string, annotations map[string]string, skip bool) error {
+	p, err := policy.Load(policyFile)
+	if err != nil {
+		return fmt.Errorf("load policy %s failed: %w", policyFile, err)
+	}
+	result, err := p.Check(tgzFilePath, files, annotations)
+	if err != nil {
+		return fmt.Errorf("check policy failed: %w", err)
+	}
+	if len(result.Violations) == 0 {
+		fmt.Println("Content policy check passed")
+		return nil
+	}
+	byFile := result.ByFile()
+	for _, file := range result.Files() {
+		if file == "" {
+			fmt.Println("Package:")
+		} else {
+			fmt.Printf("%s:\n", file)
+		}
+		for _, v := range byFile[file] {
+			fmt.Printf("  [%s] %s: %s\n", v.Severity, v.Rule, v.Message)
+		}
+	}
+	if !result.HasErrors() {
+		return nil
+	}
+	if skip {
+		fmt.Println("Content policy check failed, uploading anyway because of --skip-policy")
+		return nil
+	}
+	return fmt.Errorf("content policy check failed, use --skip-policy to upload anyway")
+}
+
+// compileImmutableTags compiles the patterns of --immutable-tag, the empty ones are skipped
+func compileImmutableTags(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("--immutable-tag: %w", err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestUploadAnnotations(t *testing.T) {
+	annotationFile := filepath.Join(t.TempDir(), "annotations")
+	err := os.WriteFile(annotationFile, []byte(`# overrides SOURCE_DATE_EPOCH and --description
+org.opencontainers.image.created=2024-01-02T03:04:05Z
+org.opencontainers.image.description=from the file
+
+org.opencontainers.image.vendor=example
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ref.New("ghcr.io/example/hello:1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []struct {
+		name           string
+		epoch          string
+		description    string
+		annotationFile string
+		annotations    []string
+		want           map[string]string
+		ok             bool
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{oci.AnnotationTitle: "hello"},
+			ok:   true,
+		},
+		{
+			name:        "SOURCE_DATE_EPOCH",
+			epoch:       "1700000000",
+			description: "hello world",
+			want: map[string]string{
+				oci.AnnotationTitle:       "hello",
+				oci.AnnotationCreated:     "2023-11-14T22:13:20Z",
+				oci.AnnotationDescription: "hello world",
+			},
+			ok: true,
+		},
+		{
+			name:           "annotation file overrides the defaults and SOURCE_DATE_EPOCH",
+			epoch:          "1700000000",
+			description:    "hello world",
+			annotationFile: annotationFile,
+			want: map[string]string{
+				oci.AnnotationTitle:               "hello",
+				oci.AnnotationCreated:             "2024-01-02T03:04:05Z",
+				oci.AnnotationDescription:         "from the file",
+				"org.opencontainers.image.vendor": "example",
+			},
+			ok: true,
+		},
+		{
+			name:           "--annotation overrides the annotation file",
+			epoch:          "1700000000",
+			annotationFile: annotationFile,
+			annotations:    []string{"org.opencontainers.image.vendor=other", oci.AnnotationTitle + "=hi=there"},
+			want: map[string]string{
+				oci.AnnotationTitle:               "hi=there",
+				oci.AnnotationCreated:             "2024-01-02T03:04:05Z",
+				oci.AnnotationDescription:         "from the file",
+				"org.opencontainers.image.vendor": "other",
+			},
+			ok: true,
+		},
+		{
+			name:  "invalid SOURCE_DATE_EPOCH",
+			epoch: "yesterday",
+		},
+		{
+			name:        "empty key",
+			annotations: []string{"=value"},
+		},
+		{
+			name:           "missing annotation file",
+			annotationFile: filepath.Join(t.TempDir(), "missing"),
+		},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			t.Setenv("GITHUB_SHA", "")
+			t.Setenv("SOURCE_DATE_EPOCH", x.epoch)
+			saved := uploadCommandOpt
+			t.Cleanup(func() { uploadCommandOpt = saved })
+			uploadCommandOpt = UploadCommandOpt{
+				description:    x.description,
+				annotationFile: x.annotationFile,
+				annotations:    x.annotations,
+			}
+			got, err := uploadAnnotations(r)
+			if (err == nil) != x.ok {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if x.ok && !maps.Equal(got, x.want) {
+				t.Errorf("got %v, want %v", got, x.want)
+			}
+		})
+	}
+}
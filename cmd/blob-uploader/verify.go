@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/sign"
+	"github.com/akkuman/blob-uploader/storage"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+type VerifyCommandOpt struct {
+	refName   string
+	keyFile   string
+	username  string
+	password  string
+	plainHTTP bool
+}
+
+var verifyCommandOpt VerifyCommandOpt
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the signature of a package",
+	Long: `check that the manifest digest of a package is signed by the private key of --key,
+a PEM encoded ed25519 or ECDSA public key such as the pub.pem of sign or a cosign.pub`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refName, r, err := parseRefName(verifyCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		reg := regctl.NewRegistry(r.Registry, verifyCommandOpt.username, verifyCommandOpt.password, regctlOptions(verifyCommandOpt.plainHTTP)...)
+		verifier, err := signatureVerifier(reg, verifyCommandOpt.keyFile)
+		if err != nil {
+			return err
+		}
+		digest, err := reg.Digest(context.Background(), refName)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", refName, err)
+		}
+		err = verifier(context.Background(), refName, digest)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Verified signature of %s@%s\n", refName, digest)
+		return nil
+	},
+}
+
+// signatureVerifier returns a storage.Verifier accepting the manifest digests signed by the private key of pubKeyFile
+func signatureVerifier(reg *regctl.Registry, pubKeyFile string) (storage.Verifier, error) {
+	pub, err := sign.LoadPublicKey(pubKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, refName string, digest string) error {
+		r, err := ref.New(refName)
+		if err != nil {
+			return err
+		}
+		sigs, err := reg.Signatures(ctx, refName, digest)
+		if err != nil {
+			return err
+		}
+		return sign.Verify(pub, fmt.Sprintf("%s/%s", r.Registry, r.Repository), digest, sigs)
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVarP(&verifyCommandOpt.refName, "ref-name", "r", "", "the package to verify (e.g. ghcr.io/example/hello:1.2.0)")
+	verifyCmd.Flags().StringVarP(&verifyCommandOpt.keyFile, "key", "", "", "the PEM encoded ed25519 or ECDSA public key")
+	verifyCmd.Flags().StringVarP(&verifyCommandOpt.username, "username", "u", "", "the username of registry, only for private packages")
+	verifyCmd.Flags().StringVarP(&verifyCommandOpt.password, "password", "p", "", "the password of registry")
+	verifyCmd.Flags().BoolVarP(&verifyCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+
+	requires := []string{
+		"ref-name",
+		"key",
+	}
+
+	for _, i := range requires {
+		verifyCmd.MarkFlagRequired(i)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/akkuman/blob-uploader/pkg/provenance"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/sign"
+	"github.com/spf13/cobra"
+)
+
+type VerifyProvenanceCommandOpt struct {
+	refName    string
+	repository string
+	gitRef     string
+	keyFile    string
+	username   string
+	password   string
+	plainHTTP  bool
+}
+
+var verifyProvenanceCommandOpt VerifyProvenanceCommandOpt
+
+// verifyProvenanceCmd represents the verify-provenance command
+var verifyProvenanceCmd = &cobra.Command{
+	Use:   "verify-provenance",
+	Short: "Verify that a package was built from an expected repository and ref",
+	Long: `check the SLSA provenance attached to a package by upload --provenance: the index of the package
+must be one of its subjects and it must have been built from --repo, and from --ref if given.
+
+With --key, only a provenance signed by the private key of this public key is accepted.
+
+Example:
+  blob-uploader verify-provenance -r ghcr.io/example/hello:1.2.0 --repo example/hello --ref refs/tags/v1.2.0 --key pub.pem`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refName, r, err := parseRefName(verifyProvenanceCommandOpt.refName)
+		if err != nil {
+			return err
+		}
+		var pub crypto.PublicKey
+		if verifyProvenanceCommandOpt.keyFile != "" {
+			pub, err = sign.LoadPublicKey(verifyProvenanceCommandOpt.keyFile)
+			if err != nil {
+				return err
+			}
+		}
+		ctx := context.Background()
+		reg := regctl.NewRegistry(r.Registry, verifyProvenanceCommandOpt.username, verifyProvenanceCommandOpt.password, regctlOptions(verifyProvenanceCommandOpt.plainHTTP)...)
+		digest, err := reg.Digest(ctx, refName)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", refName, err)
+		}
+		referrers, err := reg.Referrers(ctx, refName, nil, "")
+		if err != nil {
+			return err
+		}
+		expect := provenance.Expectation{
+			Digest:     digest,
+			Repository: verifyProvenanceCommandOpt.repository,
+			Ref:        verifyProvenanceCommandOpt.gitRef,
+		}
+		var errs []error
+		for _, x := range referrers {
+			if x.ArtifactType != provenance.ArtifactTypeStatement && x.ArtifactType != provenance.ArtifactTypeEnvelope {
+				continue
+			}
+			var buf bytes.Buffer
+			_, err := reg.DownloadReferrer(ctx, refName, x.Digest, &buf)
+			if err == nil {
+				var statement *provenance.Statement
+				statement, err = provenance.Parse(x.ArtifactType, buf.Bytes(), pub)
+				if err == nil {
+					err = statement.Check(expect)
+				}
+				if err == nil {
+					workflow := statement.Predicate.BuildDefinition.ExternalParameters.Workflow
+					fmt.Printf("Verified provenance of %s@%s: built from %s@%s by %s\n", refName, digest,
+						workflow.Repository, workflow.Ref, statement.Predicate.RunDetails.Builder.ID)
+					return nil
+				}
+			}
+			errs = append(errs, fmt.Errorf("provenance %s: %w", x.Digest, err))
+		}
+		if len(errs) == 0 {
+			return fmt.Errorf("%s@%s has no provenance", refName, digest)
+		}
+		return errors.Join(errs...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyProvenanceCmd)
+
+	verifyProvenanceCmd.Flags().StringVarP(&verifyProvenanceCommandOpt.refName, "ref-name", "r", "", "the package to verify (e.g. ghcr.io/example/hello:1.2.0)")
+	verifyProvenanceCmd.Flags().StringVarP(&verifyProvenanceCommandOpt.repository, "repo", "", "", "the repository which must have built the package (e.g. example/hello or https://github.com/example/hello)")
+	verifyProvenanceCmd.Flags().StringVarP(&verifyProvenanceCommandOpt.gitRef, "ref", "", "", "the git ref which must have been built (e.g. refs/tags/v1.2.0), any ref if blank")
+	verifyProvenanceCmd.Flags().StringVarP(&verifyProvenanceCommandOpt.keyFile, "key", "", "", "require a provenance signed by the private key of this PEM encoded public key")
+	verifyProvenanceCmd.Flags().StringVarP(&verifyProvenanceCommandOpt.username, "username", "u", "", "the username of registry, only for private packages")
+	verifyProvenanceCmd.Flags().StringVarP(&verifyProvenanceCommandOpt.password, "password", "p", "", "the password of registry")
+	verifyProvenanceCmd.Flags().BoolVarP(&verifyProvenanceCommandOpt.plainHTTP, "plain-http", "", false, "use HTTP instead of HTTPS, e.g. for a local serve-registry")
+
+	requires := []string{
+		"ref-name",
+		"repo",
+	}
+
+	for _, i := range requires {
+		verifyProvenanceCmd.MarkFlagRequired(i)
+	}
+}
@@ -0,0 +1,38 @@
+package oci
+
+import (
+	"time"
+)
+
+// annotation keys, see https://github.com/opencontainers/image-spec/blob/main/annotations.md
+const (
+	AnnotationPackageType = "com.github.package.type"
+	AnnotationBinDigest   = "dev.pkgforge.bin.digest"
+	// AnnotationReplaces is the digest of the index which the tag pointed to before this upload
+	AnnotationReplaces    = "dev.pkgforge.replaces.digest"
+	AnnotationSource      = "org.opencontainers.image.source"
+	AnnotationVersion     = "org.opencontainers.image.version"
+	AnnotationCreated     = "org.opencontainers.image.created"
+	AnnotationRevision    = "org.opencontainers.image.revision"
+	AnnotationTitle       = "org.opencontainers.image.title"
+	AnnotationDescription = "org.opencontainers.image.description"
+	AnnotationLicenses    = "org.opencontainers.image.licenses"
+	AnnotationURL         = "org.opencontainers.image.url"
+	AnnotationRefName     = "org.opencontainers.image.ref.name"
+)
+
+const PackageType = "pkgforge_package"
+
+// StandardAnnotations returns the annotations which are written by BuildOCI
+// unless they are overridden by WithAnnotations
+func StandardAnnotations(tagVersion string, imageSource string, created time.Time) map[string]string {
+	annotations := map[string]string{
+		AnnotationPackageType: PackageType,
+		AnnotationSource:      imageSource,
+		AnnotationCreated:     created.UTC().Format(time.RFC3339),
+	}
+	if tagVersion != "" && tagVersion != "latest" {
+		annotations[AnnotationVersion] = tagVersion
+	}
+	return annotations
+}
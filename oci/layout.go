@@ -0,0 +1,185 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/util"
+)
+
+// Layout is an OCI layout directory holding the tags of one package,
+// every tag is an image index entry of index.json named by org.opencontainers.image.ref.name
+type Layout struct {
+	rootDir  string
+	blobsDir string
+}
+
+func OpenLayout(rootDir string) *Layout {
+	return &Layout{
+		rootDir:  rootDir,
+		blobsDir: filepath.Join(rootDir, "blobs/sha256"),
+	}
+}
+
+func (l *Layout) GetRootDir() string {
+	return l.rootDir
+}
+
+func (l *Layout) readIndexJSON() (*Index, error) {
+	data, err := os.ReadFile(filepath.Join(l.rootDir, "index.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Index{SchemaVersion: 2}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	indexJSON := &Index{}
+	err = json.Unmarshal(data, indexJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(l.rootDir, "index.json"), err)
+	}
+	return indexJSON, nil
+}
+
+// Tags returns the tags in the order they were first put
+func (l *Layout) Tags() ([]string, error) {
+	indexJSON, err := l.readIndexJSON()
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, d := range indexJSON.Manifests {
+		if tag := d.Annotations[AnnotationRefName]; tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// Resolve returns the descriptor of the image index tagged tag
+func (l *Layout) Resolve(tag string) (Descriptor, error) {
+	indexJSON, err := l.readIndexJSON()
+	if err != nil {
+		return Descriptor{}, err
+	}
+	for _, d := range indexJSON.Manifests {
+		if d.Annotations[AnnotationRefName] == tag {
+			return d, nil
+		}
+	}
+	return Descriptor{}, fmt.Errorf("tag %s not found in %s", tag, l.rootDir)
+}
+
+// Index reads the image index of descriptor
+func (l *Layout) Index(d Descriptor) (*Index, error) {
+	index := &Index{}
+	return index, l.readJSON(d, index)
+}
+
+// Manifest reads the image manifest of descriptor
+func (l *Layout) Manifest(d Descriptor) (*Manifest, error) {
+	manifest := &Manifest{}
+	return manifest, l.readJSON(d, manifest)
+}
+
+func (l *Layout) readJSON(d Descriptor, v any) error {
+	data, err := os.ReadFile(l.blobPath(d.Digest))
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.Digest, err)
+	}
+	return nil
+}
+
+func (l *Layout) blobPath(digest string) string {
+	return filepath.Join(l.blobsDir, strings.TrimPrefix(digest, "sha256:"))
+}
+
+// OpenBlob opens the blob of digest, either sha256:<hex> or <hex>
+func (l *Layout) OpenBlob(digest string) (*os.File, error) {
+	return os.Open(l.blobPath(digest))
+}
+
+// Put copies the image tagged tag of src into the layout. When the tag already exists,
+// the manifests of the platforms not provided by src are kept in the new image index,
+// so that the platforms of a package can be put one by one.
+func (l *Layout) Put(ctx context.Context, src *Layout, tag string) error {
+	srcDescriptor, err := src.Resolve(tag)
+	if err != nil {
+		return err
+	}
+	srcIndex, err := src.Index(srcDescriptor)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(l.blobsDir, 0775)
+	if err != nil {
+		return err
+	}
+	_, err = writeJSON(l.rootDir, &ImageLayout{Version: ImageLayoutVersion}, "oci-layout")
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src.blobsDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		dst := filepath.Join(l.blobsDir, entry.Name())
+		if util.FileExist(dst) {
+			continue
+		}
+		err = util.CopyFile(filepath.Join(src.blobsDir, entry.Name()), dst)
+		if err != nil {
+			return err
+		}
+	}
+	indexJSON, err := l.readIndexJSON()
+	if err != nil {
+		return err
+	}
+	descriptor := srcDescriptor
+	i := slices.IndexFunc(indexJSON.Manifests, func(d Descriptor) bool {
+		return d.Annotations[AnnotationRefName] == tag
+	})
+	if i >= 0 {
+		oldIndex, err := l.Index(indexJSON.Manifests[i])
+		if err != nil {
+			return err
+		}
+		merged := *srcIndex
+		merged.Manifests = slices.Clone(srcIndex.Manifests)
+		for _, m := range oldIndex.Manifests {
+			if !slices.ContainsFunc(srcIndex.Manifests, func(d Descriptor) bool { return samePlatform(d.Platform, m.Platform) }) {
+				merged.Manifests = append(merged.Manifests, m)
+			}
+		}
+		written, err := writeJSON(l.blobsDir, &merged, "")
+		if err != nil {
+			return err
+		}
+		descriptor.Digest = written.Digest
+		descriptor.Size = written.Size
+		indexJSON.Manifests[i] = descriptor
+	} else {
+		indexJSON.Manifests = append(indexJSON.Manifests, descriptor)
+	}
+	_, err = writeJSON(l.rootDir, indexJSON, "index.json")
+	return err
+}
+
+func samePlatform(a, b *Platform) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
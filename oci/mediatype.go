@@ -0,0 +1,21 @@
+package oci
+
+const (
+	MediaTypeImageIndex     = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeImageConfig    = "application/vnd.oci.image.config.v1+json"
+	MediaTypeImageLayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+	// MediaTypeEmptyJSON is the config media type of artifact manifests, see
+	// https://github.com/opencontainers/image-spec/blob/main/manifest.md#guidance-for-an-empty-descriptor
+	MediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
+
+	// ArtifactTypePackage is the default artifactType of package artifact manifests
+	ArtifactTypePackage = "application/vnd.pkgforge.package.v1"
+	// MediaTypePackageLayerGzip is the layer media type of package artifact manifests
+	MediaTypePackageLayerGzip = "application/vnd.pkgforge.package.layer.v1.tar+gzip"
+	// MediaTypeFile is the layer media type of single files added with WithFiles
+	MediaTypeFile = "application/octet-stream"
+)
+
+// emptyJSON is the content of the empty descriptor
+var emptyJSON = []byte("{}")
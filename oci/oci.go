@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/akkuman/blob-uploader/pkg/util"
 )
@@ -15,6 +18,7 @@ import (
 type OCI struct {
 	rootDir string
 	blobsDir string
+	keep bool
 }
 
 func NewOCI() *OCI {
@@ -33,35 +37,134 @@ func NewOCI() *OCI {
 	}
 }
 
+// NewOCIWithRootDir builds the layout in rootDir instead of a temp dir,
+// the layout is kept by Close so that it can be inspected
+func NewOCIWithRootDir(rootDir string) (*OCI, error) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", rootDir)
+	}
+	blobsDir := filepath.Join(rootDir, "blobs/sha256")
+	err = os.MkdirAll(blobsDir, 0775)
+	if err != nil {
+		return nil, err
+	}
+	return &OCI{
+		rootDir:  rootDir,
+		blobsDir: blobsDir,
+		keep:     true,
+	}, nil
+}
+
 func (s *OCI) GetRootDir() string {
 	return s.rootDir
 }
 
 func (s *OCI) Close() error {
+	if s.keep {
+		return nil
+	}
 	return os.RemoveAll(s.rootDir)
 }
 
-func (s *OCI) writeMap(ctx context.Context, dir string, data map[string]any, filename string) (newFName string, fileLen int, err error) {
+// Document is a document or a blob of the layout
+type Document struct {
+	// Kind is one of index, manifest, config and layer
+	Kind       string
+	Descriptor Descriptor
+	// Data is the JSON content, it is not set for layers
+	Data []byte
+}
+
+// Documents returns the documents of the built layout, starting from the image index referenced by index.json
+func (s *OCI) Documents() ([]Document, error) {
+	data, err := os.ReadFile(filepath.Join(s.rootDir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	indexJSON := &Index{}
+	err = json.Unmarshal(data, indexJSON)
+	if err != nil {
+		return nil, err
+	}
+	var documents []Document
+	for _, indexDescriptor := range indexJSON.Manifests {
+		index := &Index{}
+		documents, err = s.appendDocument(documents, "index", indexDescriptor, index)
+		if err != nil {
+			return nil, err
+		}
+		for _, manifestDescriptor := range index.Manifests {
+			manifest := &Manifest{}
+			documents, err = s.appendDocument(documents, "manifest", manifestDescriptor, manifest)
+			if err != nil {
+				return nil, err
+			}
+			documents, err = s.appendDocument(documents, "config", manifest.Config, nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, layer := range manifest.Layers {
+				documents = append(documents, Document{Kind: "layer", Descriptor: layer})
+			}
+		}
+	}
+	return documents, nil
+}
+
+func (s *OCI) appendDocument(documents []Document, kind string, descriptor Descriptor, v any) ([]Document, error) {
+	data, err := os.ReadFile(filepath.Join(s.blobsDir, strings.TrimPrefix(descriptor.Digest, "sha256:")))
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		err = json.Unmarshal(data, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", kind, descriptor.Digest, err)
+		}
+	}
+	return append(documents, Document{Kind: kind, Descriptor: descriptor, Data: data}), nil
+}
+
+// validator is implemented by every document of the layout
+type validator interface {
+	Validate() error
+}
+
+func (s *OCI) writeJSON(ctx context.Context, dir string, data validator, filename string) (descriptor Descriptor, err error) {
+	return writeJSON(dir, data, filename)
+}
+
+// writeJSON validates and writes the document data, if filename is blank, the file is named after its sha256
+func writeJSON(dir string, data validator, filename string) (descriptor Descriptor, err error) {
+	err = data.Validate()
+	if err != nil {
+		return
+	}
 	var jsonBytes []byte
 	jsonBytes, err = json.Marshal(data)
 	if err != nil {
 		return
 	}
+	hexdigest, err := util.GetSHA256(bytes.NewReader(jsonBytes))
+	if err != nil {
+		return
+	}
 	if filename == "" {
-		filename, err = util.GetSHA256(bytes.NewReader(jsonBytes))
-		if err != nil {
-			return
-		}
+		filename = hexdigest
 	}
 	err = os.WriteFile(filepath.Join(dir, filename), jsonBytes, 0664)
-	return filename, len(jsonBytes), err
+	return Descriptor{
+		Digest: fmt.Sprintf("sha256:%s", hexdigest),
+		Size:   int64(len(jsonBytes)),
+	}, err
 }
 
 func (s *OCI) writeImageLayout(ctx context.Context) error {
-	data := map[string]any {
-		"imageLayoutVersion": "1.0.0",
-	}
-	_, _, err := s.writeMap(ctx, s.rootDir, data, "oci-layout")
+	_, err := s.writeJSON(ctx, s.rootDir, &ImageLayout{Version: ImageLayoutVersion}, "oci-layout")
 	return err
 }
 
@@ -74,109 +177,181 @@ func (s *OCI) writeBlobs(ctx context.Context, blobFilepath string) (hexdigest st
 	return
 }
 
-func (s *OCI) writeImageConfig(ctx context.Context, baseMap map[string]any, tarSHA256 string) (jsonSHA256 string, jsonSize int, err error) {
-	dstMap := map[string]any{
-		"rootfs": map[string]any{
-			"type": "layers",
-			"diff_ids": []string{
-				fmt.Sprintf("sha256:%s", tarSHA256),
-			},
+func (s *OCI) writeImageConfig(ctx context.Context, platform Platform, diffIDs []string) (Descriptor, error) {
+	config := &ImageConfig{
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		RootFS: RootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
 		},
 	}
-	maps.Copy(dstMap, baseMap)
-	return s.writeMap(ctx, s.blobsDir, dstMap, "")
+	descriptor, err := s.writeJSON(ctx, s.blobsDir, config, "")
+	descriptor.MediaType = MediaTypeImageConfig
+	return descriptor, err
 }
 
-func (s *OCI) writeImageIndex(ctx context.Context, manifests []map[string]any, annotations map[string]any) (jsonSHA256 string, jsonSize int, err error) {
-	imageIndex := map[string]any{
-		"schemaVersion": 2,
-		"manifests":     manifests,
-		"annotations":   annotations,
+// writeLayers writes the tar.gz package (if any) and the extra files as layers,
+// diffIDs are the digests of the uncompressed tar layers used by image configs, the files aren't tar layers
+func (s *OCI) writeLayers(ctx context.Context, targzFilePath string, opt *buildOptions) (layers []Descriptor, diffIDs []string, err error) {
+	if targzFilePath != "" {
+		mediaType := MediaTypeImageLayerGzip
+		if opt.artifactType != "" {
+			mediaType = MediaTypePackageLayerGzip
+		}
+		var layer Descriptor
+		layer, err = s.writeLayer(ctx, targzFilePath, mediaType)
+		if err != nil {
+			return
+		}
+		var tarSHA256 string
+		if opt.artifactType == "" {
+			tarSHA256, err = util.GetTarSHA256FromGz(targzFilePath)
+			if err != nil {
+				return
+			}
+		}
+		layers = append(layers, layer)
+		diffIDs = append(diffIDs, fmt.Sprintf("sha256:%s", tarSHA256))
 	}
-	return s.writeMap(ctx, s.blobsDir, imageIndex, "")
+	titles := make(map[string]bool)
+	for _, filePath := range opt.files {
+		title := filepath.Base(filePath)
+		if titles[title] {
+			err = fmt.Errorf("duplicate file name %s", title)
+			return
+		}
+		titles[title] = true
+		var layer Descriptor
+		layer, err = s.writeLayer(ctx, filePath, MediaTypeFile)
+		if err != nil {
+			return
+		}
+		layer.Annotations = map[string]string{
+			AnnotationTitle: title,
+		}
+		layers = append(layers, layer)
+	}
+	if len(layers) == 0 {
+		err = fmt.Errorf("nothing to build, no tar.gz file nor extra files")
+	}
+	return
 }
 
-func (s *OCI) writeIndexJSON(ctx context.Context, indexJSONSHA256 string, indexJSONSize int, annotations map[string]any) error {
-	indexJSON := map[string]any{
-		"schemaVersion": 2,
-		"manifests": []map[string]any{{
-			"mediaType":   "application/vnd.oci.image.index.v1+json",
-			"digest":      fmt.Sprintf("sha256:%s", indexJSONSHA256),
-			"size":        indexJSONSize,
-			"annotations": annotations,
-		}},
+func (s *OCI) writeLayer(ctx context.Context, filePath string, mediaType string) (Descriptor, error) {
+	hexdigest, err := s.writeBlobs(ctx, filePath)
+	if err != nil {
+		return Descriptor{}, err
 	}
-	_, _, err := s.writeMap(ctx, s.rootDir, indexJSON, "index.json")
-	return err
+	size, err := util.GetFileSize(filePath)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return Descriptor{
+		MediaType: mediaType,
+		Digest:    fmt.Sprintf("sha256:%s", hexdigest),
+		Size:      size,
+	}, nil
 }
 
-func (s *OCI) BuildOCI(ctx context.Context, platform util.Platform, targzFilePath string, tagVersion string, imageSource string) (err error) {
-	err = s.writeImageLayout(ctx)
+// writeEmptyConfig writes the empty JSON blob used as config of artifact manifests
+func (s *OCI) writeEmptyConfig(ctx context.Context) (Descriptor, error) {
+	hexdigest, err := util.GetSHA256(bytes.NewReader(emptyJSON))
 	if err != nil {
-		return
+		return Descriptor{}, err
 	}
-	var targzSHA256 string
-	targzSHA256, err = s.writeBlobs(ctx, targzFilePath)
+	err = os.WriteFile(filepath.Join(s.blobsDir, hexdigest), emptyJSON, 0664)
 	if err != nil {
-		return
+		return Descriptor{}, err
+	}
+	return Descriptor{
+		MediaType: MediaTypeEmptyJSON,
+		Digest:    fmt.Sprintf("sha256:%s", hexdigest),
+		Size:      int64(len(emptyJSON)),
+		Data:      emptyJSON,
+	}, nil
+}
+
+func (s *OCI) writeImageIndex(ctx context.Context, manifests []Descriptor, annotations map[string]string) (Descriptor, error) {
+	imageIndex := &Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageIndex,
+		Manifests:     manifests,
+		Annotations:   annotations,
+	}
+	descriptor, err := s.writeJSON(ctx, s.blobsDir, imageIndex, "")
+	descriptor.MediaType = MediaTypeImageIndex
+	return descriptor, err
+}
+
+func (s *OCI) writeIndexJSON(ctx context.Context, imageIndex Descriptor) error {
+	indexJSON := &Index{
+		SchemaVersion: 2,
+		Manifests:     []Descriptor{imageIndex},
+	}
+	_, err := s.writeJSON(ctx, s.rootDir, indexJSON, "index.json")
+	return err
+}
+
+func (s *OCI) BuildOCI(ctx context.Context, platform util.Platform, targzFilePath string, tagVersion string, imageSource string, opts ...BuildOption) (err error) {
+	opt := &buildOptions{}
+	for _, o := range opts {
+		o(opt)
 	}
-	platformMap := map[string]any{
-		"architecture": platform.Arch,
-		"os":           platform.OS,
+	if len(opt.files) > 0 && opt.artifactType == "" {
+		// the files are raw blobs which runtimes can't unpack, such a package can't be an image
+		opt.artifactType = ArtifactTypePackage
 	}
-	var tarSHA256 string
-	tarSHA256, err = util.GetTarSHA256FromGz(targzFilePath)
+	err = s.writeImageLayout(ctx)
 	if err != nil {
 		return
 	}
-	var jsonSHA256 string
-	var jsonSize int
-	jsonSHA256, jsonSize, err = s.writeImageConfig(ctx, platformMap, tarSHA256)
+	ociPlatform := Platform{
+		Architecture: platform.Arch,
+		OS:           platform.OS,
+	}
+	layers, diffIDs, err := s.writeLayers(ctx, targzFilePath, opt)
 	if err != nil {
 		return
 	}
-	blobFileSize, err := util.GetFileSize(targzFilePath)
+	var config Descriptor
+	if opt.artifactType == "" {
+		config, err = s.writeImageConfig(ctx, ociPlatform, diffIDs)
+	} else {
+		config, err = s.writeEmptyConfig(ctx)
+	}
 	if err != nil {
 		return
 	}
-	annotations := map[string]any{
-		"com.github.package.type": "pkgforge_package",
-		"org.opencontainers.image.source": imageSource,
-		"dev.pkgforge.bin.digest": targzSHA256,
-	}
-	imageManifest := map[string]any{
-		"schemaVersion": 2,
-		"config": map[string]any{
-			"mediaType": "application/vnd.oci.image.config.v1+json",
-			"digest":    fmt.Sprintf("sha256:%s", jsonSHA256),
-			"size":      jsonSize,
-		},
-		"layers": []any{
-			map[string]any{
-				"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
-				"digest":    fmt.Sprintf("sha256:%s", targzSHA256),
-				"size":      blobFileSize,
-			},
-		},
-		"annotations": annotations,
+	annotations := StandardAnnotations(tagVersion, imageSource, time.Now())
+	maps.Copy(annotations, opt.annotations)
+	if targzFilePath != "" {
+		annotations[AnnotationBinDigest] = strings.TrimPrefix(layers[0].Digest, "sha256:")
+	}
+	imageManifest := &Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		ArtifactType:  opt.artifactType,
+		Config:        config,
+		Layers:        layers,
+		Annotations:   annotations,
 	}
-	manifestJSONSHA256, manifestJSONSize, err := s.writeMap(ctx, s.blobsDir, imageManifest, "")
+	manifest, err := s.writeJSON(ctx, s.blobsDir, imageManifest, "")
 	if err != nil {
 		return err
 	}
-	manifest := map[string]any{
-		"mediaType":   "application/vnd.oci.image.manifest.v1+json",
-		"digest":      fmt.Sprintf("sha256:%s", manifestJSONSHA256),
-		"size":        manifestJSONSize,
-		"platform":    platformMap,
-		"annotations": annotations,
-	}
-	indexJSONSHA256, indexJSONSize, err := s.writeImageIndex(ctx, []map[string]any{manifest}, annotations)
+	manifest.MediaType = MediaTypeImageManifest
+	manifest.ArtifactType = opt.artifactType
+	manifest.Platform = &ociPlatform
+	manifest.Annotations = annotations
+	imageIndex, err := s.writeImageIndex(ctx, []Descriptor{manifest}, annotations)
 	if err != nil {
 		return err
 	}
-	err = s.writeIndexJSON(ctx, indexJSONSHA256, indexJSONSize, map[string]any{
-		"org.opencontainers.image.ref.name": "latest",
-	})
-	return err
+	if tagVersion == "" {
+		tagVersion = "latest"
+	}
+	imageIndex.Annotations = maps.Clone(annotations)
+	imageIndex.Annotations[AnnotationRefName] = tagVersion
+	return s.writeIndexJSON(ctx, imageIndex)
 }
@@ -0,0 +1,184 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/pkg/util"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+const testCreated = "2024-01-01T00:00:00Z"
+
+// testTarGz is checked in rather than written at test time, so that the digests of the golden files
+// don't depend on the output of compress/gzip, which may change across Go releases
+const testTarGz = "testdata/hello.tar.gz"
+
+// dumpLayout renders the documents of the layout at rootDir by following index.json
+func dumpLayout(t *testing.T, rootDir string) string {
+	var sb strings.Builder
+	dump := func(name string, data []byte) {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, data, "", "  "); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		fmt.Fprintf(&sb, "== %s ==\n%s\n", name, pretty.String())
+	}
+	readBlob := func(d Descriptor) []byte {
+		hexdigest := strings.TrimPrefix(d.Digest, "sha256:")
+		data, err := os.ReadFile(filepath.Join(rootDir, "blobs/sha256", hexdigest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(data)) != d.Size {
+			t.Errorf("size of %s is %d, descriptor says %d", d.Digest, len(data), d.Size)
+		}
+		if got, _ := util.GetSHA256(bytes.NewReader(data)); got != hexdigest {
+			t.Errorf("blob %s has digest sha256:%s", d.Digest, got)
+		}
+		return data
+	}
+	for _, name := range []string{"oci-layout", "index.json"} {
+		data, err := os.ReadFile(filepath.Join(rootDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump(name, data)
+	}
+	indexJSON := &Index{}
+	data, _ := os.ReadFile(filepath.Join(rootDir, "index.json"))
+	json.Unmarshal(data, indexJSON)
+	for _, indexDesc := range indexJSON.Manifests {
+		data := readBlob(indexDesc)
+		dump("index "+indexDesc.Digest, data)
+		index := &Index{}
+		json.Unmarshal(data, index)
+		for _, manifestDesc := range index.Manifests {
+			data := readBlob(manifestDesc)
+			dump("manifest "+manifestDesc.Digest, data)
+			manifest := &Manifest{}
+			json.Unmarshal(data, manifest)
+			dump("config "+manifest.Config.Digest, readBlob(manifest.Config))
+			for _, layer := range manifest.Layers {
+				readBlob(layer)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func TestBuildOCIGolden(t *testing.T) {
+	extraFile := filepath.Join(t.TempDir(), "hello.1")
+	if err := os.WriteFile(extraFile, []byte(".TH HELLO 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []struct {
+		name    string
+		withTgz bool
+		opts    []BuildOption
+	}{
+		{"image", true, nil},
+		{"artifact", true, []BuildOption{WithArtifactType(ArtifactTypePackage)}},
+		{"files", true, []BuildOption{WithFiles(extraFile)}},
+		{"files-only", false, []BuildOption{WithFiles(extraFile)}},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			var targzFilePath string
+			if x.withTgz {
+				targzFilePath = testTarGz
+			}
+			o := NewOCI()
+			defer o.Close()
+			opts := append([]BuildOption{WithAnnotations(map[string]string{
+				AnnotationCreated: testCreated,
+			})}, x.opts...)
+			err := o.BuildOCI(context.Background(), util.DefaultPlatform, targzFilePath, "1.2.0", "https://github.com/akkuman/blob-uploader", opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := dumpLayout(t, o.GetRootDir())
+			goldenPath := filepath.Join("testdata", x.name+".golden")
+			if *update {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("layout differs from %s, run go test ./oci -update to update it\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+func TestBuildOCIRefName(t *testing.T) {
+	o := NewOCI()
+	defer o.Close()
+	err := o.BuildOCI(context.Background(), util.DefaultPlatform, testTarGz, "2.0.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(o.GetRootDir(), "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexJSON := &Index{}
+	if err := json.Unmarshal(data, indexJSON); err != nil {
+		t.Fatal(err)
+	}
+	if refName := indexJSON.Manifests[0].Annotations[AnnotationRefName]; refName != "2.0.1" {
+		t.Errorf("%s != 2.0.1", refName)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	validDigest := "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	validLayer := Descriptor{MediaType: MediaTypeImageLayerGzip, Digest: validDigest, Size: 2}
+	for _, x := range []struct {
+		name string
+		doc  validator
+	}{
+		{"media type", &Descriptor{MediaType: "application-json", Digest: validDigest}},
+		{"digest", &Descriptor{MediaType: MediaTypeImageLayerGzip, Digest: "sha256:abc"}},
+		{"data", &Descriptor{MediaType: MediaTypeEmptyJSON, Digest: validDigest, Size: 2, Data: []byte("[]")}},
+		{"created", &Index{SchemaVersion: 2, Annotations: map[string]string{AnnotationCreated: "yesterday"}}},
+		{"schema version", &Index{SchemaVersion: 1}},
+		{"artifact type", &Manifest{
+			SchemaVersion: 2,
+			Config:        Descriptor{MediaType: MediaTypeEmptyJSON, Digest: validDigest, Size: 2},
+			Layers:        []Descriptor{validLayer},
+		}},
+		{"no layers", &Manifest{
+			SchemaVersion: 2,
+			Config:        Descriptor{MediaType: MediaTypeImageConfig, Digest: validDigest, Size: 2},
+		}},
+		{"rootfs", &ImageConfig{Architecture: "amd64", OS: "linux"}},
+		{"layout", &ImageLayout{Version: "2.0.0"}},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			if err := x.doc.Validate(); err == nil {
+				t.Error("Validate must fail")
+			}
+		})
+	}
+	valid := &Manifest{
+		SchemaVersion: 2,
+		ArtifactType:  ArtifactTypePackage,
+		Config:        Descriptor{MediaType: MediaTypeEmptyJSON, Digest: validDigest, Size: 2, Data: emptyJSON},
+		Layers:        []Descriptor{validLayer},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,39 @@
+package oci
+
+type buildOptions struct {
+	annotations  map[string]string
+	artifactType string
+	files        []string
+}
+
+type BuildOption func(*buildOptions)
+
+// WithAnnotations adds annotations to the manifest, the index and the index.json descriptors,
+// they take precedence over StandardAnnotations
+func WithAnnotations(annotations map[string]string) BuildOption {
+	return func(o *buildOptions) {
+		if o.annotations == nil {
+			o.annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			o.annotations[k] = v
+		}
+	}
+}
+
+// WithArtifactType builds an OCI 1.1 artifact manifest with the given artifactType,
+// an empty config and typed layers instead of an image manifest
+func WithArtifactType(artifactType string) BuildOption {
+	return func(o *buildOptions) {
+		o.artifactType = artifactType
+	}
+}
+
+// WithFiles adds every file as a separate layer, the file name is stored in the
+// org.opencontainers.image.title annotation of the layer. A package with files is built
+// as an artifact manifest, of ArtifactTypePackage unless WithArtifactType is given
+func WithFiles(filePaths ...string) BuildOption {
+	return func(o *buildOptions) {
+		o.files = append(o.files, filePaths...)
+	}
+}
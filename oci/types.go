@@ -0,0 +1,206 @@
+package oci
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/util"
+)
+
+// The types below follow https://github.com/opencontainers/image-spec/tree/v1.1.0,
+// only the fields used by this tool are declared.
+
+// ImageLayoutVersion is the version of the oci-layout file
+const ImageLayoutVersion = "1.0.0"
+
+var (
+	// https://github.com/opencontainers/image-spec/blob/v1.1.0/descriptor.md#registered-algorithms
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	// https://datatracker.ietf.org/doc/html/rfc6838#section-4.2
+	mediaTypeRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}/[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}$`)
+)
+
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Data         []byte            `json:"data,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ImageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	RootFS       RootFS `json:"rootfs"`
+}
+
+type ImageLayout struct {
+	Version string `json:"imageLayoutVersion"`
+}
+
+func validateMediaType(mediaType string) error {
+	if !mediaTypeRegexp.MatchString(mediaType) {
+		return fmt.Errorf("invalid media type %q", mediaType)
+	}
+	return nil
+}
+
+func validateAnnotations(annotations map[string]string) error {
+	for k, v := range annotations {
+		if k == "" {
+			return fmt.Errorf("empty annotation key")
+		}
+		if k == AnnotationCreated {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return fmt.Errorf("annotation %s must be RFC 3339: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Descriptor) Validate() error {
+	if err := validateMediaType(d.MediaType); err != nil {
+		return err
+	}
+	if d.ArtifactType != "" {
+		if err := validateMediaType(d.ArtifactType); err != nil {
+			return fmt.Errorf("artifactType: %w", err)
+		}
+	}
+	if !digestRegexp.MatchString(d.Digest) {
+		return fmt.Errorf("invalid digest %q", d.Digest)
+	}
+	if d.Size < 0 {
+		return fmt.Errorf("%s: negative size", d.Digest)
+	}
+	if d.Data != nil {
+		if int64(len(d.Data)) != d.Size {
+			return fmt.Errorf("%s: size of data %d != %d", d.Digest, len(d.Data), d.Size)
+		}
+		hexdigest, err := util.GetSHA256(bytes.NewReader(d.Data))
+		if err != nil {
+			return err
+		}
+		if d.Digest != "sha256:"+hexdigest {
+			return fmt.Errorf("%s: digest of data is sha256:%s", d.Digest, hexdigest)
+		}
+	}
+	if d.Platform != nil && (d.Platform.OS == "" || d.Platform.Architecture == "") {
+		return fmt.Errorf("%s: platform requires os and architecture", d.Digest)
+	}
+	if err := validateAnnotations(d.Annotations); err != nil {
+		return fmt.Errorf("%s: %w", d.Digest, err)
+	}
+	return nil
+}
+
+func (m *Manifest) Validate() error {
+	if m.SchemaVersion != 2 {
+		return fmt.Errorf("manifest: schemaVersion must be 2")
+	}
+	if m.MediaType != "" && m.MediaType != MediaTypeImageManifest {
+		return fmt.Errorf("manifest: mediaType must be %s", MediaTypeImageManifest)
+	}
+	if err := m.Config.Validate(); err != nil {
+		return fmt.Errorf("manifest config: %w", err)
+	}
+	// https://github.com/opencontainers/image-spec/blob/v1.1.0/manifest.md#image-manifest-property-descriptions
+	if m.Config.MediaType == MediaTypeEmptyJSON && m.ArtifactType == "" {
+		return fmt.Errorf("manifest: artifactType must be set when the config is empty")
+	}
+	if m.ArtifactType != "" {
+		if err := validateMediaType(m.ArtifactType); err != nil {
+			return fmt.Errorf("manifest artifactType: %w", err)
+		}
+	}
+	if len(m.Layers) == 0 {
+		return fmt.Errorf("manifest: no layers")
+	}
+	for i := range m.Layers {
+		if err := m.Layers[i].Validate(); err != nil {
+			return fmt.Errorf("manifest layer %d: %w", i, err)
+		}
+	}
+	if m.Subject != nil {
+		if err := m.Subject.Validate(); err != nil {
+			return fmt.Errorf("manifest subject: %w", err)
+		}
+	}
+	return validateAnnotations(m.Annotations)
+}
+
+func (idx *Index) Validate() error {
+	if idx.SchemaVersion != 2 {
+		return fmt.Errorf("index: schemaVersion must be 2")
+	}
+	if idx.MediaType != "" && idx.MediaType != MediaTypeImageIndex {
+		return fmt.Errorf("index: mediaType must be %s", MediaTypeImageIndex)
+	}
+	for i := range idx.Manifests {
+		if err := idx.Manifests[i].Validate(); err != nil {
+			return fmt.Errorf("index manifest %d: %w", i, err)
+		}
+	}
+	if idx.Subject != nil {
+		if err := idx.Subject.Validate(); err != nil {
+			return fmt.Errorf("index subject: %w", err)
+		}
+	}
+	return validateAnnotations(idx.Annotations)
+}
+
+func (c *ImageConfig) Validate() error {
+	if c.Architecture == "" || c.OS == "" {
+		return fmt.Errorf("config: architecture and os are required")
+	}
+	if c.RootFS.Type != "layers" {
+		return fmt.Errorf("config: rootfs.type must be layers")
+	}
+	for _, diffID := range c.RootFS.DiffIDs {
+		if !digestRegexp.MatchString(diffID) {
+			return fmt.Errorf("config: invalid diff_id %q", diffID)
+		}
+	}
+	return nil
+}
+
+func (l *ImageLayout) Validate() error {
+	if l.Version != ImageLayoutVersion {
+		return fmt.Errorf("oci-layout: imageLayoutVersion must be %s", ImageLayoutVersion)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNotGzip   = errors.New("not a gzip file")
+	ErrTruncated = errors.New("archive is truncated")
+)
+
+// Walk reads every entry of the tar.gz file at filePath and calls fn for each of them.
+// The reader passed to fn is only valid until fn returns.
+// The gzip stream is read to its end, so a bad checksum or trailing garbage is reported too.
+func Walk(filePath string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		if errors.Is(err, gzip.ErrHeader) || errors.Is(err, io.EOF) {
+			return ErrNotGzip
+		}
+		return wrapReadError(err)
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return wrapReadError(err)
+		}
+		err = fn(hdr, tarReader)
+		if err != nil {
+			return wrapReadError(err)
+		}
+	}
+	// consume the tar padding and the gzip trailer so that the CRC is checked
+	_, err = io.Copy(io.Discard, gzipReader)
+	return wrapReadError(err)
+}
+
+func wrapReadError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	return err
+}
+
+// Report is the result of Validate
+type Report struct {
+	Size        int64
+	Entries     int
+	Executables int
+	Problems    []string
+}
+
+// OK reports whether the archive passed every check
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("%d bytes, %d entries, %d executables", r.Size, r.Entries, r.Executables)
+}
+
+func (r *Report) addProblem(format string, a ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, a...))
+}
+
+// Validate checks that filePath is a complete tar.gz archive which is safe to be extracted.
+// Structural errors and unsafe entries are collected into Report.Problems,
+// the returned error is only set when the file cannot be read at all.
+func Validate(filePath string) (*Report, error) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Size: fi.Size(),
+	}
+	err = Walk(filePath, func(hdr *tar.Header, r io.Reader) error {
+		report.Entries++
+		checkEntry(report, hdr)
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			return nil, err
+		}
+		report.addProblem("invalid archive: %v", err)
+		return report, nil
+	}
+	if report.Entries == 0 {
+		report.addProblem("archive is empty")
+	}
+	return report, nil
+}
+
+func checkEntry(report *Report, hdr *tar.Header) {
+	if IsUnsafePath(hdr.Name) {
+		report.addProblem("%s: absolute path or path traversal", hdr.Name)
+	}
+	switch hdr.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		report.addProblem("%s: device or fifo entry", hdr.Name)
+	case tar.TypeSymlink:
+		target := hdr.Linkname
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(hdr.Name), target)
+		}
+		if IsUnsafePath(target) {
+			report.addProblem("%s: symlink points outside of the archive (%s)", hdr.Name, hdr.Linkname)
+		}
+	case tar.TypeLink:
+		if IsUnsafePath(hdr.Linkname) {
+			report.addProblem("%s: hardlink points outside of the archive (%s)", hdr.Name, hdr.Linkname)
+		}
+	case tar.TypeReg:
+		if hdr.Mode&0111 != 0 {
+			report.Executables++
+		}
+	}
+}
+
+// IsUnsafePath reports whether name is absolute or escapes the extraction directory
+func IsUnsafePath(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) || (len(name) > 1 && name[1] == ':') {
+		return true
+	}
+	cleaned := path.Clean(name)
+	return cleaned == ".." || strings.HasPrefix(cleaned, "../")
+}
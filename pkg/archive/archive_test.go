@@ -0,0 +1,116 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+func writeTarGz(t *testing.T, entries []testEntry) string {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return writeFile(t, buf.Bytes())
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	p := filepath.Join(t.TempDir(), "test.tar.gz")
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestValidate(t *testing.T) {
+	valid := writeTarGz(t, []testEntry{
+		{tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "bin/wget", Typeflag: tar.TypeReg, Mode: 0755}, "binary"},
+		{tar.Header{Name: "README", Typeflag: tar.TypeReg, Mode: 0644}, "readme"},
+		{tar.Header{Name: "bin/wget2", Typeflag: tar.TypeSymlink, Linkname: "wget"}, ""},
+	})
+	validData, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []struct {
+		name    string
+		path    string
+		problem string
+	}{
+		{"valid", valid, ""},
+		{"empty", writeTarGz(t, nil), "archive is empty"},
+		{"not gzip", writeFile(t, []byte("hello world")), ErrNotGzip.Error()},
+		{"truncated", writeFile(t, validData[:len(validData)-10]), ErrTruncated.Error()},
+		{"absolute", writeTarGz(t, []testEntry{
+			{tar.Header{Name: "/etc/passwd", Typeflag: tar.TypeReg, Mode: 0644}, "root"},
+		}), "absolute path or path traversal"},
+		{"traversal", writeTarGz(t, []testEntry{
+			{tar.Header{Name: "bin/../../evil", Typeflag: tar.TypeReg, Mode: 0644}, "evil"},
+		}), "absolute path or path traversal"},
+		{"device", writeTarGz(t, []testEntry{
+			{tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0644}, ""},
+		}), "device or fifo entry"},
+		{"symlink", writeTarGz(t, []testEntry{
+			{tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "../../bin/sh"}, ""},
+		}), "symlink points outside"},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			report, err := Validate(x.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if x.problem == "" {
+				if !report.OK() {
+					t.Errorf("unexpected problems: %v", report.Problems)
+				}
+				return
+			}
+			if report.OK() || !strings.Contains(strings.Join(report.Problems, "\n"), x.problem) {
+				t.Errorf("problems %v must contain %q", report.Problems, x.problem)
+			}
+		})
+	}
+}
+
+func TestValidateReport(t *testing.T) {
+	p := writeTarGz(t, []testEntry{
+		{tar.Header{Name: "bin/wget", Typeflag: tar.TypeReg, Mode: 0755}, "binary"},
+		{tar.Header{Name: "bin/curl", Typeflag: tar.TypeReg, Mode: 0700}, "binary"},
+		{tar.Header{Name: "README", Typeflag: tar.TypeReg, Mode: 0644}, "readme"},
+	})
+	report, err := Validate(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entries != 3 {
+		t.Errorf("entries %d != 3", report.Entries)
+	}
+	if report.Executables != 2 {
+		t.Errorf("executables %d != 2", report.Executables)
+	}
+	fi, _ := os.Stat(p)
+	if report.Size != fi.Size() {
+		t.Errorf("size %d != %d", report.Size, fi.Size())
+	}
+}
@@ -0,0 +1,105 @@
+package compress
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/akkuman/blob-uploader/pkg/archive"
+)
+
+// TarDir writes the regular files of dir into an uncompressed tar, with names relative to dir
+func TarDir(dir string, out io.Writer) error {
+	tw := tar.NewWriter(out)
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == dir {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Untar extracts the directories and regular files of an uncompressed tar into dir
+func Untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if archive.IsUnsafePath(header.Name) {
+			return fmt.Errorf("unsafe path in tar: %s", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0775)
+		case tar.TypeReg:
+			err = writeFile(target, tr)
+		default:
+			err = fmt.Errorf("unsupported entry in tar: %s", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(target string, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(target), 0775)
+	if err != nil {
+		return err
+	}
+	w, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,91 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarDirUntar(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"index.json":                "{}",
+		"oci-layout":                `{"imageLayoutVersion":"1.0.0"}`,
+		"blobs/sha256/0123456789ab": "blob",
+	}
+	for name, body := range files {
+		filePath := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(body), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(src, "empty"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err := TarDir(src, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	err = Untar(&buf, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range files {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != body {
+			t.Errorf("%s: got %q, want %q", name, got, body)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory is not extracted: %v", err)
+	}
+}
+
+func TestUntarUnsafe(t *testing.T) {
+	for _, x := range []struct {
+		name   string
+		header tar.Header
+	}{
+		{"parent directory", tar.Header{Name: "../escaped", Typeflag: tar.TypeReg}},
+		{"nested parent directory", tar.Header{Name: "blobs/../../escaped", Typeflag: tar.TypeReg}},
+		{"absolute path", tar.Header{Name: "/tmp/escaped", Typeflag: tar.TypeReg}},
+		{"windows absolute path", tar.Header{Name: `C:\escaped`, Typeflag: tar.TypeReg}},
+		{"symlink", tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+		{"hard link", tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"}},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, header := range []tar.Header{x.header, {Name: "link/escaped", Typeflag: tar.TypeReg, Size: 4}} {
+				header.Mode = 0644
+				if err := tw.WriteHeader(&header); err != nil {
+					t.Fatal(err)
+				}
+				tw.Write(make([]byte, header.Size))
+			}
+			tw.Close()
+			root := t.TempDir()
+			dst := filepath.Join(root, "a", "b")
+			err := Untar(&buf, dst)
+			if err == nil {
+				t.Fatal("unsafe entry is extracted")
+			}
+			if _, err := os.Lstat(filepath.Join(root, "a", "escaped")); err == nil {
+				t.Error("a file is written outside of the destination")
+			}
+			if _, err := os.Lstat(filepath.Join(dst, "link")); err == nil {
+				t.Error("a link is created")
+			}
+		})
+	}
+}
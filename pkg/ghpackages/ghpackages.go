@@ -0,0 +1,251 @@
+// Package ghpackages is a client of the GitHub Packages REST API for container packages, see
+// https://docs.github.com/en/rest/packages/packages
+package ghpackages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the URL of the REST API of github.com
+const DefaultBaseURL = "https://api.github.com"
+
+// perPage is the page size of the listings, the maximum of the API
+const perPage = 100
+
+// ErrNotFound is returned when the API responds 404 for an owner, a package or a version
+var ErrNotFound = errors.New("not found")
+
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+
+	mu sync.Mutex
+	// ownerPaths caches the API path of each owner, orgs/<owner> or users/<owner>
+	ownerPaths map[string]string
+}
+
+type Option func(*Client)
+
+// WithBaseURL talks to another API than github.com, e.g. GitHub Enterprise Server or a fake for tests
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sends the requests with httpClient instead of http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client authenticated with token, a personal access token or a GITHUB_TOKEN
+// having the read:packages and delete:packages scopes
+func New(token string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    DefaultBaseURL,
+		token:      token,
+		httpClient: http.DefaultClient,
+		ownerPaths: make(map[string]string),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Version is a version of a container package, i.e. a manifest
+type Version struct {
+	ID int64 `json:"id"`
+	// Name is the digest of the manifest
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  struct {
+		Container struct {
+			Tags []string `json:"tags"`
+		} `json:"container"`
+	} `json:"metadata"`
+}
+
+// Tags returns the tags of the version
+func (v *Version) Tags() []string {
+	return v.Metadata.Container.Tags
+}
+
+// SplitRepository splits the repository of a ghcr.io ref into the owner and the package name,
+// e.g. example/tools/hello into example and tools/hello
+func SplitRepository(repository string) (owner string, name string, err error) {
+	owner, name, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || name == "" {
+		return "", "", fmt.Errorf("%q is not in the form of owner/package", repository)
+	}
+	return owner, name, nil
+}
+
+// do sends a request to the API path and decodes the JSON response into out unless it is nil
+func (c *Client) do(ctx context.Context, method string, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		json.Unmarshal(body, &apiErr)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%s %s: %w", method, path, ErrNotFound)
+		}
+		return fmt.Errorf("%s %s: status code: %d: %s", method, path, resp.StatusCode, apiErr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ownerPath returns the API path of owner, orgs/<owner> for organizations and users/<owner> for users
+func (c *Client) ownerPath(ctx context.Context, owner string) (string, error) {
+	c.mu.Lock()
+	p, ok := c.ownerPaths[owner]
+	c.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+	var account struct {
+		Type string `json:"type"`
+	}
+	err := c.do(ctx, http.MethodGet, "/users/"+url.PathEscape(owner), &account)
+	if err != nil {
+		return "", fmt.Errorf("get owner %s: %w", owner, err)
+	}
+	p = "/users/" + url.PathEscape(owner)
+	if account.Type == "Organization" {
+		p = "/orgs/" + url.PathEscape(owner)
+	}
+	c.mu.Lock()
+	c.ownerPaths[owner] = p
+	c.mu.Unlock()
+	return p, nil
+}
+
+// packagePath returns the API path of the container package name of owner
+func (c *Client) packagePath(ctx context.Context, owner string, name string) (string, error) {
+	p, err := c.ownerPath(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/packages/container/%s", p, url.PathEscape(name)), nil
+}
+
+// Versions lists the active versions of the container package name of owner, newest first
+func (c *Client) Versions(ctx context.Context, owner string, name string) ([]Version, error) {
+	return c.versions(ctx, owner, name, "active")
+}
+
+// DeletedVersions lists the deleted versions of the container package name of owner which can be restored,
+// versions can be restored within 30 days of their deletion
+func (c *Client) DeletedVersions(ctx context.Context, owner string, name string) ([]Version, error) {
+	return c.versions(ctx, owner, name, "deleted")
+}
+
+func (c *Client) versions(ctx context.Context, owner string, name string, state string) ([]Version, error) {
+	p, err := c.packagePath(ctx, owner, name)
+	if err != nil {
+		return nil, err
+	}
+	var versions []Version
+	for page := 1; ; page++ {
+		var batch []Version
+		err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/versions?state=%s&per_page=%d&page=%d", p, state, perPage, page), &batch)
+		if err != nil {
+			return nil, fmt.Errorf("list %s versions of %s/%s: %w", state, owner, name, err)
+		}
+		versions = append(versions, batch...)
+		if len(batch) < perPage {
+			return versions, nil
+		}
+	}
+}
+
+// DeleteVersion deletes the version id of the container package name of owner
+func (c *Client) DeleteVersion(ctx context.Context, owner string, name string, id int64) error {
+	p, err := c.packagePath(ctx, owner, name)
+	if err != nil {
+		return err
+	}
+	err = c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/versions/%d", p, id), nil)
+	if err != nil {
+		return fmt.Errorf("delete version %d of %s/%s: %w", id, owner, name, err)
+	}
+	return nil
+}
+
+// RestoreVersion restores the deleted version id of the container package name of owner
+func (c *Client) RestoreVersion(ctx context.Context, owner string, name string, id int64) error {
+	p, err := c.packagePath(ctx, owner, name)
+	if err != nil {
+		return err
+	}
+	err = c.do(ctx, http.MethodPost, fmt.Sprintf("%s/versions/%d/restore", p, id), nil)
+	if err != nil {
+		return fmt.Errorf("restore version %d of %s/%s: %w", id, owner, name, err)
+	}
+	return nil
+}
+
+// Package is a container package
+type Package struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Visibility   string    `json:"visibility"`
+	VersionCount int64     `json:"version_count"`
+	HTMLURL      string    `json:"html_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// Repository is the repository the package is linked to, nil when it isn't linked
+	Repository *Repository `json:"repository"`
+}
+
+// Repository is a GitHub repository
+type Repository struct {
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+}
+
+// Package returns the container package name of owner, with its visibility and the repository it is linked to
+func (c *Client) Package(ctx context.Context, owner string, name string) (*Package, error) {
+	p, err := c.packagePath(ctx, owner, name)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &Package{}
+	err = c.do(ctx, http.MethodGet, p, pkg)
+	if err != nil {
+		return nil, fmt.Errorf("get package %s/%s: %w", owner, name, err)
+	}
+	return pkg, nil
+}
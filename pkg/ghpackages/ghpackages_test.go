@@ -0,0 +1,171 @@
+package ghpackages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/ghpackages/ghpackagestest"
+)
+
+func TestVersions(t *testing.T) {
+	srv := ghpackagestest.New(t)
+	srv.Token = "secret"
+	srv.AddOrg("example")
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 150; i++ {
+		srv.AddVersion("example", "tools/hello", fmt.Sprintf("sha256:%064d", i), created.Add(time.Duration(i)*time.Hour), fmt.Sprintf("1.0.%d", i))
+	}
+	srv.AddVersion("akkuman", "hello", "sha256:"+fmt.Sprintf("%064d", 0), created)
+
+	ctx := context.Background()
+	c := New("secret", WithBaseURL(srv.URL))
+	for _, x := range []struct {
+		owner string
+		name  string
+		want  int
+	}{
+		{"example", "tools/hello", 150},
+		{"akkuman", "hello", 1},
+	} {
+		versions, err := c.Versions(ctx, x.owner, x.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(versions) != x.want {
+			t.Errorf("%s/%s: got %d versions, want %d", x.owner, x.name, len(versions), x.want)
+		}
+	}
+	versions, err := c.Versions(ctx, "example", "tools/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest := versions[0]
+	if newest.Tags()[0] != "1.0.149" || !newest.CreatedAt.Equal(created.Add(149*time.Hour)) {
+		t.Errorf("unexpected newest version %+v", newest)
+	}
+
+	err = c.DeleteVersion(ctx, "example", "tools/hello", newest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err = c.Versions(ctx, "example", "tools/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 149 || versions[0].ID == newest.ID {
+		t.Errorf("version %d is not deleted", newest.ID)
+	}
+	err = c.DeleteVersion(ctx, "example", "tools/hello", newest.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting twice: got %v, want not found", err)
+	}
+	_, err = c.Versions(ctx, "example", "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing package: got %v, want not found", err)
+	}
+	_, err = New("wrong", WithBaseURL(srv.URL)).Versions(ctx, "example", "tools/hello")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong token: got %v", err)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	srv := ghpackagestest.New(t)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	id := srv.AddVersion("akkuman", "hello", "sha256:"+fmt.Sprintf("%064d", 1), created, "1.0.0")
+	srv.AddVersion("akkuman", "hello", "sha256:"+fmt.Sprintf("%064d", 2), created.Add(time.Hour), "1.1.0")
+
+	ctx := context.Background()
+	c := New("", WithBaseURL(srv.URL))
+	err := c.RestoreVersion(ctx, "akkuman", "hello", id)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("restoring an active version: got %v, want not found", err)
+	}
+	err = c.DeleteVersion(ctx, "akkuman", "hello", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := c.DeletedVersions(ctx, "akkuman", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != id || deleted[0].Tags()[0] != "1.0.0" {
+		t.Fatalf("unexpected deleted versions %+v", deleted)
+	}
+	err = c.RestoreVersion(ctx, "akkuman", "hello", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := c.Versions(ctx, "akkuman", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("got %d versions after restoring, want 2", len(versions))
+	}
+	deleted, err = c.DeletedVersions(ctx, "akkuman", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("got %d deleted versions after restoring, want 0", len(deleted))
+	}
+}
+
+func TestPackage(t *testing.T) {
+	srv := ghpackagestest.New(t)
+	srv.AddOrg("example")
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv.AddVersion("example", "tools/hello", "sha256:"+fmt.Sprintf("%064d", 1), created, "1.0.0")
+	srv.SetPackage("example", "tools/hello", "public", "example/tools")
+	srv.AddVersion("akkuman", "hello", "sha256:"+fmt.Sprintf("%064d", 1), created, "1.0.0")
+
+	ctx := context.Background()
+	c := New("", WithBaseURL(srv.URL))
+	for _, x := range []struct {
+		owner      string
+		name       string
+		visibility string
+		repository string
+	}{
+		{"example", "tools/hello", "public", "example/tools"},
+		{"akkuman", "hello", "private", ""},
+	} {
+		pkg, err := c.Package(ctx, x.owner, x.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repository := ""
+		if pkg.Repository != nil {
+			repository = pkg.Repository.FullName
+		}
+		if pkg.Name != x.name || pkg.Visibility != x.visibility || repository != x.repository || pkg.VersionCount != 1 {
+			t.Errorf("%s/%s: unexpected package %+v", x.owner, x.name, pkg)
+		}
+	}
+	_, err := c.Package(ctx, "example", "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing package: got %v, want not found", err)
+	}
+}
+
+func TestSplitRepository(t *testing.T) {
+	for _, x := range []struct {
+		repository string
+		owner      string
+		name       string
+		ok         bool
+	}{
+		{"example/hello", "example", "hello", true},
+		{"example/tools/hello", "example", "tools/hello", true},
+		{"hello", "", "", false},
+	} {
+		owner, name, err := SplitRepository(x.repository)
+		if (err == nil) != x.ok || owner != x.owner || name != x.name {
+			t.Errorf("%s: got %s, %s, %v", x.repository, owner, name, err)
+		}
+	}
+}
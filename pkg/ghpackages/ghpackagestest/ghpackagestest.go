@@ -0,0 +1,233 @@
+// Package ghpackagestest runs an in-process fake of the GitHub Packages REST API for tests
+package ghpackagestest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Version is a package version held by the fake
+type Version struct {
+	ID      int64
+	Digest  string
+	Tags    []string
+	Created time.Time
+	Deleted bool
+}
+
+// Server is a fake of the GitHub Packages REST API serving the container packages of its owners
+type Server struct {
+	*httptest.Server
+	// Token is the token which the requests must carry, any token is accepted when blank
+	Token string
+
+	mu     sync.Mutex
+	orgs   map[string]bool
+	nextID int64
+	// packages maps owner/name to the versions of the package
+	packages map[string][]*Version
+	// settings maps owner/name to the visibility and the linked repository of the package
+	settings map[string]settings
+}
+
+type settings struct {
+	visibility string
+	repository string
+}
+
+// New starts a fake API, it is closed at the end of the test
+func New(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		orgs:     make(map[string]bool),
+		packages: make(map[string][]*Version),
+		settings: make(map[string]settings),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddOrg makes owner an organization, owners are users otherwise
+func (s *Server) AddOrg(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgs[owner] = true
+}
+
+// AddVersion adds a version of the package owner/name and returns its id
+func (s *Server) AddVersion(owner string, name string, digest string, created time.Time, tags ...string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	key := owner + "/" + name
+	s.packages[key] = append(s.packages[key], &Version{ID: s.nextID, Digest: digest, Tags: tags, Created: created})
+	return s.nextID
+}
+
+// SetPackage sets the visibility (public, private or internal) of the package owner/name and
+// the repository it is linked to (e.g. example/hello), not linked when blank
+func (s *Server) SetPackage(owner string, name string, visibility string, repository string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[owner+"/"+name] = settings{visibility: visibility, repository: repository}
+}
+
+// Versions returns a copy of the versions of the package owner/name, deleted ones included
+func (s *Server) Versions(owner string, name string) []Version {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var versions []Version
+	for _, v := range s.packages[owner+"/"+name] {
+		versions = append(versions, *v)
+	}
+	return versions
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeMessage(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	// RawPath keeps the escaped slashes of nested package names
+	p := r.URL.EscapedPath()
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i := range parts {
+		parts[i], _ = url.PathUnescape(parts[i])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(parts) == 2 && parts[0] == "users" && r.Method == http.MethodGet:
+		kind := "User"
+		if s.orgs[parts[1]] {
+			kind = "Organization"
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"login": parts[1], "type": kind})
+	case len(parts) >= 6 && (parts[0] == "orgs" || parts[0] == "users") && parts[2] == "packages" && parts[3] == "container" && parts[5] == "versions":
+		if (parts[0] == "orgs") != s.orgs[parts[1]] {
+			writeMessage(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		versions, ok := s.packages[parts[1]+"/"+parts[4]]
+		if !ok {
+			writeMessage(w, http.StatusNotFound, "Package not found.")
+			return
+		}
+		s.serveVersions(w, r, versions, parts[6:])
+	case len(parts) == 5 && (parts[0] == "orgs" || parts[0] == "users") && parts[2] == "packages" && parts[3] == "container" && r.Method == http.MethodGet:
+		s.servePackage(w, parts[0] == "orgs", parts[1], parts[4])
+	default:
+		writeMessage(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) serveVersions(w http.ResponseWriter, r *http.Request, versions []*Version, rest []string) {
+	if len(rest) == 0 && r.Method == http.MethodGet {
+		deleted := r.URL.Query().Get("state") == "deleted"
+		var list []*Version
+		for _, v := range versions {
+			if v.Deleted == deleted {
+				list = append(list, v)
+			}
+		}
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		if perPage <= 0 {
+			perPage = 30
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page <= 0 {
+			page = 1
+		}
+		start := min((page-1)*perPage, len(list))
+		end := min(start+perPage, len(list))
+		body := []map[string]any{}
+		for _, v := range list[start:end] {
+			body = append(body, map[string]any{
+				"id":         v.ID,
+				"name":       v.Digest,
+				"created_at": v.Created.UTC().Format(time.RFC3339),
+				"updated_at": v.Created.UTC().Format(time.RFC3339),
+				"metadata": map[string]any{
+					"package_type": "container",
+					"container":    map[string]any{"tags": append([]string{}, v.Tags...)},
+				},
+			})
+		}
+		writeJSON(w, http.StatusOK, body)
+		return
+	}
+	var version *Version
+	if len(rest) > 0 {
+		id, _ := strconv.ParseInt(rest[0], 10, 64)
+		for _, v := range versions {
+			if v.ID == id {
+				version = v
+			}
+		}
+	}
+	switch {
+	case version == nil:
+		writeMessage(w, http.StatusNotFound, "Not Found")
+	case len(rest) == 1 && r.Method == http.MethodDelete && !version.Deleted:
+		version.Deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 2 && rest[1] == "restore" && r.Method == http.MethodPost && version.Deleted:
+		version.Deleted = false
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMessage(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) servePackage(w http.ResponseWriter, org bool, owner string, name string) {
+	versions, ok := s.packages[owner+"/"+name]
+	if !ok || org != s.orgs[owner] {
+		writeMessage(w, http.StatusNotFound, "Package not found.")
+		return
+	}
+	count := 0
+	for _, v := range versions {
+		if !v.Deleted {
+			count++
+		}
+	}
+	st := s.settings[owner+"/"+name]
+	if st.visibility == "" {
+		st.visibility = "private"
+	}
+	body := map[string]any{
+		"id":            1,
+		"name":          name,
+		"package_type":  "container",
+		"visibility":    st.visibility,
+		"version_count": count,
+		"html_url":      "https://github.com/" + owner + "/packages/container/package/" + url.PathEscape(name),
+	}
+	if st.repository != "" {
+		body["repository"] = map[string]any{
+			"full_name": st.repository,
+			"html_url":  "https://github.com/" + st.repository,
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
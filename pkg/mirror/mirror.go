@@ -0,0 +1,258 @@
+// Package mirror copies the tags of a repository to a repository of another registry, e.g. to keep
+// a copy of GitHub Packages on a self-hosted registry
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// Status is what happened to a tag
+type Status string
+
+const (
+	// Copied tags were copied to the destination
+	Copied Status = "copied"
+	// Skipped tags had the same digest in the destination already
+	Skipped Status = "skipped"
+	// Failed tags couldn't be copied, see Result.Err
+	Failed Status = "failed"
+)
+
+// Result is the outcome of the sync of a tag
+type Result struct {
+	Tag    string
+	Digest string
+	Status Status
+	Err    error
+}
+
+// State records the digest of every tag synced, it is saved after each tag so that an interrupted
+// sync resumes without checking the tags done already
+type State struct {
+	path string
+	mu   sync.Mutex
+	// Source and Destination are the repositories the state belongs to
+	Source      string            `json:"source"`
+	Destination string            `json:"destination"`
+	Synced      map[string]string `json:"synced"`
+}
+
+// LoadState reads the state file at path of the sync of source to destination, an empty state when it doesn't
+// exist yet. The state of another sync is refused.
+func LoadState(path string, source string, destination string) (*State, error) {
+	s := &State{path: path, Source: source, Destination: destination, Synced: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved State
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("read state %s: %w", path, err)
+	}
+	if saved.Source != source || saved.Destination != destination {
+		return nil, fmt.Errorf("state %s is the sync of %s to %s, not of %s to %s", path, saved.Source, saved.Destination, source, destination)
+	}
+	if saved.Synced != nil {
+		s.Synced = saved.Synced
+	}
+	return s, nil
+}
+
+// done reports whether tag was synced at digest already
+func (s *State) done(tag string, digest string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Synced[tag] == digest
+}
+
+// record records that tag was synced at digest and saves the state
+func (s *State) record(tag string, digest string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Synced[tag] = digest
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename, an interrupted write must not lose the state
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Mirror syncs the tags of a source repository to a destination repository
+type Mirror struct {
+	src     *regctl.Registry
+	srcRepo ref.Ref
+	dst     *regctl.Registry
+	dstRepo ref.Ref
+
+	match       *regexp.Regexp
+	concurrency int
+	state       *State
+}
+
+type Option func(*Mirror)
+
+// WithMatch syncs only the tags matching re
+func WithMatch(re *regexp.Regexp) Option {
+	return func(m *Mirror) {
+		m.match = re
+	}
+}
+
+// WithConcurrency syncs n tags at once, 1 by default
+func WithConcurrency(n int) Option {
+	return func(m *Mirror) {
+		if n > 0 {
+			m.concurrency = n
+		}
+	}
+}
+
+// WithState records the synced tags in state and skips the tags it has at the same digest
+func WithState(state *State) Option {
+	return func(m *Mirror) {
+		m.state = state
+	}
+}
+
+// New returns a Mirror of the repository srcRepo of src (e.g. ghcr.io/example/hello) to the repository
+// dstRepo of dst (e.g. registry.example.com/mirror/hello), their tags are ignored
+func New(src *regctl.Registry, srcRepo string, dst *regctl.Registry, dstRepo string, opts ...Option) (*Mirror, error) {
+	rSrc, err := ref.New(srcRepo)
+	if err != nil {
+		return nil, err
+	}
+	rDst, err := ref.New(dstRepo)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mirror{
+		src:         src,
+		srcRepo:     rSrc.SetTag(""),
+		dst:         dst,
+		dstRepo:     rDst.SetTag(""),
+		concurrency: 1,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m, nil
+}
+
+// Tags lists the tags of the source repository to sync, sorted. The tags of signatures and referrers
+// are skipped, they are copied along with the manifests they belong to.
+func (m *Mirror) Tags(ctx context.Context) ([]string, error) {
+	tags, err := m.src.Tags(ctx, m.srcRepo.CommonName())
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, tag := range regctl.PackageTags(tags) {
+		if m.match != nil && !m.match.MatchString(tag) {
+			continue
+		}
+		selected = append(selected, tag)
+	}
+	sort.Strings(selected)
+	return selected, nil
+}
+
+// Run syncs the tags and calls progress, if not nil, after each of them. A failed tag doesn't stop the others,
+// Run returns the results in the order of the tags and an error when any tag failed.
+func (m *Mirror) Run(ctx context.Context, progress func(Result)) ([]Result, error) {
+	tags, err := m.Tags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(tags))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < m.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := m.syncTag(ctx, tags[j])
+				mu.Lock()
+				results[j] = res
+				if progress != nil {
+					progress(res)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for j := range tags {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	failed := 0
+	for _, res := range results {
+		if res.Status == Failed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d tags failed to sync", failed, len(results))
+	}
+	return results, nil
+}
+
+// syncTag copies tag unless the destination has it at the same digest already
+func (m *Mirror) syncTag(ctx context.Context, tag string) Result {
+	res := Result{Tag: tag}
+	srcRefName := m.srcRepo.SetTag(tag).CommonName()
+	dstRefName := m.dstRepo.SetTag(tag).CommonName()
+	res.Digest, res.Err = m.src.Digest(ctx, srcRefName)
+	if res.Err != nil {
+		res.Status = Failed
+		return res
+	}
+	if m.state != nil && m.state.done(tag, res.Digest) {
+		res.Status = Skipped
+		return res
+	}
+	dstDigest, err := m.dst.Digest(ctx, dstRefName)
+	switch {
+	case err == nil && dstDigest == res.Digest:
+		res.Status = Skipped
+	case err != nil && !errors.Is(err, regctl.ErrNotFound):
+		res.Status, res.Err = Failed, err
+		return res
+	default:
+		res.Err = m.src.CopyTo(ctx, srcRefName, m.dst, dstRefName)
+		if res.Err != nil {
+			res.Status = Failed
+			return res
+		}
+		res.Status = Copied
+	}
+	if m.state != nil {
+		err = m.state.record(tag, res.Digest)
+		if err != nil {
+			res.Status, res.Err = Failed, fmt.Errorf("save state: %w", err)
+		}
+	}
+	return res
+}
@@ -0,0 +1,109 @@
+package mirror
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/registry"
+	"github.com/akkuman/blob-uploader/pkg/registry/registrytest"
+	"github.com/akkuman/blob-uploader/pkg/util"
+)
+
+func statuses(results []Result) map[string]Status {
+	m := make(map[string]Status)
+	for _, res := range results {
+		m[res.Tag] = res.Status
+	}
+	return m
+}
+
+func TestRun(t *testing.T) {
+	srcSrv := registrytest.New(t, registry.WithAuth("akkuman", "secret"))
+	dstSrv := registrytest.New(t, registry.WithAuth("mirror", "secret2"))
+	registrytest.PushPackage(t, srcSrv, "akkuman", "secret", "akkuman/hello", "1.0.0", "1.1.0", "nightly-1")
+	src := regctl.NewRegistry(srcSrv.Host, "akkuman", "secret", regctl.WithPlainHTTP())
+	dst := regctl.NewRegistry(dstSrv.Host, "mirror", "secret2", regctl.WithPlainHTTP())
+	ctx := context.Background()
+	sbom := filepath.Join(t.TempDir(), "sbom.spdx.json")
+	err := os.WriteFile(sbom, []byte(`{"spdxVersion":"SPDX-2.3"}`), 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbomDigest, err := src.Attach(ctx, srcSrv.Host+"/akkuman/hello:1.1.0", &util.DefaultPlatform, sbom, regctl.Attachment{ArtifactType: "application/spdx+json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcRepo, dstRepo := srcSrv.Host+"/akkuman/hello", dstSrv.Host+"/mirror/hello"
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	run := func(opts ...Option) []Result {
+		t.Helper()
+		state, err := LoadState(statePath, srcRepo, dstRepo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := New(src, srcRepo, dst, dstRepo, append(opts, WithState(state), WithConcurrency(2))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := m.Run(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	results := run(WithMatch(regexp.MustCompile(`^1\.`)))
+	if got := statuses(results); len(got) != 2 || got["1.0.0"] != Copied || got["1.1.0"] != Copied {
+		t.Errorf("first run: got %v", got)
+	}
+	for _, res := range results {
+		digest, err := dst.Digest(ctx, dstRepo+":"+res.Tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest != res.Digest {
+			t.Errorf("%s: got digest %s in the destination, want %s", res.Tag, digest, res.Digest)
+		}
+	}
+	referrers, err := dst.Referrers(ctx, dstRepo+":1.1.0", &util.DefaultPlatform, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sbomDigest {
+		t.Errorf("unexpected referrers in the destination %+v", referrers)
+	}
+
+	// the state has the synced tags, the new one is copied
+	results = run()
+	if got := statuses(results); got["1.0.0"] != Skipped || got["1.1.0"] != Skipped || got["nightly-1"] != Copied {
+		t.Errorf("second run: got %v", got)
+	}
+	tags, err := dst.Tags(ctx, dstRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(tags, "nightly-1") {
+		t.Errorf("got tags %v in the destination", tags)
+	}
+
+	// without the state, the digests of the destination are compared
+	err = os.Remove(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = run()
+	if got := statuses(results); got["1.0.0"] != Skipped || got["1.1.0"] != Skipped || got["nightly-1"] != Skipped {
+		t.Errorf("third run: got %v", got)
+	}
+
+	_, err = LoadState(statePath, srcRepo, dstSrv.Host+"/other/hello")
+	if err == nil {
+		t.Error("loaded the state of another sync")
+	}
+}
@@ -0,0 +1,357 @@
+package policy
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/archive"
+	"gopkg.in/yaml.v3"
+)
+
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// defaultMaxScanSize is the number of bytes of each file which are searched for secrets
+const defaultMaxScanSize = 16 << 20
+
+// Policy is the content policy of an upload, it is loaded from a YAML file, e.g.
+//
+//	max_blob_size:
+//	  limit: 100MiB
+//	required_files:
+//	  - pattern: LICENSE
+//	    severity: warning
+//	forbidden_paths:
+//	  - pattern: .git/
+//	  - pattern: "*.pem"
+//	secret_patterns:
+//	  - name: github-token
+//	    regex: 'gh[pousr]_[A-Za-z0-9]{36}'
+//	required_annotations:
+//	  - key: org.opencontainers.image.source
+//
+// A rule without severity defaults to error.
+type Policy struct {
+	MaxBlobSize         *SizeRule        `yaml:"max_blob_size"`
+	RequiredFiles       []PathRule       `yaml:"required_files"`
+	ForbiddenPaths      []PathRule       `yaml:"forbidden_paths"`
+	SecretPatterns      []SecretRule     `yaml:"secret_patterns"`
+	RequiredAnnotations []AnnotationRule `yaml:"required_annotations"`
+	MaxScanSize         Size             `yaml:"max_scan_size"`
+}
+
+type SizeRule struct {
+	Limit    Size     `yaml:"limit"`
+	Severity Severity `yaml:"severity"`
+}
+
+type PathRule struct {
+	Pattern  string   `yaml:"pattern"`
+	Severity Severity `yaml:"severity"`
+}
+
+type SecretRule struct {
+	Name     string   `yaml:"name"`
+	Regex    string   `yaml:"regex"`
+	Severity Severity `yaml:"severity"`
+
+	re *regexp.Regexp
+}
+
+type AnnotationRule struct {
+	Key      string   `yaml:"key"`
+	Severity Severity `yaml:"severity"`
+}
+
+// Size is a number of bytes, it can be written as 1048576, 1MiB or 1MB in YAML
+type Size int64
+
+func (s *Size) UnmarshalYAML(value *yaml.Node) error {
+	n, err := ParseSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*s = Size(n)
+	return nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as 1024, 100MB or 1GiB
+func ParseSize(text string) (int64, error) {
+	text = strings.TrimSpace(text)
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			factor = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", text)
+	}
+	return n * factor, nil
+}
+
+// Load reads and compiles the policy file at filePath
+func Load(filePath string) (*Policy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and compiles a YAML policy
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	err := yaml.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("parse policy failed: %w", err)
+	}
+	if p.MaxBlobSize != nil {
+		p.MaxBlobSize.Severity, err = normalizeSeverity(p.MaxBlobSize.Severity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, rules := range [][]PathRule{p.RequiredFiles, p.ForbiddenPaths} {
+		for i := range rules {
+			if rules[i].Pattern == "" {
+				return nil, fmt.Errorf("path rule without pattern")
+			}
+			rules[i].Severity, err = normalizeSeverity(rules[i].Severity)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := range p.SecretPatterns {
+		rule := &p.SecretPatterns[i]
+		rule.re, err = regexp.Compile(rule.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("secret pattern %s: %w", rule.Name, err)
+		}
+		if rule.Name == "" {
+			rule.Name = rule.Regex
+		}
+		rule.Severity, err = normalizeSeverity(rule.Severity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range p.RequiredAnnotations {
+		p.RequiredAnnotations[i].Severity, err = normalizeSeverity(p.RequiredAnnotations[i].Severity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.MaxScanSize == 0 {
+		p.MaxScanSize = defaultMaxScanSize
+	}
+	return p, nil
+}
+
+func normalizeSeverity(s Severity) (Severity, error) {
+	switch s {
+	case "":
+		return SeverityError, nil
+	case SeverityInfo, SeverityWarning, SeverityError:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown severity: %s", s)
+}
+
+// Violation is a single broken rule, File is empty when the rule applies to the whole package
+type Violation struct {
+	Severity Severity
+	Rule     string
+	File     string
+	Message  string
+}
+
+func (v Violation) String() string {
+	if v.File == "" {
+		return fmt.Sprintf("[%s] %s: %s", v.Severity, v.Rule, v.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s: %s", v.Severity, v.Rule, v.File, v.Message)
+}
+
+type Result struct {
+	Violations []Violation
+}
+
+// HasErrors reports whether any violation has the error severity
+func (r *Result) HasErrors() bool {
+	for _, v := range r.Violations {
+		if v.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ByFile groups the violations by file, package level violations are grouped under ""
+func (r *Result) ByFile() map[string][]Violation {
+	m := make(map[string][]Violation)
+	for _, v := range r.Violations {
+		m[v.File] = append(m[v.File], v)
+	}
+	return m
+}
+
+// Files returns the sorted list of files having violations
+func (r *Result) Files() []string {
+	var files []string
+	for file := range r.ByFile() {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (r *Result) add(severity Severity, rule string, file string, format string, a ...any) {
+	r.Violations = append(r.Violations, Violation{
+		Severity: severity,
+		Rule:     rule,
+		File:     file,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Check checks the tar.gz file at archivePath, the extra files pushed as layers of their own and the annotations
+// which will be pushed with them. archivePath may be empty when the package only consists of files, the files are
+// checked under their base name which is the title of their layer.
+func (p *Policy) Check(archivePath string, files []string, annotations map[string]string) (*Result, error) {
+	result := &Result{}
+	foundRequired := make([]bool, len(p.RequiredFiles))
+	if archivePath != "" {
+		err := p.checkBlobSize(result, archivePath, "")
+		if err != nil {
+			return nil, err
+		}
+		err = archive.Walk(archivePath, func(hdr *tar.Header, r io.Reader) error {
+			return p.checkFile(result, foundRequired, path.Clean(hdr.Name), hdr.Typeflag == tar.TypeReg, r)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, filePath := range files {
+		name := filepath.Base(filePath)
+		err := p.checkBlobSize(result, filePath, name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		err = p.checkFile(result, foundRequired, name, true, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, rule := range p.RequiredFiles {
+		if !foundRequired[i] {
+			result.add(rule.Severity, "required_files", "", "no file matches %s", rule.Pattern)
+		}
+	}
+	for _, rule := range p.RequiredAnnotations {
+		if annotations[rule.Key] == "" {
+			result.add(rule.Severity, "required_annotations", "", "annotation %s is missing", rule.Key)
+		}
+	}
+	return result, nil
+}
+
+// checkBlobSize checks the size of the blob at filePath, file is empty for the tar.gz package
+func (p *Policy) checkBlobSize(result *Result, filePath string, file string) error {
+	if p.MaxBlobSize == nil {
+		return nil
+	}
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if fi.Size() > int64(p.MaxBlobSize.Limit) {
+		result.add(p.MaxBlobSize.Severity, "max_blob_size", file, "blob size %d exceeds the limit %d", fi.Size(), p.MaxBlobSize.Limit)
+	}
+	return nil
+}
+
+// checkFile checks the path rules against name and, for regular files, the secret patterns against the content of r
+func (p *Policy) checkFile(result *Result, foundRequired []bool, name string, regular bool, r io.Reader) error {
+	for i, rule := range p.RequiredFiles {
+		if matchPath(rule.Pattern, name) {
+			foundRequired[i] = true
+		}
+	}
+	for _, rule := range p.ForbiddenPaths {
+		if matchPath(rule.Pattern, name) {
+			result.add(rule.Severity, "forbidden_paths", name, "matches forbidden path %s", rule.Pattern)
+		}
+	}
+	if !regular || len(p.SecretPatterns) == 0 {
+		return nil
+	}
+	content, err := io.ReadAll(io.LimitReader(r, int64(p.MaxScanSize)))
+	if err != nil {
+		return err
+	}
+	for _, rule := range p.SecretPatterns {
+		loc := rule.re.FindIndex(content)
+		if loc == nil {
+			continue
+		}
+		line := 1 + strings.Count(string(content[:loc[0]]), "\n")
+		result.add(rule.Severity, "secret_patterns", name, "line %d matches secret pattern %s", line, rule.Name)
+	}
+	return nil
+}
+
+// matchPath matches name against pattern. A pattern ending with "/" matches a directory
+// at any depth, other patterns are globs matched against the full path and the base name.
+func matchPath(pattern string, name string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		dir := strings.TrimSuffix(pattern, "/")
+		for _, part := range strings.Split(name, "/") {
+			if ok, _ := path.Match(dir, part); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, path.Base(name))
+	return ok
+}
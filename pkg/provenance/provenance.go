@@ -0,0 +1,300 @@
+// Package provenance builds in-toto statements with a SLSA provenance predicate from the
+// GitHub Actions environment, optionally signed in a DSSE envelope, and checks them, see
+// https://slsa.dev/spec/v1.0/provenance and https://github.com/secure-systems-lab/dsse
+package provenance
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/sign"
+)
+
+const (
+	StatementType     = "https://in-toto.io/Statement/v1"
+	PredicateTypeSLSA = "https://slsa.dev/provenance/v1"
+	// BuildTypeGitHubActions is the buildType of the builds of GitHub Actions workflows
+	BuildTypeGitHubActions = "https://actions.github.io/buildtypes/workflow/v1"
+	// BuilderGitHubHosted is the builder id of the GitHub-hosted runners
+	BuilderGitHubHosted = "https://github.com/actions/runner/github-hosted"
+
+	// PayloadType is the DSSE payload type of in-toto statements
+	PayloadType = "application/vnd.in-toto+json"
+	// ArtifactTypeStatement is the artifactType of an unsigned statement attached to a package
+	ArtifactTypeStatement = "application/vnd.in-toto+json"
+	// ArtifactTypeEnvelope is the artifactType of a statement signed in a DSSE envelope
+	ArtifactTypeEnvelope = "application/vnd.dsse.envelope.v1+json"
+)
+
+var (
+	// ErrNotGitHubActions is returned when the provenance is built outside of GitHub Actions
+	ErrNotGitHubActions = errors.New("not running in GitHub Actions")
+	// ErrMismatch is returned when the provenance doesn't match the expectations
+	ErrMismatch = errors.New("provenance mismatch")
+)
+
+// Statement is an in-toto statement
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// Subject is an artifact described by a statement
+type Subject struct {
+	Name        string            `json:"name"`
+	Digest      map[string]string `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Predicate is a SLSA v1 provenance
+type Predicate struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   ExternalParameters   `json:"externalParameters"`
+	InternalParameters   map[string]string    `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+type ExternalParameters struct {
+	Workflow Workflow `json:"workflow"`
+}
+
+// Workflow is the workflow which was run
+type Workflow struct {
+	// Ref is the git ref the workflow ran on, e.g. refs/heads/main
+	Ref string `json:"ref"`
+	// Repository is the URL of the repository, e.g. https://github.com/example/hello
+	Repository string `json:"repository"`
+	// Path is the path of the workflow file, e.g. .github/workflows/release.yml
+	Path string `json:"path"`
+}
+
+type ResourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+type RunDetails struct {
+	Builder  Builder  `json:"builder"`
+	Metadata Metadata `json:"metadata"`
+}
+
+type Builder struct {
+	ID string `json:"id"`
+}
+
+type Metadata struct {
+	InvocationID string `json:"invocationId"`
+}
+
+// FromGitHubActions builds the predicate from the default environment variables of GitHub Actions,
+// https://docs.github.com/en/actions/writing-workflows/choosing-what-your-workflow-does/store-information-in-variables#default-environment-variables
+func FromGitHubActions(getenv func(string) string) (*Predicate, error) {
+	if getenv("GITHUB_ACTIONS") != "true" {
+		return nil, ErrNotGitHubActions
+	}
+	for _, key := range []string{"GITHUB_REPOSITORY", "GITHUB_SHA", "GITHUB_REF", "GITHUB_RUN_ID"} {
+		if getenv(key) == "" {
+			return nil, fmt.Errorf("%s is not set", key)
+		}
+	}
+	serverURL := getenv("GITHUB_SERVER_URL")
+	if serverURL == "" {
+		serverURL = "https://github.com"
+	}
+	repoURL := fmt.Sprintf("%s/%s", serverURL, getenv("GITHUB_REPOSITORY"))
+	// GITHUB_WORKFLOW_REF is like example/hello/.github/workflows/release.yml@refs/heads/main
+	workflowPath, _, _ := strings.Cut(strings.TrimPrefix(getenv("GITHUB_WORKFLOW_REF"), getenv("GITHUB_REPOSITORY")+"/"), "@")
+	attempt := getenv("GITHUB_RUN_ATTEMPT")
+	if attempt == "" {
+		attempt = "1"
+	}
+	builderID := BuilderGitHubHosted
+	if getenv("RUNNER_ENVIRONMENT") == "self-hosted" {
+		builderID = repoURL + "/runner/self-hosted"
+	}
+	internal := make(map[string]string)
+	for key, name := range map[string]string{
+		"GITHUB_EVENT_NAME":          "event_name",
+		"GITHUB_REPOSITORY_ID":       "repository_id",
+		"GITHUB_REPOSITORY_OWNER_ID": "repository_owner_id",
+	} {
+		if v := getenv(key); v != "" {
+			internal[name] = v
+		}
+	}
+	return &Predicate{
+		BuildDefinition: BuildDefinition{
+			BuildType: BuildTypeGitHubActions,
+			ExternalParameters: ExternalParameters{
+				Workflow: Workflow{
+					Ref:        getenv("GITHUB_REF"),
+					Repository: repoURL,
+					Path:       workflowPath,
+				},
+			},
+			InternalParameters: internal,
+			ResolvedDependencies: []ResourceDescriptor{{
+				URI:    fmt.Sprintf("git+%s@%s", repoURL, getenv("GITHUB_REF")),
+				Digest: map[string]string{"gitCommit": getenv("GITHUB_SHA")},
+			}},
+		},
+		RunDetails: RunDetails{
+			Builder: Builder{ID: builderID},
+			Metadata: Metadata{
+				InvocationID: fmt.Sprintf("%s/actions/runs/%s/attempts/%s", repoURL, getenv("GITHUB_RUN_ID"), attempt),
+			},
+		},
+	}, nil
+}
+
+// NewStatement returns the statement of predicate about subjects
+func NewStatement(predicate *Predicate, subjects ...Subject) *Statement {
+	return &Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateTypeSLSA,
+		Predicate:     *predicate,
+	}
+}
+
+// NewSubject returns the subject of the manifest digest (e.g. sha256:<hex>) of name
+func NewSubject(name string, digest string, annotations map[string]string) Subject {
+	algo, hex, _ := strings.Cut(digest, ":")
+	return Subject{Name: name, Digest: map[string]string{algo: hex}, Annotations: annotations}
+}
+
+// Expectation is what a provenance must state
+type Expectation struct {
+	// Digest is a manifest digest which must be a subject
+	Digest string
+	// Repository is the repository which must have built it, e.g. example/hello or https://github.com/example/hello
+	Repository string
+	// Ref is the git ref which must have been built, e.g. refs/tags/v1.2.0, any ref when blank
+	Ref string
+}
+
+// Check checks that the statement is a SLSA provenance meeting the expectation
+func (s *Statement) Check(expect Expectation) error {
+	if s.Type != StatementType || s.PredicateType != PredicateTypeSLSA {
+		return fmt.Errorf("%w: not a SLSA provenance statement", ErrMismatch)
+	}
+	algo, hex, _ := strings.Cut(expect.Digest, ":")
+	if hex == "" {
+		return fmt.Errorf("invalid digest %q", expect.Digest)
+	}
+	found := false
+	for _, subject := range s.Subject {
+		if subject.Digest[algo] == hex {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %s is not a subject", ErrMismatch, expect.Digest)
+	}
+	workflow := s.Predicate.BuildDefinition.ExternalParameters.Workflow
+	repo := strings.ToLower(strings.TrimSuffix(workflow.Repository, "/"))
+	want := strings.ToLower(strings.TrimSuffix(expect.Repository, "/"))
+	// without a scheme, the expected repository is owner/name on any server
+	_, repoPath, _ := strings.Cut(strings.TrimPrefix(repo, "https://"), "/")
+	if repo != want && (strings.Contains(want, "://") || repoPath != want) {
+		return fmt.Errorf("%w: built from %s, not %s", ErrMismatch, workflow.Repository, expect.Repository)
+	}
+	if expect.Ref != "" && workflow.Ref != expect.Ref {
+		return fmt.Errorf("%w: built from ref %s, not %s", ErrMismatch, workflow.Ref, expect.Ref)
+	}
+	return nil
+}
+
+// Envelope is a DSSE envelope
+type Envelope struct {
+	PayloadType string              `json:"payloadType"`
+	Payload     string              `json:"payload"`
+	Signatures  []EnvelopeSignature `json:"signatures"`
+}
+
+type EnvelopeSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// pae is the pre-authentication encoding of DSSE, which is what is signed
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// SignStatement signs the statement in a DSSE envelope
+func SignStatement(s *Statement, key crypto.Signer) (*Envelope, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign.Sign(key, pae(PayloadType, payload))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []EnvelopeSignature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// Open returns the statement of the envelope, it must be signed by the private key of pub
+// unless pub is nil
+func (e *Envelope) Open(pub crypto.PublicKey) (*Statement, error) {
+	if e.PayloadType != PayloadType {
+		return nil, fmt.Errorf("unexpected payload type %s", e.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if pub != nil {
+		valid := false
+		for _, s := range e.Signatures {
+			sig, err := base64.StdEncoding.DecodeString(s.Sig)
+			if err == nil && sign.VerifyPayload(pub, pae(e.PayloadType, payload), sig) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, sign.ErrInvalidSignature
+		}
+	}
+	s := &Statement{}
+	return s, json.Unmarshal(payload, s)
+}
+
+// Parse parses an attached provenance of artifactType, either a statement or a DSSE envelope.
+// When pub isn't nil, only a envelope signed by its private key is accepted.
+func Parse(artifactType string, data []byte, pub crypto.PublicKey) (*Statement, error) {
+	switch artifactType {
+	case ArtifactTypeEnvelope:
+		e := &Envelope{}
+		err := json.Unmarshal(data, e)
+		if err != nil {
+			return nil, err
+		}
+		return e.Open(pub)
+	case ArtifactTypeStatement:
+		if pub != nil {
+			return nil, fmt.Errorf("%w: the statement is not signed", sign.ErrNoSignature)
+		}
+		s := &Statement{}
+		return s, json.Unmarshal(data, s)
+	}
+	return nil, fmt.Errorf("unexpected artifact type %s", artifactType)
+}
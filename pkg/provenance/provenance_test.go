@@ -0,0 +1,110 @@
+package provenance
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/pkg/sign"
+)
+
+const testDigest = "sha256:5fb1f81b5ec69f79b7131d7257c44e14affda91d835a62f3928d662910b593a8"
+
+var testEnv = map[string]string{
+	"GITHUB_ACTIONS":      "true",
+	"GITHUB_REPOSITORY":   "example/hello",
+	"GITHUB_SHA":          "8d4a5e4e0f8c2d3f6b1a9e7c5d3b1a9e7c5d3b1a",
+	"GITHUB_REF":          "refs/tags/v1.2.0",
+	"GITHUB_RUN_ID":       "1234",
+	"GITHUB_RUN_ATTEMPT":  "2",
+	"GITHUB_WORKFLOW_REF": "example/hello/.github/workflows/release.yml@refs/tags/v1.2.0",
+}
+
+func TestFromGitHubActions(t *testing.T) {
+	_, err := FromGitHubActions(func(string) string { return "" })
+	if !errors.Is(err, ErrNotGitHubActions) {
+		t.Errorf("got %v outside of GitHub Actions", err)
+	}
+	p, err := FromGitHubActions(func(key string) string { return testEnv[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflow := p.BuildDefinition.ExternalParameters.Workflow
+	if workflow.Repository != "https://github.com/example/hello" || workflow.Path != ".github/workflows/release.yml" || workflow.Ref != "refs/tags/v1.2.0" {
+		t.Errorf("unexpected workflow %+v", workflow)
+	}
+	if p.RunDetails.Metadata.InvocationID != "https://github.com/example/hello/actions/runs/1234/attempts/2" {
+		t.Errorf("unexpected invocation id %s", p.RunDetails.Metadata.InvocationID)
+	}
+	if p.BuildDefinition.ResolvedDependencies[0].Digest["gitCommit"] != testEnv["GITHUB_SHA"] {
+		t.Errorf("unexpected dependencies %+v", p.BuildDefinition.ResolvedDependencies)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p, err := FromGitHubActions(func(key string) string { return testEnv[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStatement(p, NewSubject("ghcr.io/example/hello:1.2.0", testDigest, nil))
+	tests := []struct {
+		name   string
+		expect Expectation
+		ok     bool
+	}{
+		{"repo", Expectation{Digest: testDigest, Repository: "example/hello"}, true},
+		{"repo url and ref", Expectation{Digest: testDigest, Repository: "https://github.com/Example/hello", Ref: "refs/tags/v1.2.0"}, true},
+		{"other repo", Expectation{Digest: testDigest, Repository: "evil/hello"}, false},
+		{"repo name only", Expectation{Digest: testDigest, Repository: "hello"}, false},
+		{"other ref", Expectation{Digest: testDigest, Repository: "example/hello", Ref: "refs/heads/dev"}, false},
+		{"other digest", Expectation{Digest: "sha256:00", Repository: "example/hello"}, false},
+	}
+	for _, tt := range tests {
+		err := s.Check(tt.expect)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	p, err := FromGitHubActions(func(key string) string { return testEnv[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStatement(p, NewSubject("ghcr.io/example/hello:1.2.0", testDigest, nil))
+	envelope, err := SignStatement(s, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, _ := json.Marshal(envelope)
+	unsigned, _ := json.Marshal(s)
+	tests := []struct {
+		name         string
+		artifactType string
+		data         []byte
+		pub          ed25519.PublicKey
+		want         error
+	}{
+		{"signed", ArtifactTypeEnvelope, signed, pub, nil},
+		{"signed without key", ArtifactTypeEnvelope, signed, nil, nil},
+		{"other key", ArtifactTypeEnvelope, signed, otherPub, sign.ErrInvalidSignature},
+		{"unsigned", ArtifactTypeStatement, unsigned, nil, nil},
+		{"unsigned with key", ArtifactTypeStatement, unsigned, pub, sign.ErrNoSignature},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.pub == nil {
+			_, err = Parse(tt.artifactType, tt.data, nil)
+		} else {
+			_, err = Parse(tt.artifactType, tt.data, tt.pub)
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
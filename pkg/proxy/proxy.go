@@ -0,0 +1,241 @@
+// Package proxy serves the packages of an upstream registry on plain download URLs,
+// the blobs are cached on disk by digest
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/akkuman/blob-uploader/storage"
+)
+
+var hexDigestRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// staleTTL is how long an expired resolution is kept to be used when the upstream is unavailable
+const staleTTL = 24 * time.Hour
+
+// Proxy is an http.Handler serving /<repo>/<tag>/<os>/<arch>, where tag may be latest
+type Proxy struct {
+	upstream   string
+	cacheDir   string
+	resolveTTL time.Duration
+	registry   *regctl.Registry
+	storage    *storage.GithubPackageStorage
+
+	mu       sync.Mutex
+	resolved map[string]resolution
+	fetching map[string]*fetchLock
+}
+
+// fetchLock serializes the downloads of a blob, it is dropped when no request waits for it
+type fetchLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// resolution is the blob a download URL resolved to
+type resolution struct {
+	refName   string
+	hexdigest string
+	expires   time.Time
+}
+
+type options struct {
+	resolveTTL time.Duration
+	regOpts    []regctl.Option
+}
+
+type Option func(*options)
+
+// WithResolveTTL sets how long the resolution of a tag is reused before asking the upstream again,
+// an expired resolution is still used for a day when the upstream is unavailable
+func WithResolveTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.resolveTTL = ttl
+	}
+}
+
+// WithRegistryOptions sets the options of the upstream registry client
+func WithRegistryOptions(opts ...regctl.Option) Option {
+	return func(o *options) {
+		o.regOpts = append(o.regOpts, opts...)
+	}
+}
+
+// New returns a proxy of upstream, the registry host with an optional repository prefix
+// (e.g. ghcr.io/pkgforge), blobs are cached in cacheDir
+func New(upstream string, cacheDir string, opts ...Option) (*Proxy, error) {
+	opt := &options{resolveTTL: 5 * time.Minute}
+	for _, o := range opts {
+		o(opt)
+	}
+	upstream = strings.TrimSuffix(upstream, "/")
+	host, _, _ := strings.Cut(upstream, "/")
+	err := os.MkdirAll(filepath.Join(cacheDir, "blobs", "sha256"), 0775)
+	if err != nil {
+		return nil, err
+	}
+	reg := regctl.NewRegistry(host, "", "", opt.regOpts...)
+	return &Proxy{
+		upstream:   upstream,
+		cacheDir:   cacheDir,
+		resolveTTL: opt.resolveTTL,
+		registry:   reg,
+		storage:    storage.NewGithubPackageStorage(nil, reg),
+		resolved:   make(map[string]resolution),
+		fetching:   make(map[string]*fetchLock),
+	}, nil
+}
+
+// parsePath parses /<repo>/<tag>/<os>/<arch>
+func parsePath(p string) (repo string, tag string, platform util.Platform, err error) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) < 4 {
+		err = fmt.Errorf("expected /<repo>/<tag>/<os>/<arch>")
+		return
+	}
+	n := len(parts)
+	repo = strings.Join(parts[:n-3], "/")
+	tag = parts[n-3]
+	platform = util.Platform{OS: parts[n-2], Arch: parts[n-1]}
+	return
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	repo, tag, platform, err := parsePath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	imageRef := fmt.Sprintf("%s/%s:%s", p.upstream, strings.ToLower(repo), tag)
+	res, err := p.resolve(r.Context(), imageRef, platform)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, regctl.ErrNotFound) || errors.Is(err, storage.ErrPlatformNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	blobPath, err := p.fetch(r.Context(), res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	f, err := os.Open(blobPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", "sha256:"+res.hexdigest)
+	w.Header().Set("ETag", fmt.Sprintf(`"sha256:%s"`, res.hexdigest))
+	w.Header().Set("X-Resolved-Ref", res.refName)
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// resolve resolves imageRef to the digest of the blob of platform, the resolution is reused
+// until it expires, or longer when the upstream is unavailable
+func (p *Proxy) resolve(ctx context.Context, imageRef string, platform util.Platform) (resolution, error) {
+	key := imageRef + "@" + platform.String()
+	p.mu.Lock()
+	cached, ok := p.resolved[key]
+	p.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached, nil
+	}
+	if ok && time.Now().After(cached.expires.Add(staleTTL)) {
+		ok = false
+	}
+	refName, hexdigest, err := p.storage.Locate(ctx, imageRef, platform)
+	if err == nil && !hexDigestRegexp.MatchString(hexdigest) {
+		err = fmt.Errorf("%s: invalid blob digest %q", refName, hexdigest)
+	}
+	if err != nil {
+		if ok && !errors.Is(err, regctl.ErrNotFound) && !errors.Is(err, storage.ErrPlatformNotFound) {
+			log.Printf("resolve %s failed, using the previous resolution: %v", imageRef, err)
+			return cached, nil
+		}
+		return resolution{}, err
+	}
+	now := time.Now()
+	res := resolution{
+		refName:   refName,
+		hexdigest: hexdigest,
+		expires:   now.Add(p.resolveTTL),
+	}
+	p.mu.Lock()
+	for k, r := range p.resolved {
+		if now.After(r.expires.Add(staleTTL)) {
+			delete(p.resolved, k)
+		}
+	}
+	p.resolved[key] = res
+	p.mu.Unlock()
+	return res, nil
+}
+
+// fetch returns the path of the cached blob, downloading and verifying it on the first request
+func (p *Proxy) fetch(ctx context.Context, res resolution) (string, error) {
+	blobPath := filepath.Join(p.cacheDir, "blobs", "sha256", res.hexdigest)
+	// only one request downloads a blob, the others wait for it
+	p.mu.Lock()
+	lock, ok := p.fetching[res.hexdigest]
+	if !ok {
+		lock = &fetchLock{}
+		p.fetching[res.hexdigest] = lock
+	}
+	lock.waiters++
+	p.mu.Unlock()
+	lock.mu.Lock()
+	defer func() {
+		lock.mu.Unlock()
+		p.mu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(p.fetching, res.hexdigest)
+		}
+		p.mu.Unlock()
+	}()
+	if util.FileExist(blobPath) {
+		return blobPath, nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(blobPath), ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	h := sha256.New()
+	err = p.registry.DownloadBlob(ctx, res.refName, res.hexdigest, io.MultiWriter(f, h))
+	if err != nil {
+		return "", fmt.Errorf("download %s@sha256:%s: %w", res.refName, res.hexdigest, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != res.hexdigest {
+		return "", fmt.Errorf("%s: digest of the downloaded blob is sha256:%s, not sha256:%s", res.refName, got, res.hexdigest)
+	}
+	err = f.Close()
+	if err != nil {
+		return "", err
+	}
+	return blobPath, os.Rename(f.Name(), blobPath)
+}
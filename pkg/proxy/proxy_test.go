@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/registry"
+	"github.com/akkuman/blob-uploader/pkg/registry/registrytest"
+	"github.com/akkuman/blob-uploader/pkg/util"
+)
+
+func TestProxy(t *testing.T) {
+	srv := registrytest.New(t, registry.WithAuth("akkuman", "secret"))
+	blob := registrytest.PushPackage(t, srv, "akkuman", "secret", "akkuman/wget", "1.21")
+
+	p, err := New(srv.Host, t.TempDir(), WithRegistryOptions(regctl.WithPlainHTTP()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+	platform := "/" + util.DefaultPlatform.OS + "/" + util.DefaultPlatform.Arch
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"tag", "/akkuman/wget/1.21" + platform, http.StatusOK},
+		{"latest", "/akkuman/wget/latest" + platform, http.StatusOK},
+		{"missing platform", "/akkuman/wget/1.21/plan9/mips", http.StatusNotFound},
+		{"missing tag", "/akkuman/wget/2.0" + platform, http.StatusNotFound},
+		{"missing repository", "/akkuman/curl/latest" + platform, http.StatusNotFound},
+		{"short path", "/wget/latest", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, status := get(t, proxy.URL+tt.path)
+			if status != tt.status {
+				t.Fatalf("got status %d, want %d: %s", status, tt.status, body)
+			}
+			if status == http.StatusOK && !bytes.Equal(body, blob) {
+				t.Error("served content differs from the uploaded one")
+			}
+		})
+	}
+
+	if len(p.fetching) != 0 {
+		t.Errorf("the download locks are kept: %v", p.fetching)
+	}
+	// a resolution expired for longer than staleTTL is evicted when a tag is resolved again
+	p.mu.Lock()
+	delete(p.resolved, srv.Host+"/akkuman/wget:latest@"+util.DefaultPlatform.String())
+	p.resolved["gone"] = resolution{expires: time.Now().Add(-staleTTL - time.Minute)}
+	p.resolved["stale"] = resolution{expires: time.Now().Add(-time.Minute)}
+	p.mu.Unlock()
+	if _, status := get(t, proxy.URL+"/akkuman/wget/latest"+platform); status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	}
+	if _, ok := p.resolved["gone"]; ok {
+		t.Error("a resolution expired for longer than staleTTL is kept")
+	}
+	if _, ok := p.resolved["stale"]; !ok {
+		t.Error("a recently expired resolution is evicted")
+	}
+
+	// the resolution and the blob are cached, so the upstream is no longer needed
+	srv.Close()
+	body, status := get(t, proxy.URL+"/akkuman/wget/1.21"+platform)
+	if status != http.StatusOK || !bytes.Equal(body, blob) {
+		t.Errorf("cached blob not served, status %d", status)
+	}
+}
+
+func get(t *testing.T, url string) ([]byte, int) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body, resp.StatusCode
+}
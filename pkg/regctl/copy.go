@@ -0,0 +1,46 @@
+package regctl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// Tags lists the tags of the repository of refName
+func (rg *Registry) Tags(ctx context.Context, refName string) ([]string, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return nil, err
+	}
+	tl, err := rg.getRegClient().TagList(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("list tags of %s: %w", r.CommonName(), err)
+	}
+	return tl.GetTags()
+}
+
+// CopyTo copies the manifest of srcRefName to dstRefName in the registry dst, with every platform,
+// the referrers and the signatures (the sha256-<hex>.sig tags). The blobs dst has already are skipped.
+func (rg *Registry) CopyTo(ctx context.Context, srcRefName string, dst *Registry, dstRefName string) error {
+	rSrc, err := ref.New(srcRefName)
+	if err != nil {
+		return err
+	}
+	rDst, err := ref.New(dstRefName)
+	if err != nil {
+		return err
+	}
+	hosts := []config.Host{rg.configHost()}
+	if dst.reg != rg.reg {
+		hosts = append(hosts, dst.configHost())
+	}
+	rc := regclient.New(regclient.WithConfigHost(hosts...))
+	err = rc.ImageCopy(ctx, rSrc, rDst, regclient.ImageWithReferrers(), regclient.ImageWithDigestTags())
+	if err != nil {
+		return fmt.Errorf("copy %s to %s: %w", rSrc.CommonName(), rDst.CommonName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package regctl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/regclient/regclient/types/mediatype"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// maxConfigSize is the largest config which Inspect downloads, larger configs are only described
+const maxConfigSize = 64 << 10
+
+// Inspection describes what was pushed for a ref
+type Inspection struct {
+	Ref          string            `json:"ref"`
+	Digest       string            `json:"digest"`
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	// Manifests are the platform manifests of the index, or the manifest itself when the ref isn't an index
+	Manifests []ManifestInspection `json:"manifests"`
+	// Referrers are the referrers of the index
+	Referrers []Referrer `json:"referrers"`
+}
+
+// ManifestInspection describes a platform manifest
+type ManifestInspection struct {
+	Digest       string `json:"digest"`
+	MediaType    string `json:"mediaType"`
+	ArtifactType string `json:"artifactType,omitempty"`
+	// Platform is the platform of the index entry, e.g. linux/amd64
+	Platform string `json:"platform,omitempty"`
+	// Size is the size of the manifest plus the sizes of its config and layers
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Config      ConfigInspection  `json:"config"`
+	Layers      []LayerInspection `json:"layers"`
+	Referrers   []Referrer        `json:"referrers"`
+}
+
+type ConfigInspection struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	// Content is the config itself when it is JSON and small enough
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+type LayerInspection struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	// Title is the org.opencontainers.image.title of the layer, the name of the file it holds
+	Title string `json:"title,omitempty"`
+}
+
+// Inspect describes the manifest of refName, its platform manifests, their configs, their layers
+// and the referrers of all of them
+func (rg *Registry) Inspect(ctx context.Context, refName string) (*Inspection, error) {
+	data, err := rg.GetManifest(ctx, refName)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(data))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	var index v1.Index
+	err = json.Unmarshal([]byte(data), &index)
+	if err != nil {
+		return nil, fmt.Errorf("parse manifest of %s: %w", refName, err)
+	}
+	ins := &Inspection{
+		Ref:          refName,
+		Digest:       digest,
+		MediaType:    index.MediaType,
+		ArtifactType: index.ArtifactType,
+		Annotations:  index.Annotations,
+	}
+	if !isIndex(data, index.MediaType) {
+		m, err := rg.inspectManifest(ctx, refName, digest, data)
+		if err != nil {
+			return nil, err
+		}
+		ins.Manifests = []ManifestInspection{*m}
+		ins.Referrers = m.Referrers
+		return ins, nil
+	}
+	ins.Referrers, err = rg.referrersOf(ctx, refName, digest)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range index.Manifests {
+		manifest, err := rg.GetImageManifest(ctx, refName, d.Digest.String())
+		if err != nil {
+			return nil, fmt.Errorf("get manifest %s: %w", d.Digest, err)
+		}
+		m, err := rg.inspectManifest(ctx, refName, d.Digest.String(), manifest)
+		if err != nil {
+			return nil, err
+		}
+		if d.Platform != nil {
+			m.Platform = (&util.Platform{OS: d.Platform.OS, Arch: d.Platform.Architecture}).String()
+		}
+		ins.Manifests = append(ins.Manifests, *m)
+	}
+	return ins, nil
+}
+
+// isIndex reports whether the manifest data is an index, the mediaType field is optional in an OCI index
+// so the manifests key is looked for when it is missing
+func isIndex(data string, mediaType string) bool {
+	switch mediaType {
+	case mediatype.OCI1ManifestList, mediatype.Docker2ManifestList:
+		return true
+	case "":
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(data), &fields); err != nil {
+			return false
+		}
+		_, ok := fields["manifests"]
+		return ok
+	}
+	return false
+}
+
+// inspectManifest describes the image manifest data with the given digest in the repository of refName
+func (rg *Registry) inspectManifest(ctx context.Context, refName string, digest string, data string) (*ManifestInspection, error) {
+	var manifest v1.Manifest
+	err := json.Unmarshal([]byte(data), &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", digest, err)
+	}
+	m := &ManifestInspection{
+		Digest:       digest,
+		MediaType:    manifest.MediaType,
+		ArtifactType: manifest.ArtifactType,
+		Size:         int64(len(data)) + manifest.Config.Size,
+		Annotations:  manifest.Annotations,
+		Config: ConfigInspection{
+			Digest:    manifest.Config.Digest.String(),
+			MediaType: manifest.Config.MediaType,
+			Size:      manifest.Config.Size,
+		},
+		Layers: []LayerInspection{},
+	}
+	for _, l := range manifest.Layers {
+		m.Size += l.Size
+		m.Layers = append(m.Layers, LayerInspection{
+			Digest:    l.Digest.String(),
+			MediaType: l.MediaType,
+			Size:      l.Size,
+			Title:     l.Annotations[annotationTitle],
+		})
+	}
+	if manifest.Config.Size > 0 && manifest.Config.Size <= maxConfigSize && strings.HasSuffix(manifest.Config.MediaType, "json") {
+		var buf bytes.Buffer
+		err = rg.DownloadBlob(ctx, refName, manifest.Config.Digest.Encoded(), &buf)
+		if err != nil {
+			return nil, fmt.Errorf("get config %s: %w", manifest.Config.Digest, err)
+		}
+		if json.Valid(buf.Bytes()) {
+			m.Config.Content = buf.Bytes()
+		}
+	}
+	m.Referrers, err = rg.referrersOf(ctx, refName, digest)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// referrersOf lists the referrers of the manifest with the given digest in the repository of refName
+func (rg *Registry) referrersOf(ctx context.Context, refName string, digest string) ([]Referrer, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return nil, err
+	}
+	return rg.Referrers(ctx, r.SetDigest(digest).CommonName(), nil, "")
+}
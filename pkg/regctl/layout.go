@@ -0,0 +1,148 @@
+package regctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/regclient/regclient"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+const annotationRefName = "org.opencontainers.image.ref.name"
+
+func readLayoutIndex(layoutDir string) (*v1.Index, error) {
+	data, err := os.ReadFile(filepath.Join(layoutDir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	index := &v1.Index{}
+	err = json.Unmarshal(data, index)
+	return index, err
+}
+
+func writeLayoutIndex(layoutDir string, index *v1.Index) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(layoutDir, "index.json"), data, 0664)
+}
+
+// SaveLayout copies every ref (all platforms and referrers) into the OCI layout at layoutDir.
+// Images are recorded in index.json under their full ref name (e.g. ghcr.io/example/hello:1.2.0)
+// so that refs of different repositories sharing a tag don't overwrite each other.
+func (rg *Registry) SaveLayout(ctx context.Context, layoutDir string, refNames ...string) error {
+	rc := rg.getRegClient()
+	for _, refName := range refNames {
+		rSrc, err := ref.New(refName)
+		if err != nil {
+			return err
+		}
+		if rSrc.Digest != "" {
+			return fmt.Errorf("%s: digest refs are not supported, use a tag", refName)
+		}
+		rTgt, err := ref.New(fmt.Sprintf("ocidir://%s:%s", layoutDir, rSrc.Tag))
+		if err != nil {
+			return err
+		}
+		err = rc.ImageCopy(ctx, rSrc, rTgt, regclient.ImageWithReferrers())
+		if err != nil {
+			return fmt.Errorf("save %s: %w", refName, err)
+		}
+		index, err := readLayoutIndex(layoutDir)
+		if err != nil {
+			return err
+		}
+		manifests := index.Manifests[:0]
+		for _, m := range index.Manifests {
+			switch m.Annotations[annotationRefName] {
+			case rSrc.CommonName():
+				// saved previously, replaced by the new copy
+				continue
+			case rSrc.Tag:
+				m.Annotations[annotationRefName] = rSrc.CommonName()
+			}
+			manifests = append(manifests, m)
+		}
+		index.Manifests = manifests
+		err = writeLayoutIndex(layoutDir, index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LayoutRefs returns the full ref names of the images saved by SaveLayout
+func LayoutRefs(layoutDir string) ([]string, error) {
+	index, err := readLayoutIndex(layoutDir)
+	if err != nil {
+		return nil, err
+	}
+	var refNames []string
+	for _, m := range index.Manifests {
+		name := m.Annotations[annotationRefName]
+		// referrers are saved with tags such as sha256-<digest> and are copied along with their subject
+		if strings.Contains(name, "/") {
+			refNames = append(refNames, name)
+		}
+	}
+	return refNames, nil
+}
+
+// LoadLayout pushes every image saved by SaveLayout to the registry, the registry host (and path prefix)
+// of each ref is replaced by target, e.g. ghcr.io/example/hello:1.2.0 is pushed to <target>/example/hello:1.2.0
+func (rg *Registry) LoadLayout(ctx context.Context, layoutDir string, target string) (pushed []string, err error) {
+	refNames, err := LayoutRefs(layoutDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(refNames) == 0 {
+		return nil, fmt.Errorf("no image found in %s", layoutDir)
+	}
+	rc := rg.getRegClient()
+	for _, refName := range refNames {
+		r, err := ref.New(refName)
+		if err != nil {
+			return pushed, err
+		}
+		// select the image by the digest of its full name instead of the tag which may be shared by several images
+		d, err := layoutDigest(layoutDir, refName)
+		if err != nil {
+			return pushed, err
+		}
+		rSrc, err := ref.New(fmt.Sprintf("ocidir://%s@%s", layoutDir, d))
+		if err != nil {
+			return pushed, err
+		}
+		dstName := fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(target, "/"), r.Repository, r.Tag)
+		rTgt, err := ref.New(dstName)
+		if err != nil {
+			return pushed, err
+		}
+		err = rc.ImageCopy(ctx, rSrc, rTgt, regclient.ImageWithReferrers())
+		if err != nil {
+			return pushed, fmt.Errorf("load %s: %w", refName, err)
+		}
+		pushed = append(pushed, dstName)
+	}
+	return pushed, nil
+}
+
+func layoutDigest(layoutDir string, refName string) (string, error) {
+	index, err := readLayoutIndex(layoutDir)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range index.Manifests {
+		if m.Annotations[annotationRefName] == refName {
+			return m.Digest.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in %s", refName, layoutDir)
+}
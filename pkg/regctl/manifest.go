@@ -0,0 +1,220 @@
+package regctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/sign"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/regclient/regclient/types/errs"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// PlatformManifest is a manifest listed in an index
+type PlatformManifest struct {
+	Digest   string
+	Platform util.Platform
+}
+
+// Digest returns the digest of the manifest of refName
+func (rg *Registry) Digest(ctx context.Context, refName string) (string, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return "", err
+	}
+	rc := rg.getRegClient()
+	m, err := rc.ManifestHead(ctx, r)
+	if err != nil || m.GetDescriptor().Digest == "" {
+		m, err = rc.ManifestGet(ctx, r)
+	}
+	if errors.Is(err, errs.ErrNotFound) {
+		return "", fmt.Errorf("%s: %w", refName, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return m.GetDescriptor().Digest.String(), nil
+}
+
+// Annotations returns the digest and the annotations of the manifest of refName
+func (rg *Registry) Annotations(ctx context.Context, refName string) (string, map[string]string, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return "", nil, err
+	}
+	m, err := rg.getRegClient().ManifestGet(ctx, r)
+	if errors.Is(err, errs.ErrNotFound) {
+		return "", nil, fmt.Errorf("%s: %w", refName, ErrNotFound)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	var annotations map[string]string
+	if ma, ok := m.(manifest.Annotator); ok {
+		annotations, err = ma.GetAnnotations()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return m.GetDescriptor().Digest.String(), annotations, nil
+}
+
+// ResolveIndex returns the digest of the index of refName and the platform manifests it lists
+func (rg *Registry) ResolveIndex(ctx context.Context, refName string) (string, []PlatformManifest, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return "", nil, err
+	}
+	m, err := rg.getRegClient().ManifestGet(ctx, r)
+	if err != nil {
+		return "", nil, err
+	}
+	if !m.IsList() {
+		return "", nil, fmt.Errorf("%s is not an index", refName)
+	}
+	descs, err := m.GetManifestList()
+	if err != nil {
+		return "", nil, err
+	}
+	var manifests []PlatformManifest
+	for _, d := range descs {
+		pm := PlatformManifest{Digest: d.Digest.String()}
+		if d.Platform != nil {
+			pm.Platform = util.Platform{OS: d.Platform.OS, Arch: d.Platform.Architecture}
+		}
+		manifests = append(manifests, pm)
+	}
+	return m.GetDescriptor().Digest.String(), manifests, nil
+}
+
+const annotationCreated = "org.opencontainers.image.created"
+
+// TaggedManifest is a manifest of a repository and its tags
+type TaggedManifest struct {
+	Digest string
+	Tags   []string
+	// Created is the time of the org.opencontainers.image.created annotation, zero when missing
+	Created time.Time
+}
+
+// PackageTags drops the tags of signatures and referrers (sha256-<hex>[.sig]) from tags, they belong to
+// the manifest whose digest they are named after and aren't versions of the package
+func PackageTags(tags []string) []string {
+	var filtered []string
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "sha256-") {
+			filtered = append(filtered, tag)
+		}
+	}
+	return filtered
+}
+
+// ArtifactTags returns the tags of the signatures and of the referrers of the manifest digest,
+// the referrers are tagged so by registries without the referrers API
+func ArtifactTags(digest string) []string {
+	sigTag := sign.SignatureTag(digest)
+	return []string{sigTag, strings.TrimSuffix(sigTag, ".sig")}
+}
+
+// taggedManifestsConcurrency is the number of manifest requests TaggedManifests sends at once
+const taggedManifestsConcurrency = 8
+
+// TaggedManifests lists the tagged manifests of the repository of refName in the order of the tag list,
+// the tags of signatures and referrers are skipped. The tags are resolved with HEAD requests and the
+// manifest of each digest is fetched once for its created annotation.
+func (rg *Registry) TaggedManifests(ctx context.Context, refName string) ([]TaggedManifest, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return nil, err
+	}
+	tl, err := rg.getRegClient().TagList(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("list tags of %s: %w", r.CommonName(), err)
+	}
+	tags, err := tl.GetTags()
+	if err != nil {
+		return nil, err
+	}
+	tags = PackageTags(tags)
+	digests := make([]string, len(tags))
+	err = parallel(len(tags), func(i int) error {
+		digest, err := rg.Digest(ctx, r.SetTag(tags[i]).CommonName())
+		digests[i] = digest
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var manifests []TaggedManifest
+	byDigest := make(map[string]int)
+	for i, digest := range digests {
+		if j, ok := byDigest[digest]; ok {
+			manifests[j].Tags = append(manifests[j].Tags, tags[i])
+			continue
+		}
+		byDigest[digest] = len(manifests)
+		manifests = append(manifests, TaggedManifest{Digest: digest, Tags: []string{tags[i]}})
+	}
+	err = parallel(len(manifests), func(i int) error {
+		_, annotations, err := rg.Annotations(ctx, r.SetDigest(manifests[i].Digest).CommonName())
+		if err != nil {
+			return err
+		}
+		manifests[i].Created, _ = time.Parse(time.RFC3339, annotations[annotationCreated])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifests, nil
+}
+
+// parallel calls fn for 0 to n-1 with at most taggedManifestsConcurrency calls at once
+// and returns the first error
+func parallel(n int, fn func(i int) error) error {
+	jobs := make(chan int)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for w := 0; w < min(n, taggedManifestsConcurrency); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteManifest deletes the manifest of refName, and so every tag of it, and returns its digest
+func (rg *Registry) DeleteManifest(ctx context.Context, refName string) (string, error) {
+	digest, err := rg.Digest(ctx, refName)
+	if err != nil {
+		return "", err
+	}
+	r, err := ref.New(refName)
+	if err != nil {
+		return "", err
+	}
+	err = rg.getRegClient().ManifestDelete(ctx, r.SetDigest(digest))
+	if err != nil {
+		return "", fmt.Errorf("delete %s: %w", digest, err)
+	}
+	return digest, nil
+}
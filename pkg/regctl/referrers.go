@@ -0,0 +1,181 @@
+package regctl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/descriptor"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/mediatype"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+const annotationTitle = "org.opencontainers.image.title"
+
+// Referrer is an artifact attached to a package manifest
+type Referrer struct {
+	Digest       string            `json:"digest"`
+	ArtifactType string            `json:"artifactType"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// Attachment is a file pushed as a referrer artifact
+type Attachment struct {
+	// ArtifactType is the artifactType of the artifact manifest
+	ArtifactType string
+	// MediaType is the media type of the file layer, default to application/octet-stream
+	MediaType string
+	// Annotations are written to the artifact manifest
+	Annotations map[string]string
+}
+
+// subject resolves refName to the descriptor of its manifest, or of the manifest of platform
+// in its index when platform isn't nil
+func subject(ctx context.Context, rc *regclient.RegClient, refName string, p *util.Platform) (ref.Ref, descriptor.Descriptor, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return r, descriptor.Descriptor{}, err
+	}
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return r, descriptor.Descriptor{}, err
+	}
+	d := m.GetDescriptor()
+	if p != nil {
+		if !m.IsList() {
+			return r, descriptor.Descriptor{}, fmt.Errorf("%s is not an index, it has no platform %s", refName, p.String())
+		}
+		pd, err := manifest.GetPlatformDesc(m, &platform.Platform{OS: p.OS, Architecture: p.Arch})
+		if err != nil {
+			return r, descriptor.Descriptor{}, fmt.Errorf("%s: platform %s: %w", refName, p.String(), err)
+		}
+		d = *pd
+	}
+	return r, descriptor.Descriptor{MediaType: d.MediaType, Digest: d.Digest, Size: d.Size}, nil
+}
+
+// Attach pushes the file at filePath as an OCI 1.1 artifact referring to the manifest of refName,
+// or to the manifest of platform when platform isn't nil, and returns the digest of the artifact manifest.
+// Registries without the referrers API get the sha256-<digest> tag schema instead.
+func (rg *Registry) Attach(ctx context.Context, refName string, p *util.Platform, filePath string, att Attachment) (string, error) {
+	if att.ArtifactType == "" {
+		return "", fmt.Errorf("artifact type is required")
+	}
+	if att.MediaType == "" {
+		att.MediaType = "application/octet-stream"
+	}
+	rc := rg.getRegClient()
+	r, subjectDesc, err := subject(ctx, rc, refName, p)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	layer, err := rc.BlobPut(ctx, r, descriptor.Descriptor{}, f)
+	if err != nil {
+		return "", fmt.Errorf("push %s: %w", filePath, err)
+	}
+	layer.MediaType = att.MediaType
+	layer.Annotations = map[string]string{annotationTitle: filepath.Base(filePath)}
+	config, err := rc.BlobPut(ctx, r, descriptor.Descriptor{}, bytes.NewReader(descriptor.EmptyData))
+	if err != nil {
+		return "", fmt.Errorf("push empty config: %w", err)
+	}
+	config.MediaType = mediatype.OCI1Empty
+	m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned:    v1.ManifestSchemaVersion,
+		MediaType:    mediatype.OCI1Manifest,
+		ArtifactType: att.ArtifactType,
+		Config:       config,
+		Layers:       []descriptor.Descriptor{layer},
+		Subject:      &subjectDesc,
+		Annotations:  att.Annotations,
+	}))
+	if err != nil {
+		return "", err
+	}
+	rArtifact := r.SetDigest(m.GetDescriptor().Digest.String())
+	err = rc.ManifestPut(ctx, rArtifact, m)
+	if err != nil {
+		return "", fmt.Errorf("push artifact manifest: %w", err)
+	}
+	return rArtifact.Digest, nil
+}
+
+// Referrers lists the artifacts referring to the manifest of refName, or to the manifest of platform
+// when platform isn't nil, only those of artifactType are listed when it isn't blank
+func (rg *Registry) Referrers(ctx context.Context, refName string, p *util.Platform, artifactType string) ([]Referrer, error) {
+	rc := rg.getRegClient()
+	r, subjectDesc, err := subject(ctx, rc, refName, p)
+	if err != nil {
+		return nil, err
+	}
+	var opts []scheme.ReferrerOpts
+	if artifactType != "" {
+		opts = append(opts, scheme.WithReferrerMatchOpt(descriptor.MatchOpt{ArtifactType: artifactType}))
+	}
+	rl, err := rc.ReferrerList(ctx, r.SetDigest(subjectDesc.Digest.String()), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("list referrers of %s: %w", refName, err)
+	}
+	referrers := make([]Referrer, 0, len(rl.Descriptors))
+	for _, d := range rl.Descriptors {
+		referrers = append(referrers, Referrer{
+			Digest:       d.Digest.String(),
+			ArtifactType: d.ArtifactType,
+			Size:         d.Size,
+			Annotations:  d.Annotations,
+		})
+	}
+	return referrers, nil
+}
+
+// DownloadReferrer writes the file of the referrer artifact with the given digest in the repository of refName
+// to outWriter, and returns its file name
+func (rg *Registry) DownloadReferrer(ctx context.Context, refName string, digest string, outWriter io.Writer) (string, error) {
+	rc := rg.getRegClient()
+	r, err := ref.New(refName)
+	if err != nil {
+		return "", err
+	}
+	r = r.SetDigest(digest)
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return "", err
+	}
+	mi, ok := m.(manifest.Imager)
+	if !ok {
+		return "", fmt.Errorf("%s is not an artifact manifest", digest)
+	}
+	layers, err := mi.GetLayers()
+	if err != nil {
+		return "", err
+	}
+	if len(layers) != 1 {
+		return "", fmt.Errorf("%s has %d layers, expected one file", digest, len(layers))
+	}
+	blob, err := rc.BlobGet(ctx, r, layers[0])
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+	// the blob reader verifies the digest once it is fully read
+	_, err = io.Copy(outWriter, blob)
+	if err != nil {
+		return "", err
+	}
+	return layers[0].Annotations[annotationTitle], nil
+}
@@ -2,6 +2,7 @@ package regctl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,15 +10,52 @@ import (
 
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/types/mediatype"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/tidwall/gjson"
 )
 
-type AnonymousRegistry struct {}
+// ErrNotFound is returned when the registry responds 404 for a repository, a manifest or a blob
+var ErrNotFound = errors.New("not found")
 
-func NewAnonymousRegistry() *AnonymousRegistry {
-	return &AnonymousRegistry{
+func statusError(statusCode int) error {
+	if statusCode == http.StatusNotFound {
+		return fmt.Errorf("status code: %d: %w", statusCode, ErrNotFound)
 	}
+	return fmt.Errorf("status code: %d", statusCode)
+}
+
+type options struct {
+	plainHTTP bool
+}
+
+type Option func(*options)
+
+// WithPlainHTTP talks to the registry over HTTP instead of HTTPS, e.g. a local registry for tests
+func WithPlainHTTP() Option {
+	return func(o *options) {
+		o.plainHTTP = true
+	}
+}
+
+type AnonymousRegistry struct {
+	opt options
+}
+
+func NewAnonymousRegistry(opts ...Option) *AnonymousRegistry {
+	rg := &AnonymousRegistry{}
+	for _, o := range opts {
+		o(&rg.opt)
+	}
+	return rg
+}
+
+// baseURL returns the URL of the registry of r
+func (rg *AnonymousRegistry) baseURL(r ref.Ref) string {
+	if rg.opt.plainHTTP {
+		return fmt.Sprintf("http://%s", r.Registry)
+	}
+	return fmt.Sprintf("https://%s", r.Registry)
 }
 
 func (rg *AnonymousRegistry) httpDo(ctx context.Context, method string, url string, headers map[string]string, body io.Reader) (resp *http.Response, err error) {
@@ -42,14 +80,14 @@ func (rg *AnonymousRegistry) GetTags(ctx context.Context, refName string) (tags
 	if err != nil {
 		return nil, err
 	}
-	url := fmt.Sprintf("https://%s/v2/%s/tags/list", r.Registry, r.Repository)
+	url := fmt.Sprintf("%s/v2/%s/tags/list", rg.baseURL(r), r.Repository)
 	resp, err := rg.httpDo(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -61,21 +99,59 @@ func (rg *AnonymousRegistry) GetTags(ctx context.Context, refName string) (tags
 	return tags, nil
 }
 
+// manifestMediaTypes are the media types accepted by GetManifest, indexes first
+var manifestMediaTypes = []string{
+	mediatype.OCI1ManifestList,
+	mediatype.Docker2ManifestList,
+	mediatype.OCI1Manifest,
+	mediatype.Docker2Manifest,
+}
+
+// GetManifest returns the manifest of refName, by digest when refName has one, by tag otherwise.
+// It is usually the index of a package but any OCI or Docker manifest is accepted.
 func (rg *AnonymousRegistry) GetManifest(ctx context.Context, refName string) (manifest string, err error) {
 	r, err := ref.New(refName)
 	if err != nil {
 		return "", err
 	}
-	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", r.Registry, r.Repository, r.Tag)
+	reference := r.Tag
+	if r.Digest != "" {
+		reference = r.Digest
+	}
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", rg.baseURL(r), r.Repository, reference)
 	resp, err := rg.httpDo(ctx, http.MethodGet, url, map[string]string{
-		"Accept": "application/vnd.oci.image.index.v1+json",
+		"Accept": strings.Join(manifestMediaTypes, ", "),
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", statusError(resp.StatusCode)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(respBody), nil
+}
+
+// GetImageManifest returns the image manifest with the given digest from the repository of refName
+func (rg *AnonymousRegistry) GetImageManifest(ctx context.Context, refName string, digest string) (manifest string, err error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", rg.baseURL(r), r.Repository, digest)
+	resp, err := rg.httpDo(ctx, http.MethodGet, url, map[string]string{
+		"Accept": "application/vnd.oci.image.manifest.v1+json",
 	}, nil)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("status code: %d", resp.StatusCode)
+		return "", statusError(resp.StatusCode)
 	}
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -89,7 +165,7 @@ func (rg *AnonymousRegistry) DownloadBlob(ctx context.Context, refName string, s
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("https://%s/v2/%s/blobs/sha256:%s", r.Registry, r.Repository, sha256)
+	url := fmt.Sprintf("%s/v2/%s/blobs/sha256:%s", rg.baseURL(r), r.Repository, sha256)
 	resp, err := rg.httpDo(ctx, http.MethodGet, url, map[string]string{
 		"Accept": "application/vnd.oci.image.index.v1+json",
 	}, nil)
@@ -98,7 +174,7 @@ func (rg *AnonymousRegistry) DownloadBlob(ctx context.Context, refName string, s
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("status code: %d", resp.StatusCode)
+		return statusError(resp.StatusCode)
 	}
 	_, err = io.Copy(outWriter, resp.Body)
 	return err
@@ -111,19 +187,28 @@ type Registry struct {
 	pass string
 }
 
-func NewRegistry(reg string, user string, pass string) *Registry {
+func NewRegistry(reg string, user string, pass string, opts ...Option) *Registry {
 	return &Registry{
+		AnonymousRegistry: *NewAnonymousRegistry(opts...),
 		reg: reg,
 		user: user,
 		pass: pass,
 	}
 }
 
-func (rg *Registry) getRegClient() *regclient.RegClient {
+// configHost returns the regclient configuration of the registry
+func (rg *Registry) configHost() config.Host {
 	host := config.HostNewName(rg.reg)
 	host.User = rg.user
 	host.Pass = rg.pass
-	rc := regclient.New(regclient.WithConfigHost(*host))
+	if rg.opt.plainHTTP {
+		host.TLS = config.TLSDisabled
+	}
+	return *host
+}
+
+func (rg *Registry) getRegClient() *regclient.RegClient {
+	rc := regclient.New(regclient.WithConfigHost(rg.configHost()))
 	return rc
 }
 
@@ -138,7 +223,8 @@ func (rg *Registry) Login() error {
 }
 
 func (rg *Registry) ImageCopy(ctx context.Context, ociRootDir string, imageRefWithoutHost string) error {
-	srcRef := fmt.Sprintf("ocidir://%s", ociRootDir)
+	// the layout built by oci.BuildOCI is tagged with the version of the target ref
+	srcRef := fmt.Sprintf("ocidir://%s:%s", ociRootDir, rg.GetVersion(imageRefWithoutHost))
 	dstRef := rg.GetRefFullName(imageRefWithoutHost)
 	rSrc, err := ref.New(srcRef)
 	if err != nil {
@@ -2,68 +2,94 @@ package regctl
 
 import (
 	"context"
-	"io"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/registry"
+	"github.com/akkuman/blob-uploader/pkg/registry/registrytest"
 	"github.com/akkuman/blob-uploader/pkg/util"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/tidwall/gjson"
 )
 
+const (
+	testUsername = "akkuman"
+	testPassword = "secret"
+)
+
+// newTestRegistry starts a registry holding the tags of akkuman/hello
+func newTestRegistry(t *testing.T, tags ...string) *registrytest.Server {
+	t.Helper()
+	srv := registrytest.New(t, registry.WithAuth(testUsername, testPassword))
+	registrytest.PushPackage(t, srv, testUsername, testPassword, "akkuman/hello", tags...)
+	return srv
+}
+
 func TestLoginRegistry(t *testing.T) {
-	username, ok := os.LookupEnv("GITHUB_USER")
-	if !ok {
-		t.Error("GITHUB_USER environment must to be set")
-		return
-	}
-	token, ok := os.LookupEnv("GITHUB_TOKEN")
-	if !ok {
-		t.Error("GITHUB_TOKEN environment must to be set")
-		return
-	}
-	rg := NewRegistry("ghcr.io", username, token)
-	err := rg.Login()
-	if err != nil {
-		t.Error(err)
+	srv := newTestRegistry(t)
+	for _, x := range []struct {
+		password string
+		wantErr  bool
+	}{
+		{testPassword, false},
+		{"wrong", true},
+	} {
+		rg := NewRegistry(srv.Host, testUsername, x.password, WithPlainHTTP())
+		err := rg.Login()
+		if (err != nil) != x.wantErr {
+			t.Errorf("password %s: error %v, want error %v", x.password, err, x.wantErr)
+		}
 	}
 }
 
 func TestGetTags(t *testing.T) {
+	srv := newTestRegistry(t, "2.10", "2.12.1")
 	for _, refName := range []string{
-		"ghcr.io/homebrew/core/hello",
-		"ghcr.io/homebrew/core/hello:123",
-		"ghcr.io/homebrew/core/hello:2.10",
+		srv.Host + "/akkuman/hello",
+		srv.Host + "/akkuman/hello:123",
+		srv.Host + "/akkuman/hello:2.10",
 	} {
 		t.Run(refName, func(t *testing.T) {
-			rg := NewAnonymousRegistry()
+			rg := NewAnonymousRegistry(WithPlainHTTP())
 			tags, err := rg.GetTags(context.Background(), refName)
 			if err != nil {
 				t.Error(err)
 			}
-			if len(tags) == 0 {
-				t.Error("the length of tags must > 0")
+			if fmt.Sprint(tags) != "[2.10 2.12.1]" {
+				t.Errorf("%v != [2.10 2.12.1]", tags)
 			}
 		})
 	}
 }
 
 func TestGetTagsWithErrorRef(t *testing.T) {
-	rg := NewAnonymousRegistry()
-	_, err := rg.GetTags(context.Background(), "ghcr.io/homebrew/core/hello111")
-	if !strings.Contains(err.Error(), "404") {
+	srv := newTestRegistry(t, "2.10")
+	rg := NewAnonymousRegistry(WithPlainHTTP())
+	_, err := rg.GetTags(context.Background(), srv.Host+"/akkuman/hello111")
+	if err == nil || !strings.Contains(err.Error(), "404") {
 		t.Error("the status code must be 404")
 	}
 }
 
 func TestGetManifest(t *testing.T) {
-	rg := NewAnonymousRegistry()
-	data, err := rg.GetManifest(context.Background(), "ghcr.io/homebrew/core/hello:2.10")
+	srv := newTestRegistry(t, "2.10")
+	rg := NewAnonymousRegistry(WithPlainHTTP())
+	data, err := rg.GetManifest(context.Background(), srv.Host+"/akkuman/hello:2.10")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	if gjson.Get(data, `annotations.com\.github\.package\.type`).String() != "homebrew_bottle" {
+	if gjson.Get(data, `annotations.com\.github\.package\.type`).String() != oci.PackageType {
 		t.Error("error annotations")
 	}
 }
@@ -120,37 +146,346 @@ func TestParseRefNameContainsUppercaseLetter(t *testing.T) {
 }
 
 func TestDownloadBlob(t *testing.T) {
-	rg := NewAnonymousRegistry()
+	srv := newTestRegistry(t, "2.12.1")
+	rg := NewAnonymousRegistry(WithPlainHTTP())
+	refName := srv.Host + "/akkuman/hello:2.12.1"
+	data, err := rg.GetManifest(context.Background(), refName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256 := gjson.Get(data, `annotations.dev\.pkgforge\.bin\.digest`).String()
 	out, err := os.CreateTemp("", "DownloadBlob.test.*")
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
 	}
 	defer os.Remove(out.Name())
 	defer out.Close()
-	sha256 := "7935d0efdae69742f5140d514ef2e3e50d1d7cb82104cf6033ad51b900c12749"
-	err = rg.DownloadBlob(
-		context.Background(),
-		"ghcr.io/homebrew/core/hello:2.12.1",
-		sha256,
-		out,
-	)
+	err = rg.DownloadBlob(context.Background(), refName, sha256, out)
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
 	}
-	_, err = out.Seek(0, io.SeekStart)
+	hexdigest, err := util.CalcFileSHA256(out.Name())
 	if err != nil {
-		t.Error(err)
-		return
-	}
-	hexdigest, err := util.GetSHA256(out)
-	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
 	}
 	if sha256 != hexdigest {
 		t.Errorf("%s != %s", sha256, hexdigest)
-		return
 	}
-}
\ No newline at end of file
+}
+
+func TestSaveLoadLayout(t *testing.T) {
+	srv := newTestRegistry(t, "2.10", "2.12.1")
+	rg := NewRegistry(srv.Host, testUsername, testPassword, WithPlainHTTP())
+	layoutDir := t.TempDir()
+	err := rg.SaveLayout(context.Background(), layoutDir, srv.Host+"/akkuman/hello:2.10", srv.Host+"/akkuman/hello:2.12.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := rg.LoadLayout(context.Background(), layoutDir, srv.Host+"/mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pushed) != 2 {
+		t.Fatalf("%v must contain 2 refs", pushed)
+	}
+	tags, err := rg.GetTags(context.Background(), srv.Host+"/mirror/akkuman/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tags) != "[2.10 2.12.1]" {
+		t.Errorf("%v != [2.10 2.12.1]", tags)
+	}
+}
+
+func TestAttachReferrers(t *testing.T) {
+	sbom := filepath.Join(t.TempDir(), "sbom.spdx.json")
+	err := os.WriteFile(sbom, []byte(`{"spdxVersion":"SPDX-2.3"}`), 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []struct {
+		name string
+		opts []registry.Option
+		// fallback is true when the referrers are expected in the sha256-<digest> tag
+		fallback bool
+	}{
+		{"referrers API", nil, false},
+		{"tag schema", []registry.Option{registry.WithoutReferrersAPI()}, true},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			srv := registrytest.New(t, append(x.opts, registry.WithAuth(testUsername, testPassword))...)
+			registrytest.PushPackage(t, srv, testUsername, testPassword, "akkuman/hello", "2.10")
+			rg := NewRegistry(srv.Host, testUsername, testPassword, WithPlainHTTP())
+			refName := srv.Host + "/akkuman/hello:2.10"
+			ctx := context.Background()
+			sbomDigest, err := rg.Attach(ctx, refName, &util.DefaultPlatform, sbom, Attachment{ArtifactType: "application/spdx+json"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rg.Attach(ctx, refName, nil, sbom, Attachment{
+				ArtifactType: "application/vnd.example.doc",
+				Annotations:  map[string]string{"org.example.kind": "docs"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			referrers, err := rg.Referrers(ctx, refName, &util.DefaultPlatform, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(referrers) != 1 || referrers[0].Digest != sbomDigest || referrers[0].ArtifactType != "application/spdx+json" {
+				t.Errorf("unexpected referrers of the platform manifest %+v", referrers)
+			}
+			referrers, err = rg.Referrers(ctx, refName, nil, "application/spdx+json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(referrers) != 0 {
+				t.Errorf("the index has no spdx referrer, got %+v", referrers)
+			}
+			referrers, err = rg.Referrers(ctx, refName, nil, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(referrers) != 1 || referrers[0].Annotations["org.example.kind"] != "docs" {
+				t.Errorf("unexpected referrers of the index %+v", referrers)
+			}
+
+			var buf strings.Builder
+			name, err := rg.DownloadReferrer(ctx, refName, sbomDigest, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != "sbom.spdx.json" || buf.String() != `{"spdxVersion":"SPDX-2.3"}` {
+				t.Errorf("unexpected referrer file %s: %s", name, buf.String())
+			}
+
+			tags, err := rg.GetTags(ctx, refName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hasFallbackTag := slices.ContainsFunc(tags, func(tag string) bool { return strings.HasPrefix(tag, "sha256-") })
+			if hasFallbackTag != x.fallback {
+				t.Errorf("tags %v, want the tag schema %v", tags, x.fallback)
+			}
+		})
+	}
+}
+
+func TestIsIndex(t *testing.T) {
+	for _, x := range []struct {
+		data string
+		want bool
+	}{
+		{`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`, true},
+		{`{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:0","size":1}]}`, true},
+		{`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[]}`, true},
+		{`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`, false},
+		{`{"schemaVersion":2,"config":{},"layers":[]}`, false},
+	} {
+		var m struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal([]byte(x.data), &m)
+		if got := isIndex(x.data, m.MediaType); got != x.want {
+			t.Errorf("isIndex(%s) = %v, want %v", x.data, got, x.want)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	srv := newTestRegistry(t, "2.10")
+	rg := NewRegistry(srv.Host, testUsername, testPassword, WithPlainHTTP())
+	refName := srv.Host + "/akkuman/hello:2.10"
+	ctx := context.Background()
+	sbom := filepath.Join(t.TempDir(), "sbom.spdx.json")
+	err := os.WriteFile(sbom, []byte(`{"spdxVersion":"SPDX-2.3"}`), 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbomDigest, err := rg.Attach(ctx, refName, &util.DefaultPlatform, sbom, Attachment{ArtifactType: "application/spdx+json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := rg.Digest(ctx, refName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{refName, refName + "@" + digest} {
+		ins, err := rg.Inspect(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ins.Digest != digest || ins.Annotations[`com.github.package.type`] != oci.PackageType || len(ins.Referrers) != 0 {
+			t.Errorf("%s: unexpected index %+v", name, ins)
+		}
+		if len(ins.Manifests) != 1 {
+			t.Fatalf("%s: got %d manifests", name, len(ins.Manifests))
+		}
+		m := ins.Manifests[0]
+		if m.Platform != util.DefaultPlatform.String() || len(m.Layers) == 0 || m.Layers[0].MediaType == "" || len(m.Config.Content) == 0 {
+			t.Errorf("%s: unexpected platform manifest %+v", name, m)
+		}
+		if len(m.Referrers) != 1 || m.Referrers[0].Digest != sbomDigest {
+			t.Errorf("%s: unexpected referrers of the platform manifest %+v", name, m.Referrers)
+		}
+	}
+
+	// a ref to the platform manifest itself is inspected as a single manifest
+	ins, err := rg.Inspect(ctx, refName+"@"+sbomDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ins.Manifests) != 1 || ins.ArtifactType != "application/spdx+json" || ins.Manifests[0].ArtifactType != "application/spdx+json" || ins.Manifests[0].Layers[0].Title != "sbom.spdx.json" {
+		t.Errorf("unexpected artifact manifest %+v", ins)
+	}
+}
+
+func TestTaggedManifestsDelete(t *testing.T) {
+	var manifestGets atomic.Int32
+	handler := registry.New(registry.WithAuth(testUsername, testPassword))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") {
+			manifestGets.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	srv := &registrytest.Server{Server: s, Host: strings.TrimPrefix(s.URL, "http://")}
+	registrytest.PushPackage(t, srv, testUsername, testPassword, "akkuman/hello", "2.10", "2.12.1")
+	rg := NewRegistry(srv.Host, testUsername, testPassword, WithPlainHTTP())
+	ctx := context.Background()
+	_, err := rg.Tag(ctx, srv.Host+"/akkuman/hello:2.12.1", []string{srv.Host + "/akkuman/hello:latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestGets.Store(0)
+	manifests, err := rg.TaggedManifests(ctx, srv.Host+"/akkuman/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 2 {
+		t.Fatalf("got %d tagged manifests, want 2", len(manifests))
+	}
+	for _, m := range manifests {
+		if m.Created.IsZero() {
+			t.Errorf("unexpected tagged manifest %+v", m)
+		}
+	}
+	if tags := manifests[1].Tags; !slices.Equal(tags, []string{"2.12.1", "latest"}) {
+		t.Errorf("got tags %v, want the tags of 2.12.1 grouped", tags)
+	}
+	// the tags are resolved with HEAD, each manifest is fetched once
+	if n := manifestGets.Load(); n != 2 {
+		t.Errorf("got %d manifest GETs, want 2", n)
+	}
+
+	digest, err := rg.DeleteManifest(ctx, srv.Host+"/akkuman/hello:2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := rg.GetTags(ctx, srv.Host+"/akkuman/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"2.12.1", "latest"}) {
+		t.Errorf("got tags %v after deleting %s", tags, digest)
+	}
+	_, err = rg.DeleteManifest(ctx, srv.Host+"/akkuman/hello:2.10")
+	if err == nil {
+		t.Error("deleted a missing tag")
+	}
+}
+
+func TestTag(t *testing.T) {
+	var blobGets atomic.Int32
+	handler := registry.New(registry.WithAuth(testUsername, testPassword))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			blobGets.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	srv := &registrytest.Server{Server: s, Host: strings.TrimPrefix(s.URL, "http://")}
+	registrytest.PushPackage(t, srv, testUsername, testPassword, "akkuman/hello", "2.10")
+	rg := NewRegistry(srv.Host, testUsername, testPassword, WithPlainHTTP())
+	ctx := context.Background()
+	refName := srv.Host + "/akkuman/hello:2.10"
+	sbom := filepath.Join(t.TempDir(), "sbom.spdx.json")
+	err := os.WriteFile(sbom, []byte(`{"spdxVersion":"SPDX-2.3"}`), 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbomDigest, err := rg.Attach(ctx, refName, &util.DefaultPlatform, sbom, Attachment{ArtifactType: "application/spdx+json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobGets.Store(0)
+
+	digest, err := rg.Tag(ctx, refName, []string{srv.Host + "/akkuman/hello:stable", srv.Host + "/stable/hello:2.10", srv.Host + "/stable/hello:stable"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := blobGets.Load(); n != 0 {
+		t.Errorf("tagging downloaded %d blobs", n)
+	}
+	for _, name := range []string{"akkuman/hello:2.10", "akkuman/hello:stable", "stable/hello:2.10", "stable/hello:stable"} {
+		got, err := rg.Digest(ctx, srv.Host+"/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != digest {
+			t.Errorf("%s: got digest %s, want %s", name, got, digest)
+		}
+	}
+	referrers, err := rg.Referrers(ctx, srv.Host+"/stable/hello:2.10", &util.DefaultPlatform, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sbomDigest {
+		t.Errorf("unexpected referrers of the promoted platform manifest %+v", referrers)
+	}
+	var buf strings.Builder
+	_, err = rg.DownloadReferrer(ctx, srv.Host+"/stable/hello:2.10", sbomDigest, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"spdxVersion":"SPDX-2.3"}` {
+		t.Errorf("unexpected promoted referrer %s", buf.String())
+	}
+
+	registrytest.PushPackage(t, srv, testUsername, testPassword, "akkuman/hello", "2.11")
+	immutable := WithImmutableTags(regexp.MustCompile(util.SemverRelease))
+	for range 2 {
+		_, err = rg.Tag(ctx, refName, []string{srv.Host + "/stable/hello:2.10.0"}, immutable)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = rg.Tag(ctx, srv.Host+"/akkuman/hello:2.11", []string{srv.Host + "/stable/hello:stable", srv.Host + "/stable/hello:2.10.0"}, immutable)
+	if !errors.Is(err, ErrImmutableTag) {
+		t.Errorf("moving an immutable tag: got %v, want %v", err, ErrImmutableTag)
+	}
+	if got, _ := rg.Digest(ctx, srv.Host+"/stable/hello:stable"); got != digest {
+		t.Errorf("a refused tag moved the other tags to %s", got)
+	}
+	newDigest, err := rg.Tag(ctx, srv.Host+"/akkuman/hello:2.11", []string{srv.Host + "/stable/hello:2.10.0"}, immutable, WithOverwrite())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rg.Digest(ctx, srv.Host+"/stable/hello:2.10.0"); got != newDigest || got == digest {
+		t.Errorf("overwriting an immutable tag: got digest %s, want %s", got, newDigest)
+	}
+
+	_, err = rg.Tag(ctx, refName, []string{"example.com/akkuman/hello:stable"})
+	if err == nil {
+		t.Error("tagged into another registry")
+	}
+	_, err = rg.Tag(ctx, srv.Host+"/akkuman/hello:missing", []string{srv.Host + "/akkuman/hello:stable"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing source: got %v, want not found", err)
+	}
+}
@@ -0,0 +1,119 @@
+package regctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/sign"
+	"github.com/regclient/regclient/types/descriptor"
+	"github.com/regclient/regclient/types/errs"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/mediatype"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/tidwall/gjson"
+)
+
+// PushSignature adds sig to the signatures of the manifest digest in the repository of refName,
+// they are the layers of the manifest tagged sha256-<hex>.sig like cosign does
+func (rg *Registry) PushSignature(ctx context.Context, refName string, digest string, sig sign.Signature) error {
+	r, err := ref.New(refName)
+	if err != nil {
+		return err
+	}
+	rSig := r.SetTag(sign.SignatureTag(digest))
+	rc := rg.getRegClient()
+	var layers []descriptor.Descriptor
+	m, err := rc.ManifestGet(ctx, rSig)
+	if err == nil {
+		mi, ok := m.(manifest.Imager)
+		if !ok {
+			return fmt.Errorf("%s is not an image manifest", rSig.CommonName())
+		}
+		layers, err = mi.GetLayers()
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, errs.ErrNotFound) {
+		return err
+	}
+	layer, err := rc.BlobPut(ctx, r, descriptor.Descriptor{}, bytes.NewReader(sig.Payload))
+	if err != nil {
+		return fmt.Errorf("push signature payload: %w", err)
+	}
+	layer.MediaType = sign.MediaTypeSimpleSigning
+	layer.Annotations = map[string]string{sign.AnnotationSignature: base64.StdEncoding.EncodeToString(sig.Signature)}
+	for _, x := range layers {
+		if x.Digest == layer.Digest && x.Annotations[sign.AnnotationSignature] == layer.Annotations[sign.AnnotationSignature] {
+			// signed already
+			return nil
+		}
+	}
+	layers = append(layers, layer)
+	diffIDs := make([]string, 0, len(layers))
+	for _, x := range layers {
+		diffIDs = append(diffIDs, x.Digest.String())
+	}
+	configData, err := json.Marshal(map[string]any{
+		"architecture": "",
+		"os":           "",
+		"config":       map[string]any{},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": diffIDs},
+	})
+	if err != nil {
+		return err
+	}
+	config, err := rc.BlobPut(ctx, r, descriptor.Descriptor{}, bytes.NewReader(configData))
+	if err != nil {
+		return fmt.Errorf("push signature config: %w", err)
+	}
+	config.MediaType = mediatype.OCI1ImageConfig
+	m, err = manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: mediatype.OCI1Manifest,
+		Config:    config,
+		Layers:    layers,
+	}))
+	if err != nil {
+		return err
+	}
+	err = rc.ManifestPut(ctx, rSig, m)
+	if err != nil {
+		return fmt.Errorf("push signature manifest: %w", err)
+	}
+	return nil
+}
+
+// Signatures returns the signatures of the manifest digest in the repository of refName,
+// it is empty when the manifest is not signed
+func (rg *AnonymousRegistry) Signatures(ctx context.Context, refName string, digest string) ([]sign.Signature, error) {
+	m, err := rg.GetImageManifest(ctx, refName, sign.SignatureTag(digest))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sigs []sign.Signature
+	for _, layer := range gjson.Get(m, "layers").Array() {
+		if layer.Get("mediaType").String() != sign.MediaTypeSimpleSigning {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(layer.Get(`annotations.dev\.cosignproject\.cosign/signature`).String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature of %s: %w", digest, err)
+		}
+		var payload bytes.Buffer
+		err = rg.DownloadBlob(ctx, refName, strings.TrimPrefix(layer.Get("digest").String(), "sha256:"), &payload)
+		if err != nil {
+			return nil, fmt.Errorf("download signature payload of %s: %w", digest, err)
+		}
+		sigs = append(sigs, sign.Signature{Payload: payload.Bytes(), Signature: signature})
+	}
+	return sigs, nil
+}
@@ -0,0 +1,227 @@
+package regctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/akkuman/blob-uploader/pkg/sign"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/descriptor"
+	"github.com/regclient/regclient/types/errs"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// ErrImmutableTag is returned when an immutable tag points to another digest already
+var ErrImmutableTag = errors.New("tag is immutable")
+
+type tagOptions struct {
+	immutableTags []*regexp.Regexp
+	overwrite     bool
+}
+
+type TagOption func(*tagOptions)
+
+// WithImmutableTags refuses to move the tags matching any of patterns once they point to a digest
+func WithImmutableTags(patterns ...*regexp.Regexp) TagOption {
+	return func(o *tagOptions) {
+		o.immutableTags = append(o.immutableTags, patterns...)
+	}
+}
+
+// WithOverwrite moves the immutable tags anyway
+func WithOverwrite() TagOption {
+	return func(o *tagOptions) {
+		o.overwrite = true
+	}
+}
+
+// immutable reports whether tag matches one of the immutable tag patterns
+func (o *tagOptions) immutable(tag string) bool {
+	for _, re := range o.immutableTags {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tag puts the manifest of srcRefName under every ref of dstRefNames and returns its digest, no blob is downloaded.
+// A ref in the repository of srcRefName only gets the new tag. A ref in another repository of the same registry
+// gets the platform manifests, the signatures and the referrers copied too, their blobs are mounted from the
+// repository of srcRefName.
+// The manifest is put unchanged so that its digest is kept, hence a moved tag doesn't record the digest it
+// pointed to in the dev.pkgforge.replaces.digest annotation like an upload does. Nothing is put when one of the
+// immutable tags points to another digest, unless WithOverwrite is given.
+func (rg *Registry) Tag(ctx context.Context, srcRefName string, dstRefNames []string, opts ...TagOption) (string, error) {
+	var opt tagOptions
+	for _, o := range opts {
+		o(&opt)
+	}
+	rSrc, err := ref.New(srcRefName)
+	if err != nil {
+		return "", err
+	}
+	rc := rg.getRegClient()
+	m, err := rc.ManifestGet(ctx, rSrc)
+	if errors.Is(err, errs.ErrNotFound) {
+		return "", fmt.Errorf("%s: %w", srcRefName, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	digest := m.GetDescriptor().Digest.String()
+	rDsts := make([]ref.Ref, 0, len(dstRefNames))
+	for _, dstRefName := range dstRefNames {
+		rDst, err := ref.New(dstRefName)
+		if err != nil {
+			return "", err
+		}
+		if rDst.Digest != "" || rDst.Tag == "" {
+			return "", fmt.Errorf("%s: a tag is required", dstRefName)
+		}
+		if rDst.Registry != rSrc.Registry {
+			return "", fmt.Errorf("%s: blobs can only be mounted within a registry, not from %s", dstRefName, rSrc.Registry)
+		}
+		if opt.immutable(rDst.Tag) && !opt.overwrite {
+			dstDigest, err := rg.Digest(ctx, rDst.CommonName())
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return "", err
+			}
+			if err == nil && dstDigest != digest {
+				return "", fmt.Errorf("%s points to %s already, refusing to overwrite it: %w", rDst.CommonName(), dstDigest, ErrImmutableTag)
+			}
+		}
+		rDsts = append(rDsts, rDst)
+	}
+	// the copies of every destination repository, so that tags in the same repository copy once
+	copiers := make(map[string]*copier)
+	for _, rDst := range rDsts {
+		if !ref.EqualRepository(rSrc, rDst) {
+			repo := rDst.SetTag("").CommonName()
+			c, ok := copiers[repo]
+			if !ok {
+				c = &copier{rc: rc, src: rSrc.SetTag(""), dst: rDst.SetTag(""), copied: make(map[string]bool)}
+				copiers[repo] = c
+			}
+			err = c.copyManifest(ctx, m, false)
+			if err != nil {
+				return "", fmt.Errorf("copy %s to %s: %w", digest, repo, err)
+			}
+		}
+		err = rc.ManifestPut(ctx, rDst, m)
+		if err != nil {
+			return "", fmt.Errorf("put %s: %w", rDst.CommonName(), err)
+		}
+	}
+	return digest, nil
+}
+
+// copier copies manifests from the repository src to the repository dst of the same registry
+type copier struct {
+	rc  *regclient.RegClient
+	src ref.Ref
+	dst ref.Ref
+	// copied are the digests of the manifests copied already
+	copied map[string]bool
+}
+
+// copyManifest puts m in dst by digest after its platform manifests and its blobs, then copies its
+// signatures and referrers
+func (c *copier) copyManifest(ctx context.Context, m manifest.Manifest, child bool) error {
+	digest := m.GetDescriptor().Digest.String()
+	if c.copied[digest] {
+		return nil
+	}
+	if m.IsList() {
+		descs, err := m.GetManifestList()
+		if err != nil {
+			return err
+		}
+		for _, d := range descs {
+			cm, err := c.rc.ManifestGet(ctx, c.src.SetDigest(d.Digest.String()))
+			if err != nil {
+				return err
+			}
+			err = c.copyManifest(ctx, cm, true)
+			if err != nil {
+				return err
+			}
+		}
+	} else if mi, ok := m.(manifest.Imager); ok {
+		err := c.mountBlobs(ctx, mi)
+		if err != nil {
+			return err
+		}
+	}
+	var opts []regclient.ManifestOpts
+	if child {
+		opts = append(opts, regclient.WithManifestChild())
+	}
+	err := c.rc.ManifestPut(ctx, c.dst.SetDigest(digest), m, opts...)
+	if err != nil {
+		return fmt.Errorf("put manifest %s: %w", digest, err)
+	}
+	c.copied[digest] = true
+	return c.copyArtifacts(ctx, digest)
+}
+
+// copyArtifacts copies the signatures (the sha256-<hex>.sig tag) and the referrers of the manifest digest
+func (c *copier) copyArtifacts(ctx context.Context, digest string) error {
+	sigTag := sign.SignatureTag(digest)
+	sm, err := c.rc.ManifestGet(ctx, c.src.SetTag(sigTag))
+	if err == nil {
+		if mi, ok := sm.(manifest.Imager); ok {
+			err = c.mountBlobs(ctx, mi)
+			if err != nil {
+				return err
+			}
+		}
+		err = c.rc.ManifestPut(ctx, c.dst.SetTag(sigTag), sm)
+		if err != nil {
+			return fmt.Errorf("put signatures %s: %w", sigTag, err)
+		}
+	} else if !errors.Is(err, errs.ErrNotFound) {
+		return err
+	}
+	rl, err := c.rc.ReferrerList(ctx, c.src.SetDigest(digest))
+	if err != nil {
+		return fmt.Errorf("list referrers of %s: %w", digest, err)
+	}
+	for _, d := range rl.Descriptors {
+		rm, err := c.rc.ManifestGet(ctx, c.src.SetDigest(d.Digest.String()))
+		if err != nil {
+			return err
+		}
+		err = c.copyManifest(ctx, rm, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountBlobs mounts the config and the layers of mi from src to dst unless dst has them already
+func (c *copier) mountBlobs(ctx context.Context, mi manifest.Imager) error {
+	layers, err := mi.GetLayers()
+	if err != nil {
+		return err
+	}
+	blobs := layers
+	if config, err := mi.GetConfig(); err == nil {
+		blobs = append([]descriptor.Descriptor{config}, layers...)
+	}
+	for _, d := range blobs {
+		if br, err := c.rc.BlobHead(ctx, c.dst, d); err == nil {
+			br.Close()
+			continue
+		}
+		err = c.rc.BlobMount(ctx, c.src, c.dst, d)
+		if err != nil {
+			return fmt.Errorf("mount blob %s from %s: %w", d.Digest, c.src.CommonName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/akkuman/blob-uploader/oci"
+)
+
+// dirStore keeps every repository as an OCI layout in root/<repository>, tags are the
+// org.opencontainers.image.ref.name of the index.json entries and untagged manifests
+// are listed without it, so that a layout pushed to the registry can also be read as
+// ocidir://<root>:<repository>
+type dirStore struct {
+	root string
+	mu   sync.Mutex
+}
+
+var _ Store = &dirStore{}
+
+// NewDirStore returns a Store keeping the repositories as OCI layouts in root
+func NewDirStore(root string) (Store, error) {
+	err := os.MkdirAll(root, 0775)
+	if err != nil {
+		return nil, err
+	}
+	return &dirStore{root: root}, nil
+}
+
+func (s *dirStore) layoutDir(repo string) string {
+	return filepath.Join(s.root, filepath.FromSlash(repo))
+}
+
+func (s *dirStore) blobPath(repo string, digest string) string {
+	return filepath.Join(s.layoutDir(repo), "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+func (s *dirStore) exists(repo string) bool {
+	_, err := os.Stat(filepath.Join(s.layoutDir(repo), "oci-layout"))
+	return err == nil
+}
+
+// initLayout creates the layout of repo if it doesn't exist
+func (s *dirStore) initLayout(repo string) error {
+	if s.exists(repo) {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Join(s.layoutDir(repo), "blobs", "sha256"), 0775)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(s.layoutDir(repo), "index.json"), strings.NewReader(`{"schemaVersion":2,"manifests":[]}`))
+	if err != nil {
+		return err
+	}
+	layout, err := json.Marshal(oci.ImageLayout{Version: oci.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.layoutDir(repo), "oci-layout"), strings.NewReader(string(layout)))
+}
+
+// writeFileAtomic writes r to a temp file renamed to name, so that readers never see partial content
+func writeFileAtomic(name string, r io.Reader) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (s *dirStore) readIndex(repo string) (*oci.Index, error) {
+	if !s.exists(repo) {
+		return nil, ErrNameUnknown
+	}
+	data, err := os.ReadFile(filepath.Join(s.layoutDir(repo), "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	index := &oci.Index{}
+	return index, json.Unmarshal(data, index)
+}
+
+func (s *dirStore) writeIndex(repo string, index *oci.Index) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.layoutDir(repo), "index.json"), strings.NewReader(string(data)))
+}
+
+func (s *dirStore) GetBlob(ctx context.Context, repo string, digest string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(s.blobPath(repo, digest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobUnknown
+	}
+	return f, err
+}
+
+func (s *dirStore) PutBlob(ctx context.Context, repo string, digest string, r io.Reader) error {
+	s.mu.Lock()
+	err := s.initLayout(repo)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.blobPath(repo, digest), r)
+}
+
+func (s *dirStore) MountBlob(ctx context.Context, repo string, from string, digest string) error {
+	f, err := s.GetBlob(ctx, from, digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s.mu.Lock()
+	err = s.initLayout(repo)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// blobs are immutable so they can be shared with a hard link
+	if os.Link(s.blobPath(from, digest), s.blobPath(repo, digest)) == nil {
+		return nil
+	}
+	return writeFileAtomic(s.blobPath(repo, digest), f)
+}
+
+func (s *dirStore) DeleteBlob(ctx context.Context, repo string, digest string) error {
+	err := os.Remove(s.blobPath(repo, digest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobUnknown
+	}
+	return err
+}
+
+// manifest reads the manifest of the index.json entry d
+func (s *dirStore) manifest(repo string, d oci.Descriptor) (*Manifest, error) {
+	data, err := os.ReadFile(s.blobPath(repo, d.Digest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrManifestUnknown
+	}
+	if err != nil {
+		return nil, err
+	}
+	var content manifestContent
+	err = json.Unmarshal(data, &content)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		MediaType:    d.MediaType,
+		Digest:       d.Digest,
+		Data:         data,
+		ArtifactType: d.ArtifactType,
+		Annotations:  content.Annotations,
+	}
+	if content.Subject != nil {
+		m.Subject = content.Subject.Digest
+	}
+	return m, nil
+}
+
+func (s *dirStore) GetManifest(ctx context.Context, repo string, reference string) (*Manifest, error) {
+	index, err := s.readIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range index.Manifests {
+		if d.Digest == reference || d.Annotations[oci.AnnotationRefName] == reference {
+			return s.manifest(repo, d)
+		}
+	}
+	return nil, ErrManifestUnknown
+}
+
+func (s *dirStore) PutManifest(ctx context.Context, repo string, tag string, m *Manifest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.initLayout(repo)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(s.blobPath(repo, m.Digest), strings.NewReader(string(m.Data)))
+	if err != nil {
+		return err
+	}
+	index, err := s.readIndex(repo)
+	if err != nil {
+		return err
+	}
+	d := oci.Descriptor{
+		MediaType:    m.MediaType,
+		ArtifactType: m.ArtifactType,
+		Digest:       m.Digest,
+		Size:         int64(len(m.Data)),
+	}
+	if tag == "" {
+		if slices.ContainsFunc(index.Manifests, func(x oci.Descriptor) bool { return x.Digest == m.Digest }) {
+			return nil
+		}
+	} else {
+		d.Annotations = map[string]string{oci.AnnotationRefName: tag}
+		// the tag moves to the new manifest, which is no longer listed untagged
+		index.Manifests = slices.DeleteFunc(index.Manifests, func(x oci.Descriptor) bool {
+			name, tagged := x.Annotations[oci.AnnotationRefName]
+			return name == tag || (!tagged && x.Digest == m.Digest)
+		})
+	}
+	index.Manifests = append(index.Manifests, d)
+	return s.writeIndex(repo, index)
+}
+
+func (s *dirStore) DeleteManifest(ctx context.Context, repo string, reference string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.readIndex(repo)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(index.Manifests, func(x oci.Descriptor) bool {
+		return x.Annotations[oci.AnnotationRefName] == reference
+	})
+	if i >= 0 {
+		// untagging keeps the manifest available by digest
+		untagged := index.Manifests[i]
+		index.Manifests = slices.Delete(index.Manifests, i, i+1)
+		if !slices.ContainsFunc(index.Manifests, func(x oci.Descriptor) bool { return x.Digest == untagged.Digest }) {
+			untagged.Annotations = maps.Clone(untagged.Annotations)
+			delete(untagged.Annotations, oci.AnnotationRefName)
+			index.Manifests = append(index.Manifests, untagged)
+		}
+		return s.writeIndex(repo, index)
+	}
+	n := len(index.Manifests)
+	index.Manifests = slices.DeleteFunc(index.Manifests, func(x oci.Descriptor) bool {
+		return x.Digest == reference
+	})
+	if len(index.Manifests) == n {
+		return ErrManifestUnknown
+	}
+	err = s.writeIndex(repo, index)
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.blobPath(repo, reference))
+}
+
+func (s *dirStore) Tags(ctx context.Context, repo string) ([]string, error) {
+	index, err := s.readIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, d := range index.Manifests {
+		if tag, ok := d.Annotations[oci.AnnotationRefName]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	return tags, nil
+}
+
+func (s *dirStore) Referrers(ctx context.Context, repo string, digest string) ([]*Manifest, error) {
+	index, err := s.readIndex(repo)
+	if errors.Is(err, ErrNameUnknown) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var referrers []*Manifest
+	seen := make(map[string]bool)
+	for _, d := range index.Manifests {
+		if seen[d.Digest] {
+			continue
+		}
+		seen[d.Digest] = true
+		m, err := s.manifest(repo, d)
+		if err != nil {
+			return nil, err
+		}
+		if m.Subject == digest {
+			referrers = append(referrers, m)
+		}
+	}
+	slices.SortFunc(referrers, func(a, b *Manifest) int {
+		return strings.Compare(a.Digest, b.Digest)
+	})
+	return referrers, nil
+}
+
+func (s *dirStore) Repositories(ctx context.Context) ([]string, error) {
+	var repos []string
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == "blobs" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		repo := filepath.ToSlash(rel)
+		if rel != "." && nameRegexp.MatchString(repo) && s.exists(repo) {
+			repos = append(repos, repo)
+		}
+		return nil
+	})
+	slices.Sort(repos)
+	return repos, err
+}
@@ -0,0 +1,760 @@
+// Package registry implements an OCI distribution server, see
+// https://github.com/opencontainers/distribution-spec/blob/v1.1.0/spec.md
+package registry
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList    = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerImage   = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// maxManifestSize is the limit of manifests recommended by the distribution spec
+	maxManifestSize = 4 << 20
+
+	// tokenTTL is the lifetime of the tokens issued by the /token endpoint
+	tokenTTL = time.Hour
+	// uploadTTL is how long an upload session is kept after its last write before it is discarded
+	uploadTTL = time.Hour
+)
+
+var (
+	routeRegexp  = regexp.MustCompile(`^/v2/(.+)/(blobs/uploads|blobs|manifests|tags|referrers)/(.*)$`)
+	nameRegexp   = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+	tagRegexp    = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// validName reports whether repo is a valid repository name. A name can't have a blobs component,
+// the layout of a repository in a DirStore holds the layouts of the nested repositories, so a/blobs/sha256
+// would be the blob directory of a.
+func validName(repo string) bool {
+	if !nameRegexp.MatchString(repo) {
+		return false
+	}
+	for _, part := range strings.Split(repo, "/") {
+		if part == "blobs" {
+			return false
+		}
+	}
+	return true
+}
+
+// Registry is an http.Handler serving the OCI distribution API.
+// Pulls are anonymous, pushes and deletes require credentials when WithAuth or WithBasicAuth is given.
+type Registry struct {
+	store     Store
+	username  string
+	password  string
+	basicAuth bool
+	// noReferrers hides the referrers API like registries predating OCI 1.1
+	noReferrers bool
+
+	// now is time.Now, tests change it to expire tokens and uploads
+	now func() time.Time
+
+	// mu guards tokens and uploads, it is never held during I/O
+	mu sync.Mutex
+	// tokens are the issued tokens and their expiry
+	tokens  map[string]time.Time
+	uploads map[string]*upload
+}
+
+// upload is a blob upload session, the content is staged in a temp file until the digest is verified
+type upload struct {
+	repo string
+
+	// mu serializes the writes of the chunks, removed is set once the session is finished or discarded
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	removed bool
+	// updated is the time of the last write, a stale session is discarded with its temp file
+	updated time.Time
+}
+
+type Option func(*Registry)
+
+// WithStore keeps the content in store instead of memory
+func WithStore(store Store) Option {
+	return func(rg *Registry) {
+		rg.store = store
+	}
+}
+
+// WithAuth requires a token issued for username and password to push and delete, tokens are
+// issued by the /token endpoint advertised in the WWW-Authenticate challenge
+func WithAuth(username string, password string) Option {
+	return func(rg *Registry) {
+		rg.username = username
+		rg.password = password
+	}
+}
+
+// WithBasicAuth requires the basic authorization of username and password to push and delete
+func WithBasicAuth(username string, password string) Option {
+	return func(rg *Registry) {
+		rg.username = username
+		rg.password = password
+		rg.basicAuth = true
+	}
+}
+
+// WithoutReferrersAPI behaves like registries predating OCI 1.1, the referrers API is not found
+// and the OCI-Subject header is not returned, so that clients fall back to the tag schema
+func WithoutReferrersAPI() Option {
+	return func(rg *Registry) {
+		rg.noReferrers = true
+	}
+}
+
+func New(opts ...Option) *Registry {
+	rg := &Registry{
+		store:   NewMemoryStore(),
+		now:     time.Now,
+		tokens:  make(map[string]time.Time),
+		uploads: make(map[string]*upload),
+	}
+	for _, o := range opts {
+		o(rg)
+	}
+	return rg
+}
+
+// https://github.com/opencontainers/distribution-spec/blob/v1.1.0/spec.md#error-codes
+type regError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *regError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func newError(status int, code string, format string, a ...any) *regError {
+	return &regError{status: status, Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var e *regError
+	if !errors.As(err, &e) {
+		switch {
+		case errors.Is(err, ErrBlobUnknown):
+			e = newError(http.StatusNotFound, "BLOB_UNKNOWN", "%v", err)
+		case errors.Is(err, ErrManifestUnknown):
+			e = newError(http.StatusNotFound, "MANIFEST_UNKNOWN", "%v", err)
+		case errors.Is(err, ErrNameUnknown):
+			e = newError(http.StatusNotFound, "NAME_UNKNOWN", "%v", err)
+		default:
+			e = newError(http.StatusInternalServerError, "UNKNOWN", "%v", err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(map[string][]*regError{"errors": {e}})
+}
+
+func (rg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if r.URL.Path == "/token" {
+		rg.serveToken(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v2/") {
+		http.NotFound(w, r)
+		return
+	}
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if r.URL.Path == "/v2/" {
+		// a client logs in by requesting /v2/ so it is checked as a write
+		readOnly = false
+	}
+	if !readOnly && !rg.authorized(r) {
+		rg.challenge(w, r)
+		return
+	}
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.URL.Path == "/v2/_catalog" && readOnly {
+		if err := rg.listRepositories(w, r); err != nil {
+			writeError(w, err)
+		}
+		return
+	}
+	m := routeRegexp.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	repo, kind, rest := m[1], m[2], m[3]
+	if !validName(repo) {
+		writeError(w, newError(http.StatusBadRequest, "NAME_INVALID", "invalid repository name %s", repo))
+		return
+	}
+	// references are checked here as the stores use them in file paths
+	if kind == "blobs" && !digestRegexp.MatchString(rest) {
+		writeError(w, newError(http.StatusBadRequest, "DIGEST_INVALID", "unsupported digest %q", rest))
+		return
+	}
+	if kind == "manifests" && !digestRegexp.MatchString(rest) && !tagRegexp.MatchString(rest) {
+		writeError(w, newError(http.StatusBadRequest, "MANIFEST_INVALID", "invalid reference %q", rest))
+		return
+	}
+	var err error
+	switch {
+	case kind == "blobs/uploads" && r.Method == http.MethodPost && rest == "":
+		err = rg.startUpload(w, r, repo)
+	case kind == "blobs/uploads" && r.Method == http.MethodPatch:
+		err = rg.patchUpload(w, r, repo, rest)
+	case kind == "blobs/uploads" && r.Method == http.MethodPut:
+		err = rg.finishUpload(w, r, repo, rest)
+	case kind == "blobs/uploads" && r.Method == http.MethodGet:
+		err = rg.uploadStatus(w, r, repo, rest)
+	case kind == "blobs/uploads" && r.Method == http.MethodDelete:
+		err = rg.cancelUpload(w, r, repo, rest)
+	case kind == "blobs" && readOnly:
+		err = rg.getBlob(w, r, repo, rest)
+	case kind == "blobs" && r.Method == http.MethodDelete:
+		err = rg.store.DeleteBlob(r.Context(), repo, rest)
+		if err == nil {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	case kind == "manifests" && readOnly:
+		err = rg.getManifest(w, r, repo, rest)
+	case kind == "manifests" && r.Method == http.MethodPut:
+		err = rg.putManifest(w, r, repo, rest)
+	case kind == "manifests" && r.Method == http.MethodDelete:
+		err = rg.store.DeleteManifest(r.Context(), repo, rest)
+		if err == nil {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	case kind == "tags" && rest == "list" && readOnly:
+		err = rg.listTags(w, r, repo)
+	case kind == "referrers" && readOnly && rg.noReferrers:
+		err = newError(http.StatusNotFound, "NOT_FOUND", "the referrers API is not supported")
+	case kind == "referrers" && readOnly:
+		err = rg.listReferrers(w, r, repo, rest)
+	default:
+		err = newError(http.StatusMethodNotAllowed, "UNSUPPORTED", "%s %s is not supported", r.Method, r.URL.Path)
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+func (rg *Registry) authorized(r *http.Request) bool {
+	if rg.username == "" {
+		return true
+	}
+	if rg.basicAuth {
+		username, password, ok := r.BasicAuth()
+		return ok && rg.validCredentials(username, password)
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	expiry, ok := rg.tokens[token]
+	return ok && rg.now().Before(expiry)
+}
+
+func (rg *Registry) validCredentials(username string, password string) bool {
+	validUsername := subtle.ConstantTimeCompare([]byte(username), []byte(rg.username)) == 1
+	validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(rg.password)) == 1
+	return validUsername && validPassword
+}
+
+func (rg *Registry) challenge(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if rg.basicAuth {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, r.Host))
+	} else {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s://%s/token",service="%s"`, scheme, r.Host, r.Host))
+	}
+	writeError(w, newError(http.StatusUnauthorized, "UNAUTHORIZED", "authentication required"))
+}
+
+// serveToken issues a token for the credentials of the basic authorization header,
+// https://distribution.github.io/distribution/spec/auth/token/
+func (rg *Registry) serveToken(w http.ResponseWriter, r *http.Request) {
+	if rg.basicAuth {
+		http.NotFound(w, r)
+		return
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok || !rg.validCredentials(username, password) {
+		writeError(w, newError(http.StatusUnauthorized, "UNAUTHORIZED", "invalid username or password"))
+		return
+	}
+	token := randomID()
+	now := rg.now()
+	rg.prune(now)
+	rg.mu.Lock()
+	rg.tokens[token] = now.Add(tokenTTL)
+	rg.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"token":        token,
+		"access_token": token,
+		"expires_in":   int(tokenTTL.Seconds()),
+		"issued_at":    now.UTC().Format(time.RFC3339),
+	})
+}
+
+// prune forgets the expired tokens and discards the upload sessions not written for uploadTTL,
+// it is called whenever a token or a session is added so that neither grows without bound
+func (rg *Registry) prune(now time.Time) {
+	var stale []*upload
+	rg.mu.Lock()
+	for token, expiry := range rg.tokens {
+		if !now.Before(expiry) {
+			delete(rg.tokens, token)
+		}
+	}
+	for id, u := range rg.uploads {
+		// a session being written is locked and isn't stale
+		if !u.mu.TryLock() {
+			continue
+		}
+		if now.Sub(u.updated) >= uploadTTL {
+			delete(rg.uploads, id)
+			stale = append(stale, u)
+		}
+		u.mu.Unlock()
+	}
+	rg.mu.Unlock()
+	for _, u := range stale {
+		u.remove()
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (rg *Registry) startUpload(w http.ResponseWriter, r *http.Request, repo string) error {
+	query := r.URL.Query()
+	if digest, from := query.Get("mount"), query.Get("from"); digest != "" && from != "" {
+		err := rg.store.MountBlob(r.Context(), repo, from, digest)
+		if err == nil {
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, digest))
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+			return nil
+		}
+		if !errors.Is(err, ErrBlobUnknown) {
+			return err
+		}
+		// fall back to a regular upload
+	}
+	u, err := newUpload(repo, rg.now())
+	if err != nil {
+		return err
+	}
+	if digest := query.Get("digest"); digest != "" {
+		defer u.remove()
+		if err := u.write(r.Body, rg.now); err != nil {
+			return err
+		}
+		return rg.putBlob(w, r, u, digest)
+	}
+	rg.prune(rg.now())
+	id := randomID()
+	rg.mu.Lock()
+	rg.uploads[id] = u
+	rg.mu.Unlock()
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.Header().Set("Range", "0-0")
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func newUpload(repo string, now time.Time) (*upload, error) {
+	f, err := os.CreateTemp("", "registry-upload")
+	if err != nil {
+		return nil, err
+	}
+	return &upload{repo: repo, file: f, updated: now}, nil
+}
+
+// write appends r to the staged content, u.mu must be held once the session is listed in uploads
+func (u *upload) write(r io.Reader, now func() time.Time) error {
+	if u.removed {
+		return newError(http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload is finished or expired")
+	}
+	n, err := io.Copy(u.file, r)
+	u.size += n
+	u.updated = now()
+	return err
+}
+
+func (u *upload) remove() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.removed {
+		return
+	}
+	u.removed = true
+	u.file.Close()
+	os.Remove(u.file.Name())
+}
+
+func (rg *Registry) getUpload(repo string, id string) (*upload, error) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	u, ok := rg.uploads[id]
+	if !ok || u.repo != repo {
+		return nil, newError(http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload %s not found", id)
+	}
+	return u, nil
+}
+
+func (rg *Registry) writeUploadStatus(w http.ResponseWriter, repo string, id string, u *upload, status int) {
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", max(u.size-1, 0)))
+	w.WriteHeader(status)
+}
+
+func (rg *Registry) patchUpload(w http.ResponseWriter, r *http.Request, repo string, id string) error {
+	u, err := rg.getUpload(repo, id)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		start, _, _ := strings.Cut(contentRange, "-")
+		if offset, err := strconv.ParseInt(start, 10, 64); err != nil || offset != u.size {
+			return newError(http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", "chunk must start at %d", u.size)
+		}
+	}
+	if err := u.write(r.Body, rg.now); err != nil {
+		return err
+	}
+	rg.writeUploadStatus(w, repo, id, u, http.StatusAccepted)
+	return nil
+}
+
+func (rg *Registry) uploadStatus(w http.ResponseWriter, r *http.Request, repo string, id string) error {
+	u, err := rg.getUpload(repo, id)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	rg.writeUploadStatus(w, repo, id, u, http.StatusNoContent)
+	return nil
+}
+
+func (rg *Registry) cancelUpload(w http.ResponseWriter, r *http.Request, repo string, id string) error {
+	u, err := rg.getUpload(repo, id)
+	if err != nil {
+		return err
+	}
+	rg.mu.Lock()
+	delete(rg.uploads, id)
+	rg.mu.Unlock()
+	u.remove()
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (rg *Registry) finishUpload(w http.ResponseWriter, r *http.Request, repo string, id string) error {
+	u, err := rg.getUpload(repo, id)
+	if err != nil {
+		return err
+	}
+	rg.mu.Lock()
+	delete(rg.uploads, id)
+	rg.mu.Unlock()
+	defer u.remove()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.write(r.Body, rg.now); err != nil {
+		return err
+	}
+	return rg.putBlob(w, r, u, r.URL.Query().Get("digest"))
+}
+
+// putBlob verifies the digest of the staged upload and moves it to the store
+func (rg *Registry) putBlob(w http.ResponseWriter, r *http.Request, u *upload, digest string) error {
+	repo := u.repo
+	if !digestRegexp.MatchString(digest) {
+		return newError(http.StatusBadRequest, "DIGEST_INVALID", "unsupported digest %q", digest)
+	}
+	if _, err := u.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, u.file); err != nil {
+		return err
+	}
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != digest {
+		return newError(http.StatusBadRequest, "DIGEST_INVALID", "digest of the content is %s, not %s", got, digest)
+	}
+	if _, err := u.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	err := rg.store.PutBlob(r.Context(), repo, digest, u.file)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, digest))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (rg *Registry) getBlob(w http.ResponseWriter, r *http.Request, repo string, digest string) error {
+	blob, err := rg.store.GetBlob(r.Context(), repo, digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	http.ServeContent(w, r, "", time.Time{}, blob)
+	return nil
+}
+
+func (rg *Registry) getManifest(w http.ResponseWriter, r *http.Request, repo string, reference string) error {
+	m, err := rg.store.GetManifest(r.Context(), repo, reference)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", m.MediaType)
+	w.Header().Set("Docker-Content-Digest", m.Digest)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.Data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(m.Data)
+	}
+	return nil
+}
+
+// manifestContent holds the fields of manifests and indexes checked by the registry
+type manifestContent struct {
+	MediaType    string `json:"mediaType"`
+	ArtifactType string `json:"artifactType"`
+	Config       *struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		Digest string `json:"digest"`
+	} `json:"layers"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+	Subject *struct {
+		Digest string `json:"digest"`
+	} `json:"subject"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (rg *Registry) putManifest(w http.ResponseWriter, r *http.Request, repo string, reference string) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxManifestSize {
+		return newError(http.StatusRequestEntityTooLarge, "SIZE_INVALID", "manifest exceeds %d bytes", maxManifestSize)
+	}
+	var content manifestContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return newError(http.StatusBadRequest, "MANIFEST_INVALID", "%v", err)
+	}
+	m := &Manifest{
+		MediaType:    r.Header.Get("Content-Type"),
+		Digest:       sha256Digest(data),
+		Data:         data,
+		ArtifactType: content.ArtifactType,
+		Annotations:  content.Annotations,
+	}
+	if content.MediaType != "" && content.MediaType != m.MediaType {
+		return newError(http.StatusBadRequest, "MANIFEST_INVALID", "mediaType %s differs from Content-Type %s", content.MediaType, m.MediaType)
+	}
+	var tag string
+	if strings.HasPrefix(reference, "sha256:") {
+		if reference != m.Digest {
+			return newError(http.StatusBadRequest, "DIGEST_INVALID", "digest of the manifest is %s, not %s", m.Digest, reference)
+		}
+	} else if tagRegexp.MatchString(reference) {
+		tag = reference
+	} else {
+		return newError(http.StatusBadRequest, "TAG_INVALID", "invalid tag %q", reference)
+	}
+	// every content referenced by the manifest must be pushed before
+	switch m.MediaType {
+	case mediaTypeImageManifest, mediaTypeDockerImage:
+		if content.Config == nil {
+			return newError(http.StatusBadRequest, "MANIFEST_INVALID", "manifest without config")
+		}
+		if m.ArtifactType == "" {
+			m.ArtifactType = content.Config.MediaType
+		}
+		digests := []string{content.Config.Digest}
+		for _, layer := range content.Layers {
+			digests = append(digests, layer.Digest)
+		}
+		for _, digest := range digests {
+			blob, err := rg.store.GetBlob(r.Context(), repo, digest)
+			if err != nil {
+				return newError(http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "blob %s is unknown", digest)
+			}
+			blob.Close()
+		}
+	case mediaTypeImageIndex, mediaTypeDockerList:
+		for _, child := range content.Manifests {
+			if _, err := rg.store.GetManifest(r.Context(), repo, child.Digest); err != nil {
+				return newError(http.StatusBadRequest, "MANIFEST_UNKNOWN", "manifest %s is unknown", child.Digest)
+			}
+		}
+	default:
+		return newError(http.StatusBadRequest, "MANIFEST_INVALID", "unsupported media type %q", m.MediaType)
+	}
+	if content.Subject != nil {
+		m.Subject = content.Subject.Digest
+		if !rg.noReferrers {
+			w.Header().Set("OCI-Subject", m.Subject)
+		}
+	}
+	err = rg.store.PutManifest(r.Context(), repo, tag, m)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", repo, m.Digest))
+	w.Header().Set("Docker-Content-Digest", m.Digest)
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (rg *Registry) listRepositories(w http.ResponseWriter, r *http.Request) error {
+	repos, err := rg.store.Repositories(r.Context())
+	if err != nil {
+		return err
+	}
+	repos, link := paginate(repos, r.URL.Query())
+	if link != "" {
+		w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?%s>; rel="next"`, link))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]any{
+		"repositories": repos,
+	})
+}
+
+// paginate returns the page of the sorted list selected by the query parameters n and last,
+// and the query of the next page if any
+func paginate(list []string, query url.Values) ([]string, string) {
+	if last := query.Get("last"); last != "" {
+		i := 0
+		for i < len(list) && list[i] <= last {
+			i++
+		}
+		list = list[i:]
+	}
+	n, err := strconv.Atoi(query.Get("n"))
+	if err != nil || n < 0 || n >= len(list) {
+		return list, ""
+	}
+	list = list[:n]
+	if n == 0 {
+		return list, ""
+	}
+	return list, fmt.Sprintf("n=%d&last=%s", n, url.QueryEscape(list[n-1]))
+}
+
+func (rg *Registry) listTags(w http.ResponseWriter, r *http.Request, repo string) error {
+	tags, err := rg.store.Tags(r.Context(), repo)
+	if err != nil {
+		return err
+	}
+	tags, link := paginate(tags, r.URL.Query())
+	if link != "" {
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?%s>; rel="next"`, repo, link))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]any{
+		"name": repo,
+		"tags": tags,
+	})
+}
+
+type descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int               `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// listReferrers implements
+// https://github.com/opencontainers/distribution-spec/blob/v1.1.0/spec.md#listing-referrers
+func (rg *Registry) listReferrers(w http.ResponseWriter, r *http.Request, repo string, digest string) error {
+	if !digestRegexp.MatchString(digest) {
+		return newError(http.StatusBadRequest, "DIGEST_INVALID", "invalid digest %q", digest)
+	}
+	referrers, err := rg.store.Referrers(r.Context(), repo, digest)
+	if err != nil {
+		return err
+	}
+	artifactType := r.URL.Query().Get("artifactType")
+	manifests := []descriptor{}
+	for _, m := range referrers {
+		if artifactType != "" && m.ArtifactType != artifactType {
+			continue
+		}
+		manifests = append(manifests, descriptor{
+			MediaType:    m.MediaType,
+			ArtifactType: m.ArtifactType,
+			Digest:       m.Digest,
+			Size:         len(m.Data),
+			Annotations:  m.Annotations,
+		})
+	}
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	w.Header().Set("Content-Type", mediaTypeImageIndex)
+	return json.NewEncoder(w).Encode(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeImageIndex,
+		"manifests":     manifests,
+	})
+}
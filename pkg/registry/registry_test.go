@@ -0,0 +1,379 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type client struct {
+	t     *testing.T
+	url   string
+	token string
+}
+
+func newClient(t *testing.T, opts ...Option) *client {
+	srv := httptest.NewServer(New(opts...))
+	t.Cleanup(srv.Close)
+	return &client{t: t, url: srv.URL}
+}
+
+// eachStore runs fn against a registry backed by every Store
+func eachStore(t *testing.T, fn func(t *testing.T, c *client)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, newClient(t))
+	})
+	t.Run("dir", func(t *testing.T) {
+		store, err := NewDirStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(t, newClient(t, WithStore(store)))
+	})
+}
+
+func (c *client) do(method string, path string, headers map[string]string, body []byte) *http.Response {
+	c.t.Helper()
+	url := path
+	if strings.HasPrefix(path, "/") {
+		url = c.url + path
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (c *client) expect(resp *http.Response, status int) []byte {
+	c.t.Helper()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status {
+		c.t.Fatalf("%s %s: status %d != %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, data)
+	}
+	return data
+}
+
+// pushBlob pushes data with a monolithic upload and returns its digest
+func (c *client) pushBlob(repo string, data []byte) string {
+	c.t.Helper()
+	digest := sha256Digest(data)
+	c.expect(c.do(http.MethodPost, fmt.Sprintf("/v2/%s/blobs/uploads/?digest=%s", repo, digest), nil, data), http.StatusCreated)
+	return digest
+}
+
+func (c *client) pushManifest(repo string, reference string, mediaType string, v any) (string, *http.Response) {
+	c.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	resp := c.do(http.MethodPut, fmt.Sprintf("/v2/%s/manifests/%s", repo, reference), map[string]string{"Content-Type": mediaType}, data)
+	c.expect(resp, http.StatusCreated)
+	return sha256Digest(data), resp
+}
+
+func (c *client) pushImage(repo string, tag string, subject string) string {
+	c.t.Helper()
+	configDigest := c.pushBlob(repo, []byte("{}"))
+	layerDigest := c.pushBlob(repo, []byte(repo+tag+subject))
+	manifest := map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeImageManifest,
+		"artifactType":  "application/vnd.example.sig",
+		"config":        map[string]any{"mediaType": "application/vnd.oci.empty.v1+json", "digest": configDigest, "size": 2},
+		"layers":        []any{map[string]any{"mediaType": "application/octet-stream", "digest": layerDigest, "size": 1}},
+	}
+	if subject != "" {
+		manifest["subject"] = map[string]any{"mediaType": mediaTypeImageManifest, "digest": subject, "size": 1}
+	}
+	reference := tag
+	if reference == "" {
+		data, _ := json.Marshal(manifest)
+		reference = sha256Digest(data)
+	}
+	digest, resp := c.pushManifest(repo, reference, mediaTypeImageManifest, manifest)
+	if got := resp.Header.Get("OCI-Subject"); got != subject {
+		c.t.Errorf("OCI-Subject %q != %q", got, subject)
+	}
+	return digest
+}
+
+func TestChunkedUpload(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		data := []byte("hello chunked upload")
+		resp := c.do(http.MethodPost, "/v2/akkuman/hello/blobs/uploads/", nil, nil)
+		c.expect(resp, http.StatusAccepted)
+		location := resp.Header.Get("Location")
+		for offset, chunk := range [][]byte{data[:5], data[5:12]} {
+			start := []int{0, 5}[offset]
+			resp = c.do(http.MethodPatch, location, map[string]string{
+				"Content-Range": fmt.Sprintf("%d-%d", start, start+len(chunk)-1),
+			}, chunk)
+			c.expect(resp, http.StatusAccepted)
+			location = resp.Header.Get("Location")
+		}
+		if got := resp.Header.Get("Range"); got != "0-11" {
+			t.Errorf("Range %s != 0-11", got)
+		}
+		// a chunk out of order is refused
+		c.expect(c.do(http.MethodPatch, location, map[string]string{"Content-Range": "3-4"}, data[3:5]), http.StatusRequestedRangeNotSatisfiable)
+		digest := sha256Digest(data)
+		c.expect(c.do(http.MethodPut, location+"?digest="+digest, nil, data[12:]), http.StatusCreated)
+		got := c.expect(c.do(http.MethodGet, "/v2/akkuman/hello/blobs/"+digest, nil, nil), http.StatusOK)
+		if !bytes.Equal(got, data) {
+			t.Errorf("%q != %q", got, data)
+		}
+		// the upload session is closed
+		c.expect(c.do(http.MethodPatch, location, nil, data), http.StatusNotFound)
+	})
+}
+
+func TestUploadWrongDigest(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		digest := sha256Digest([]byte("other"))
+		c.expect(c.do(http.MethodPost, "/v2/akkuman/hello/blobs/uploads/?digest="+digest, nil, []byte("hello")), http.StatusBadRequest)
+		c.expect(c.do(http.MethodHead, "/v2/akkuman/hello/blobs/"+digest, nil, nil), http.StatusNotFound)
+	})
+}
+
+func TestMountBlob(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		digest := c.pushBlob("akkuman/hello", []byte("shared"))
+		c.expect(c.do(http.MethodHead, "/v2/akkuman/world/blobs/"+digest, nil, nil), http.StatusNotFound)
+		c.expect(c.do(http.MethodPost, fmt.Sprintf("/v2/akkuman/world/blobs/uploads/?mount=%s&from=akkuman/hello", digest), nil, nil), http.StatusCreated)
+		c.expect(c.do(http.MethodHead, "/v2/akkuman/world/blobs/"+digest, nil, nil), http.StatusOK)
+		// mounting an unknown blob starts a regular upload
+		unknown := sha256Digest([]byte("unknown"))
+		c.expect(c.do(http.MethodPost, fmt.Sprintf("/v2/akkuman/world/blobs/uploads/?mount=%s&from=akkuman/hello", unknown), nil, nil), http.StatusAccepted)
+	})
+}
+
+func TestManifests(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		digest := c.pushImage("akkuman/hello", "1.0", "")
+		resp := c.do(http.MethodHead, "/v2/akkuman/hello/manifests/1.0", nil, nil)
+		c.expect(resp, http.StatusOK)
+		if got := resp.Header.Get("Docker-Content-Digest"); got != digest {
+			t.Errorf("%s != %s", got, digest)
+		}
+		c.expect(c.do(http.MethodGet, "/v2/akkuman/hello/manifests/"+digest, nil, nil), http.StatusOK)
+
+		// blobs must be pushed before the manifest
+		c.expect(c.do(http.MethodPut, "/v2/akkuman/hello/manifests/2.0", map[string]string{"Content-Type": mediaTypeImageManifest},
+			[]byte(`{"schemaVersion":2,"config":{"digest":"`+sha256Digest([]byte("missing"))+`"},"layers":[]}`)), http.StatusBadRequest)
+		// so do the manifests of an index
+		c.expect(c.do(http.MethodPut, "/v2/akkuman/hello/manifests/2.0", map[string]string{"Content-Type": mediaTypeImageIndex},
+			[]byte(`{"schemaVersion":2,"manifests":[{"digest":"`+sha256Digest([]byte("missing"))+`"}]}`)), http.StatusBadRequest)
+		c.pushManifest("akkuman/hello", "2.0", mediaTypeImageIndex, map[string]any{
+			"schemaVersion": 2,
+			"mediaType":     mediaTypeImageIndex,
+			"manifests":     []any{map[string]any{"mediaType": mediaTypeImageManifest, "digest": digest, "size": 1}},
+		})
+
+		c.expect(c.do(http.MethodDelete, "/v2/akkuman/hello/manifests/2.0", nil, nil), http.StatusAccepted)
+		c.expect(c.do(http.MethodGet, "/v2/akkuman/hello/manifests/2.0", nil, nil), http.StatusNotFound)
+		c.expect(c.do(http.MethodDelete, "/v2/akkuman/hello/manifests/"+digest, nil, nil), http.StatusAccepted)
+		c.expect(c.do(http.MethodGet, "/v2/akkuman/hello/manifests/1.0", nil, nil), http.StatusNotFound)
+	})
+}
+
+func TestTagsList(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		for _, tag := range []string{"1.1", "1.0", "2.0"} {
+			c.pushImage("akkuman/hello", tag, "")
+		}
+		for _, x := range []struct {
+			query string
+			tags  string
+			link  bool
+		}{
+			{"", "[1.0 1.1 2.0]", false},
+			{"?n=2", "[1.0 1.1]", true},
+			{"?n=2&last=1.1", "[2.0]", false},
+		} {
+			resp := c.do(http.MethodGet, "/v2/akkuman/hello/tags/list"+x.query, nil, nil)
+			var list struct {
+				Tags []string `json:"tags"`
+			}
+			json.Unmarshal(c.expect(resp, http.StatusOK), &list)
+			if fmt.Sprint(list.Tags) != x.tags {
+				t.Errorf("%s: %v != %s", x.query, list.Tags, x.tags)
+			}
+			if link := resp.Header.Get("Link") != ""; link != x.link {
+				t.Errorf("%s: Link header %v, want %v", x.query, link, x.link)
+			}
+		}
+		c.expect(c.do(http.MethodGet, "/v2/akkuman/unknown/tags/list", nil, nil), http.StatusNotFound)
+	})
+}
+
+func TestReferrers(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		subject := c.pushImage("akkuman/hello", "1.0", "")
+		referrer := c.pushImage("akkuman/hello", "", subject)
+		for _, x := range []struct {
+			query string
+			want  int
+		}{
+			{"", 1},
+			{"?artifactType=application/vnd.example.sig", 1},
+			{"?artifactType=application/vnd.example.sbom", 0},
+		} {
+			var index struct {
+				Manifests []struct {
+					Digest       string `json:"digest"`
+					ArtifactType string `json:"artifactType"`
+				} `json:"manifests"`
+			}
+			json.Unmarshal(c.expect(c.do(http.MethodGet, "/v2/akkuman/hello/referrers/"+subject+x.query, nil, nil), http.StatusOK), &index)
+			if len(index.Manifests) != x.want {
+				t.Fatalf("%s: %d referrers, want %d", x.query, len(index.Manifests), x.want)
+			}
+			if x.want > 0 && index.Manifests[0].Digest != referrer {
+				t.Errorf("%s != %s", index.Manifests[0].Digest, referrer)
+			}
+		}
+	})
+}
+
+func TestAuth(t *testing.T) {
+	c := newClient(t, WithAuth("akkuman", "secret"))
+	resp := c.do(http.MethodPost, "/v2/akkuman/hello/blobs/uploads/", nil, nil)
+	c.expect(resp, http.StatusUnauthorized)
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, `Bearer realm="`+c.url+`/token"`) {
+		t.Fatalf("unexpected challenge %s", challenge)
+	}
+	c.expect(c.do(http.MethodGet, "/token", map[string]string{"Authorization": "Basic d3Jvbmc6d3Jvbmc="}, nil), http.StatusUnauthorized)
+	req, _ := http.NewRequest(http.MethodGet, c.url+"/token", nil)
+	req.SetBasicAuth("akkuman", "secret")
+	tokenResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tokenResp.Body.Close()
+	var token struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(c.expect(tokenResp, http.StatusOK), &token)
+	c.token = token.Token
+	c.pushImage("akkuman/hello", "1.0", "")
+	// pulls are anonymous
+	c.token = ""
+	c.expect(c.do(http.MethodGet, "/v2/akkuman/hello/manifests/1.0", nil, nil), http.StatusOK)
+	c.expect(c.do(http.MethodDelete, "/v2/akkuman/hello/manifests/1.0", nil, nil), http.StatusUnauthorized)
+}
+
+func TestExpiry(t *testing.T) {
+	rg := New(WithAuth("akkuman", "secret"))
+	now := time.Now()
+	rg.now = func() time.Time { return now }
+	srv := httptest.NewServer(rg)
+	t.Cleanup(srv.Close)
+	c := &client{t: t, url: srv.URL}
+	login := func() {
+		req, _ := http.NewRequest(http.MethodGet, c.url+"/token", nil)
+		req.SetBasicAuth("akkuman", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var token struct {
+			Token     string `json:"token"`
+			ExpiresIn int    `json:"expires_in"`
+		}
+		json.Unmarshal(c.expect(resp, http.StatusOK), &token)
+		if token.ExpiresIn != int(tokenTTL.Seconds()) {
+			t.Errorf("expires_in %d != %v", token.ExpiresIn, tokenTTL)
+		}
+		c.token = token.Token
+	}
+	login()
+	resp := c.do(http.MethodPost, "/v2/akkuman/hello/blobs/uploads/", nil, nil)
+	c.expect(resp, http.StatusAccepted)
+	location := resp.Header.Get("Location")
+	c.expect(c.do(http.MethodPatch, location, nil, []byte("stale")), http.StatusAccepted)
+	var tempFile string
+	for _, u := range rg.uploads {
+		tempFile = u.file.Name()
+	}
+
+	now = now.Add(tokenTTL)
+	c.expect(c.do(http.MethodPost, "/v2/akkuman/hello/blobs/uploads/", nil, nil), http.StatusUnauthorized)
+	// issuing a new token prunes the expired one and the stale upload
+	login()
+	if len(rg.tokens) != 1 {
+		t.Errorf("expired tokens are kept: %v", rg.tokens)
+	}
+	c.expect(c.do(http.MethodPatch, location, nil, []byte("more")), http.StatusNotFound)
+	if _, err := os.Stat(tempFile); !os.IsNotExist(err) {
+		t.Errorf("the temp file of the stale upload is kept: %v", err)
+	}
+}
+
+func TestInvalidName(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		digest := c.pushBlob("akkuman/hello", []byte("hello"))
+		for _, repo := range []string{"akkuman/hello/blobs/sha256", "akkuman/hello/blobs", "blobs/hello", "Akkuman/hello"} {
+			c.expect(c.do(http.MethodPost, fmt.Sprintf("/v2/%s/blobs/uploads/?digest=%s", repo, digest), nil, []byte("hello")), http.StatusBadRequest)
+			c.expect(c.do(http.MethodGet, fmt.Sprintf("/v2/%s/tags/list", repo), nil, nil), http.StatusBadRequest)
+		}
+		c.pushBlob("akkuman/hello/blobs2", []byte("hello"))
+	})
+}
+
+func TestCatalog(t *testing.T) {
+	eachStore(t, func(t *testing.T, c *client) {
+		for _, repo := range []string{"akkuman/wget", "akkuman/hello", "curl"} {
+			c.pushImage(repo, "1.0", "")
+		}
+		for _, x := range []struct {
+			query string
+			repos string
+		}{
+			{"", "[akkuman/hello akkuman/wget curl]"},
+			{"?n=1&last=akkuman/hello", "[akkuman/wget]"},
+		} {
+			var catalog struct {
+				Repositories []string `json:"repositories"`
+			}
+			json.Unmarshal(c.expect(c.do(http.MethodGet, "/v2/_catalog"+x.query, nil, nil), http.StatusOK), &catalog)
+			if fmt.Sprint(catalog.Repositories) != x.repos {
+				t.Errorf("%s: %v != %s", x.query, catalog.Repositories, x.repos)
+			}
+		}
+	})
+}
+
+func TestBasicAuth(t *testing.T) {
+	c := newClient(t, WithBasicAuth("akkuman", "secret"))
+	resp := c.do(http.MethodGet, "/v2/", nil, nil)
+	c.expect(resp, http.StatusUnauthorized)
+	if challenge := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Basic ") {
+		t.Fatalf("unexpected challenge %s", challenge)
+	}
+	c.expect(c.do(http.MethodGet, "/v2/", map[string]string{"Authorization": "Basic d3Jvbmc6d3Jvbmc="}, nil), http.StatusUnauthorized)
+	req, _ := http.NewRequest(http.MethodGet, c.url+"/v2/", nil)
+	req.SetBasicAuth("akkuman", "secret")
+	c.expect(c.do(http.MethodGet, "/v2/", map[string]string{"Authorization": req.Header.Get("Authorization")}, nil), http.StatusOK)
+}
@@ -0,0 +1,94 @@
+// Package registrytest runs an in-process registry for tests
+package registrytest
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/compress"
+	"github.com/akkuman/blob-uploader/pkg/registry"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// Server is a plain HTTP registry listening on a local port
+type Server struct {
+	*httptest.Server
+	// Host is the registry host of the refs, e.g. 127.0.0.1:40123
+	Host string
+}
+
+// New starts a registry with an empty in-memory store, it is closed at the end of the test
+func New(t testing.TB, opts ...registry.Option) *Server {
+	t.Helper()
+	s := httptest.NewServer(registry.New(opts...))
+	t.Cleanup(s.Close)
+	return &Server{
+		Server: s,
+		Host:   strings.TrimPrefix(s.URL, "http://"),
+	}
+}
+
+// Package compresses _testdata/wget of the repository into a tar.gz, the test package, and returns its path
+// and its content. The file is removed at the end of the test.
+func Package(t testing.TB) (string, []byte) {
+	t.Helper()
+	_, filename, _, _ := runtime.Caller(0)
+	targzPath, err := compress.CompressToTmpFile([]string{filepath.Join(filepath.Dir(filename), "..", "..", "..", "_testdata", "wget")})
+	if err != nil {
+		t.Fatal("compress to tar.gz failed:", err)
+	}
+	t.Cleanup(func() { os.Remove(targzPath) })
+	content, err := os.ReadFile(targzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return targzPath, content
+}
+
+// PushPackage pushes the test package of Package for the default platform as every tag of repo, e.g. akkuman/hello,
+// with the credentials of the registry when it requires some. It returns the content of the tar.gz.
+func PushPackage(t testing.TB, srv *Server, username string, password string, repo string, tags ...string) []byte {
+	t.Helper()
+	targzPath, content := Package(t)
+	host := config.HostNewName(srv.Host)
+	host.TLS = config.TLSDisabled
+	host.User = username
+	host.Pass = password
+	rc := regclient.New(regclient.WithConfigHost(*host))
+	ctx := context.Background()
+	for _, tag := range tags {
+		ociInstance := oci.NewOCI()
+		err := ociInstance.BuildOCI(ctx, util.DefaultPlatform, targzPath, tag, "https://github.com/akkuman/blob-uploader")
+		if err == nil {
+			err = copyLayout(ctx, rc, ociInstance.GetRootDir(), fmt.Sprintf("%s/%s:%s", srv.Host, repo, tag))
+		}
+		ociInstance.Close()
+		if err != nil {
+			t.Fatalf("push %s:%s: %v", repo, tag, err)
+		}
+	}
+	return content
+}
+
+// copyLayout copies the tag of refName built in the layout at layoutDir to refName
+func copyLayout(ctx context.Context, rc *regclient.RegClient, layoutDir string, refName string) error {
+	rDst, err := ref.New(refName)
+	if err != nil {
+		return err
+	}
+	rSrc, err := ref.New(fmt.Sprintf("ocidir://%s:%s", layoutDir, rDst.Tag))
+	if err != nil {
+		return err
+	}
+	return rc.ImageCopy(ctx, rSrc, rDst)
+}
@@ -0,0 +1,241 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrBlobUnknown     = errors.New("blob unknown to registry")
+	ErrManifestUnknown = errors.New("manifest unknown to registry")
+	ErrNameUnknown     = errors.New("repository name not known to registry")
+)
+
+// Manifest is a manifest or an index stored in a repository
+type Manifest struct {
+	MediaType string
+	Digest    string
+	Data      []byte
+	// ArtifactType is the artifactType of the manifest, or the media type of its config
+	ArtifactType string
+	// Subject is the digest of the subject of the manifest, used by the referrers API
+	Subject     string
+	Annotations map[string]string
+}
+
+// Store keeps the blobs and the manifests of the registry, blobs are addressed by digest
+// and are linked to the repositories they are pushed or mounted to
+type Store interface {
+	// GetBlob opens a blob linked to repo
+	GetBlob(ctx context.Context, repo string, digest string) (io.ReadSeekCloser, error)
+	// PutBlob stores a blob whose digest has been verified and links it to repo
+	PutBlob(ctx context.Context, repo string, digest string, r io.Reader) error
+	// MountBlob links a blob of repository from to repo
+	MountBlob(ctx context.Context, repo string, from string, digest string) error
+	DeleteBlob(ctx context.Context, repo string, digest string) error
+	// GetManifest returns a manifest by tag or by digest
+	GetManifest(ctx context.Context, repo string, reference string) (*Manifest, error)
+	// PutManifest stores a manifest and tags it when tag is not blank
+	PutManifest(ctx context.Context, repo string, tag string, m *Manifest) error
+	// DeleteManifest deletes a tag, or a manifest and all its tags when reference is a digest
+	DeleteManifest(ctx context.Context, repo string, reference string) error
+	// Tags returns the tags of repo in lexical order
+	Tags(ctx context.Context, repo string) ([]string, error)
+	// Referrers returns the manifests of repo whose subject is digest
+	Referrers(ctx context.Context, repo string, digest string) ([]*Manifest, error)
+	// Repositories returns the names of the repositories in lexical order
+	Repositories(ctx context.Context) ([]string, error)
+}
+
+type memoryRepo struct {
+	blobs     map[string]bool
+	manifests map[string]*Manifest
+	tags      map[string]string
+}
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+	repos map[string]*memoryRepo
+}
+
+var _ Store = &memoryStore{}
+
+// NewMemoryStore returns a Store keeping everything in memory
+func NewMemoryStore() Store {
+	return &memoryStore{
+		blobs: make(map[string][]byte),
+		repos: make(map[string]*memoryRepo),
+	}
+}
+
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
+
+func (s *memoryStore) repo(name string, create bool) *memoryRepo {
+	repo, ok := s.repos[name]
+	if !ok && create {
+		repo = &memoryRepo{
+			blobs:     make(map[string]bool),
+			manifests: make(map[string]*Manifest),
+			tags:      make(map[string]string),
+		}
+		s.repos[name] = repo
+	}
+	return repo
+}
+
+func (s *memoryStore) GetBlob(ctx context.Context, repo string, digest string) (io.ReadSeekCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := s.repo(repo, false)
+	if r == nil || !r.blobs[digest] {
+		return nil, ErrBlobUnknown
+	}
+	return readSeekNopCloser{bytes.NewReader(s.blobs[digest])}, nil
+}
+
+func (s *memoryStore) PutBlob(ctx context.Context, repo string, digest string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[digest] = data
+	s.repo(repo, true).blobs[digest] = true
+	return nil
+}
+
+func (s *memoryStore) MountBlob(ctx context.Context, repo string, from string, digest string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(from, false)
+	if r == nil || !r.blobs[digest] {
+		return ErrBlobUnknown
+	}
+	s.repo(repo, true).blobs[digest] = true
+	return nil
+}
+
+func (s *memoryStore) DeleteBlob(ctx context.Context, repo string, digest string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(repo, false)
+	if r == nil || !r.blobs[digest] {
+		return ErrBlobUnknown
+	}
+	delete(r.blobs, digest)
+	for _, other := range s.repos {
+		if other.blobs[digest] {
+			return nil
+		}
+	}
+	delete(s.blobs, digest)
+	return nil
+}
+
+func (s *memoryStore) GetManifest(ctx context.Context, repo string, reference string) (*Manifest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := s.repo(repo, false)
+	if r == nil {
+		return nil, ErrNameUnknown
+	}
+	if digest, ok := r.tags[reference]; ok {
+		reference = digest
+	}
+	m, ok := r.manifests[reference]
+	if !ok {
+		return nil, ErrManifestUnknown
+	}
+	return m, nil
+}
+
+func (s *memoryStore) PutManifest(ctx context.Context, repo string, tag string, m *Manifest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(repo, true)
+	r.manifests[m.Digest] = m
+	if tag != "" {
+		r.tags[tag] = m.Digest
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteManifest(ctx context.Context, repo string, reference string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(repo, false)
+	if r == nil {
+		return ErrNameUnknown
+	}
+	if _, ok := r.tags[reference]; ok {
+		delete(r.tags, reference)
+		return nil
+	}
+	if _, ok := r.manifests[reference]; !ok {
+		return ErrManifestUnknown
+	}
+	delete(r.manifests, reference)
+	maps.DeleteFunc(r.tags, func(tag string, digest string) bool {
+		return digest == reference
+	})
+	return nil
+}
+
+func (s *memoryStore) Tags(ctx context.Context, repo string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := s.repo(repo, false)
+	if r == nil {
+		return nil, ErrNameUnknown
+	}
+	tags := make([]string, 0, len(r.tags))
+	for tag := range r.tags {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	return tags, nil
+}
+
+func (s *memoryStore) Referrers(ctx context.Context, repo string, digest string) ([]*Manifest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := s.repo(repo, false)
+	if r == nil {
+		return nil, nil
+	}
+	var referrers []*Manifest
+	for _, m := range r.manifests {
+		if m.Subject == digest {
+			referrers = append(referrers, m)
+		}
+	}
+	slices.SortFunc(referrers, func(a, b *Manifest) int {
+		return strings.Compare(a.Digest, b.Digest)
+	})
+	return referrers, nil
+}
+
+func (s *memoryStore) Repositories(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	repos := make([]string, 0, len(s.repos))
+	for name := range s.repos {
+		repos = append(repos, name)
+	}
+	slices.Sort(repos)
+	return repos, nil
+}
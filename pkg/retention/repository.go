@@ -0,0 +1,197 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/ghpackages"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// ErrVersionNotFound is returned when no version has the requested tag or digest
+var ErrVersionNotFound = errors.New("version not found")
+
+// Repository is where the versions of a package are listed and deleted
+type Repository interface {
+	// Versions lists the versions of the package
+	Versions(ctx context.Context) ([]Version, error)
+	// Version returns the version having the tag or the digest reference
+	Version(ctx context.Context, reference string) (Version, error)
+	// Delete deletes a version and all its tags
+	Delete(ctx context.Context, v Version) error
+}
+
+// GitHubPackages is the Repository of a ghcr.io package, versions are deleted with the GitHub Packages API
+// because ghcr.io doesn't implement the DELETE manifest endpoint
+type GitHubPackages struct {
+	client *ghpackages.Client
+	owner  string
+	name   string
+
+	// versions are the versions last listed, Delete looks the signatures and referrers up in them
+	versions []ghpackages.Version
+}
+
+var _ Repository = &GitHubPackages{}
+
+// NewGitHubPackages returns the Repository of the package of the ghcr.io repository, e.g. example/hello
+func NewGitHubPackages(client *ghpackages.Client, repository string) (*GitHubPackages, error) {
+	owner, name, err := ghpackages.SplitRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubPackages{client: client, owner: owner, name: name}, nil
+}
+
+func (g *GitHubPackages) Versions(ctx context.Context) ([]Version, error) {
+	ghVersions, err := g.client.Versions(ctx, g.owner, g.name)
+	if err != nil {
+		return nil, err
+	}
+	g.versions = ghVersions
+	versions := make([]Version, 0, len(ghVersions))
+	for _, v := range ghVersions {
+		versions = append(versions, Version{
+			ID:      strconv.FormatInt(v.ID, 10),
+			Digest:  v.Name,
+			Tags:    regctl.PackageTags(v.Tags()),
+			Created: v.CreatedAt,
+		})
+	}
+	return versions, nil
+}
+
+func (g *GitHubPackages) Version(ctx context.Context, reference string) (Version, error) {
+	versions, err := g.Versions(ctx)
+	if err != nil {
+		return Version{}, err
+	}
+	for _, v := range versions {
+		if v.Digest == reference {
+			return v, nil
+		}
+		for _, tag := range v.Tags {
+			if tag == reference {
+				return v, nil
+			}
+		}
+	}
+	return Version{}, fmt.Errorf("%s/%s:%s: %w", g.owner, g.name, reference, ErrVersionNotFound)
+}
+
+func (g *GitHubPackages) Delete(ctx context.Context, v Version) error {
+	id, err := strconv.ParseInt(v.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid version id %q", v.ID)
+	}
+	err = g.client.DeleteVersion(ctx, g.owner, g.name, id)
+	if err != nil {
+		return err
+	}
+	// delete the signatures and the referrers stored in the tag schema along with it
+	tags := regctl.ArtifactTags(v.Digest)
+	for _, x := range g.versions {
+		if len(x.Tags()) > 0 && len(regctl.PackageTags(x.Tags())) == 0 && slices.Contains(tags, x.Tags()[0]) {
+			err = g.client.DeleteVersion(ctx, g.owner, g.name, x.ID)
+			if err != nil && !errors.Is(err, ghpackages.ErrNotFound) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Registry is the Repository of a package in any OCI distribution registry, versions are the tagged
+// manifests and they are deleted with the DELETE manifest endpoint
+type Registry struct {
+	registry *regctl.Registry
+	// ref is the ref of the repository, without tag
+	ref ref.Ref
+}
+
+var _ Repository = &Registry{}
+
+// NewRegistry returns the Repository of the repository of refName in the registry
+func NewRegistry(registry *regctl.Registry, refName string) (*Registry, error) {
+	r, err := ref.New(refName)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{registry: registry, ref: r.SetTag("")}, nil
+}
+
+func (rg *Registry) Versions(ctx context.Context) ([]Version, error) {
+	manifests, err := rg.registry.TaggedManifests(ctx, rg.ref.CommonName())
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]Version, 0, len(manifests))
+	for _, m := range manifests {
+		versions = append(versions, Version{ID: m.Digest, Digest: m.Digest, Tags: m.Tags, Created: m.Created})
+	}
+	return versions, nil
+}
+
+func (rg *Registry) Version(ctx context.Context, reference string) (Version, error) {
+	r := rg.ref.SetTag(reference)
+	if strings.HasPrefix(reference, "sha256:") {
+		r = rg.ref.SetDigest(reference)
+	}
+	digest, err := rg.registry.Digest(ctx, r.CommonName())
+	if err != nil {
+		if errors.Is(err, regctl.ErrNotFound) {
+			return Version{}, fmt.Errorf("%s: %w", r.CommonName(), ErrVersionNotFound)
+		}
+		return Version{}, err
+	}
+	v := Version{ID: digest, Digest: digest}
+	if r.Tag != "" && r.Digest == "" {
+		// the other tags of the manifest, which are deleted with it, aren't listed
+		v.Tags = []string{reference}
+	}
+	return v, nil
+}
+
+func (rg *Registry) Delete(ctx context.Context, v Version) error {
+	_, err := rg.registry.DeleteManifest(ctx, rg.ref.SetDigest(v.Digest).CommonName())
+	if err != nil {
+		return err
+	}
+	// delete the signatures and the referrers stored in the tag schema along with it
+	for _, tag := range regctl.ArtifactTags(v.Digest) {
+		_, err = rg.registry.DeleteManifest(ctx, rg.ref.SetTag(tag).CommonName())
+		if err != nil && !errors.Is(err, regctl.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune plans the retention of the versions of repo and deletes the versions which no rule keeps,
+// unless dryRun. It returns the decisions and stops at the first failed deletion.
+func Prune(ctx context.Context, repo Repository, policy *Policy, now time.Time, dryRun bool) ([]Decision, error) {
+	versions, err := repo.Versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	decisions := policy.Plan(versions, now)
+	if dryRun {
+		return decisions, nil
+	}
+	for _, d := range decisions {
+		if !d.Delete {
+			continue
+		}
+		err := repo.Delete(ctx, d.Version)
+		if err != nil {
+			return decisions, fmt.Errorf("delete %s (%s): %w", d.Digest, strings.Join(d.Tags, ", "), err)
+		}
+	}
+	return decisions, nil
+}
@@ -0,0 +1,142 @@
+// Package retention decides which versions of a package to delete according to retention rules
+// and deletes them from GitHub Packages or from any OCI distribution registry
+package retention
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/util"
+)
+
+// Version is a version of a package, i.e. a manifest and its tags
+type Version struct {
+	// ID identifies the version for Repository.Delete
+	ID     string
+	Digest string
+	Tags   []string
+	// Created is the creation time of the version, zero when unknown
+	Created time.Time
+}
+
+// Policy is a set of retention rules, a version is deleted when no rule keeps it
+type Policy struct {
+	// KeepLast keeps the KeepLast most recent matching versions
+	KeepLast int
+	// KeepWithin keeps the versions created less than KeepWithin ago, and the versions whose creation time is unknown
+	KeepWithin time.Duration
+	// KeepReleases keeps the versions having a semver release tag
+	KeepReleases bool
+	// Match restricts the deletion to the versions having a tag it matches, all the versions when nil
+	Match *regexp.Regexp
+}
+
+// Empty reports whether the policy has no rule, it would delete every tagged version
+func (p *Policy) Empty() bool {
+	return p.KeepLast <= 0 && p.KeepWithin <= 0 && !p.KeepReleases && p.Match == nil
+}
+
+// Decision is what the policy decided for a version and why
+type Decision struct {
+	Version
+	Delete bool
+	Reason string
+}
+
+// Plan decides what to do with every version, newest first.
+// Untagged versions are always kept, they may be the platform manifests or the referrers of another version.
+func (p *Policy) Plan(versions []Version, now time.Time) []Decision {
+	sorted := append([]Version(nil), versions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return newer(sorted[i], sorted[j]) })
+	decisions := make([]Decision, 0, len(sorted))
+	matched := 0
+	for _, v := range sorted {
+		d := Decision{Version: v}
+		switch {
+		case len(v.Tags) == 0:
+			d.Reason = "untagged"
+		case p.Match != nil && !p.matches(v.Tags):
+			d.Reason = fmt.Sprintf("no tag matches %s", p.Match)
+		default:
+			matched++
+			switch {
+			case p.KeepLast > 0 && matched <= p.KeepLast:
+				d.Reason = fmt.Sprintf("one of the last %d versions", p.KeepLast)
+			case p.KeepWithin > 0 && v.Created.IsZero():
+				d.Reason = "creation time unknown, it may be newer than " + FormatDuration(p.KeepWithin)
+			case p.KeepWithin > 0 && now.Sub(v.Created) < p.KeepWithin:
+				d.Reason = fmt.Sprintf("created less than %s ago", FormatDuration(p.KeepWithin))
+			case p.KeepReleases && isRelease(v.Tags):
+				d.Reason = "semver release"
+			default:
+				d.Delete = true
+				d.Reason = "no rule keeps it"
+			}
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// newer reports whether a is newer than b, the versions created at the same time (the created
+// annotation has a precision of a second) are ordered by their first tag, the greatest first
+func newer(a Version, b Version) bool {
+	if !a.Created.Equal(b.Created) {
+		return a.Created.After(b.Created)
+	}
+	if len(a.Tags) == 0 || len(b.Tags) == 0 {
+		return len(a.Tags) > len(b.Tags)
+	}
+	if cmp, err := util.CompareVersions(a.Tags[0], b.Tags[0]); err == nil {
+		return cmp > 0
+	}
+	return a.Tags[0] > b.Tags[0]
+}
+
+func (p *Policy) matches(tags []string) bool {
+	for _, tag := range tags {
+		if p.Match.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func isRelease(tags []string) bool {
+	for _, tag := range tags {
+		if util.IsSemverRelease(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDuration parses a duration such as 36h, 30d or 2w, d and w being days and weeks
+func ParseDuration(text string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(text, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid duration: %q", text)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %q", text)
+	}
+	return d, nil
+}
+
+// FormatDuration formats d in days when it is a whole number of days
+func FormatDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
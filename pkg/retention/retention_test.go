@@ -0,0 +1,226 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/ghpackages"
+	"github.com/akkuman/blob-uploader/pkg/ghpackages/ghpackagestest"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/registry"
+	"github.com/akkuman/blob-uploader/pkg/registry/registrytest"
+)
+
+var now = time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+// testVersions are a nightly channel beside releases, one day apart, newest last
+var testVersions = []struct {
+	tags []string
+	age  time.Duration
+}{
+	{[]string{"1.0.0"}, 40 * 24 * time.Hour},
+	{[]string{"nightly-20240520"}, 41 * 24 * time.Hour},
+	{[]string{"nightly-20240601"}, 29 * 24 * time.Hour},
+	{[]string{"1.1.0-rc.1"}, 20 * 24 * time.Hour},
+	{[]string{"nightly-20240620"}, 10 * 24 * time.Hour},
+	{nil, 3 * 24 * time.Hour},
+	{[]string{"nightly-20240628", "nightly"}, 2 * 24 * time.Hour},
+	{[]string{"nightly-20240629"}, 1 * 24 * time.Hour},
+}
+
+func versionsOf(t *testing.T) []Version {
+	t.Helper()
+	var versions []Version
+	for i, x := range testVersions {
+		versions = append(versions, Version{
+			ID:      fmt.Sprint(i),
+			Digest:  fmt.Sprintf("sha256:%064d", i),
+			Tags:    x.tags,
+			Created: now.Add(-x.age),
+		})
+	}
+	return versions
+}
+
+// deleted returns the first tag of the versions deleted by decisions
+func deleted(decisions []Decision) []string {
+	tags := []string{}
+	for _, d := range decisions {
+		if d.Delete {
+			tags = append(tags, d.Tags[0])
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+func TestPlan(t *testing.T) {
+	for _, x := range []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{
+		{"keep last", Policy{KeepLast: 3}, []string{"1.0.0", "1.1.0-rc.1", "nightly-20240520", "nightly-20240601"}},
+		{"keep within", Policy{KeepWithin: 30 * 24 * time.Hour}, []string{"1.0.0", "nightly-20240520"}},
+		{"keep releases", Policy{KeepReleases: true}, []string{"1.1.0-rc.1", "nightly-20240520", "nightly-20240601", "nightly-20240620", "nightly-20240628", "nightly-20240629"}},
+		{"nightlies only", Policy{KeepLast: 2, Match: regexp.MustCompile(`^nightly-`)}, []string{"nightly-20240520", "nightly-20240601", "nightly-20240620"}},
+		{"all rules", Policy{KeepLast: 1, KeepWithin: 15 * 24 * time.Hour, KeepReleases: true}, []string{"1.1.0-rc.1", "nightly-20240520", "nightly-20240601"}},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			decisions := x.policy.Plan(versionsOf(t), now)
+			if len(decisions) != len(testVersions) {
+				t.Fatalf("got %d decisions", len(decisions))
+			}
+			for i := 1; i < len(decisions); i++ {
+				if decisions[i].Created.After(decisions[i-1].Created) {
+					t.Errorf("decisions are not sorted newest first")
+				}
+			}
+			if got := deleted(decisions); !slices.Equal(got, x.want) {
+				t.Errorf("deleted %v, want %v", got, x.want)
+			}
+		})
+	}
+}
+
+func TestPlanUnknownAge(t *testing.T) {
+	versions := []Version{
+		{Digest: "sha256:1", Tags: []string{"nightly-20240629"}, Created: now.Add(-24 * time.Hour)},
+		{Digest: "sha256:2", Tags: []string{"nightly-20240101"}, Created: now.Add(-180 * 24 * time.Hour)},
+		{Digest: "sha256:3", Tags: []string{"nightly-imported"}},
+	}
+	decisions := (&Policy{KeepWithin: 30 * 24 * time.Hour}).Plan(versions, now)
+	if got := deleted(decisions); !slices.Equal(got, []string{"nightly-20240101"}) {
+		t.Errorf("deleted %v, want only nightly-20240101", got)
+	}
+	for _, d := range decisions {
+		if d.Created.IsZero() && !strings.Contains(d.Reason, "unknown") {
+			t.Errorf("the reason of keeping %v doesn't tell the age is unknown: %s", d.Tags, d.Reason)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, x := range []struct {
+		text string
+		want time.Duration
+	}{
+		{"36h", 36 * time.Hour},
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+	} {
+		got, err := ParseDuration(x.text)
+		if err != nil || got != x.want {
+			t.Errorf("%s: got %v, %v", x.text, got, err)
+		}
+	}
+	for _, text := range []string{"", "d", "-1d", "1y"} {
+		if _, err := ParseDuration(text); err == nil {
+			t.Errorf("%q is a duration", text)
+		}
+	}
+}
+
+func TestPruneGitHubPackages(t *testing.T) {
+	srv := ghpackagestest.New(t)
+	srv.AddOrg("example")
+	for i, x := range testVersions {
+		srv.AddVersion("example", "tools/hello", fmt.Sprintf("sha256:%064d", i), now.Add(-x.age), x.tags...)
+	}
+	// the signatures are versions of their own, they are deleted along with the signed version
+	sigTag := fmt.Sprintf("sha256-%064d.sig", 4)
+	srv.AddVersion("example", "tools/hello", fmt.Sprintf("sha256:%064d", 98), now, sigTag)
+	srv.AddVersion("example", "tools/hello", fmt.Sprintf("sha256:%064d", 99), now, fmt.Sprintf("sha256-%064d.sig", 7))
+	repo, err := NewGitHubPackages(ghpackages.New("token", ghpackages.WithBaseURL(srv.URL)), "example/tools/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	policy := &Policy{KeepLast: 2, Match: regexp.MustCompile(`^nightly-`)}
+	decisions, err := Prune(ctx, repo, policy, now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"nightly-20240520", "nightly-20240601", "nightly-20240620"}
+	if got := deleted(decisions); !slices.Equal(got, want) {
+		t.Fatalf("dry run would delete %v, want %v", got, want)
+	}
+	for _, v := range srv.Versions("example", "tools/hello") {
+		if v.Deleted {
+			t.Fatalf("dry run deleted %+v", v)
+		}
+	}
+
+	_, err = Prune(ctx, repo, policy, now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range srv.Versions("example", "tools/hello") {
+		if v.Deleted {
+			got = append(got, v.Tags[0])
+		}
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, append(want, sigTag)) {
+		t.Errorf("deleted %v, want %v and the signature of nightly-20240620", got, want)
+	}
+
+	v, err := repo.Version(ctx, "nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Tags[0] != "nightly-20240628" {
+		t.Errorf("unexpected version %+v", v)
+	}
+	err = repo.Delete(ctx, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Version(ctx, "nightly"); err == nil {
+		t.Error("nightly is still there")
+	}
+}
+
+func TestPruneRegistry(t *testing.T) {
+	srv := registrytest.New(t, registry.WithAuth("akkuman", "secret"))
+	registrytest.PushPackage(t, srv, "akkuman", "secret", "akkuman/hello", "1.0.0", "nightly-1", "nightly-2", "nightly-3")
+	rg := regctl.NewRegistry(srv.Host, "akkuman", "secret", regctl.WithPlainHTTP())
+	ctx := context.Background()
+	repo, err := NewRegistry(rg, srv.Host+"/akkuman/hello:nightly-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the versions are likely created within the same second, they are then ordered by tag
+	decisions, err := Prune(ctx, repo, &Policy{KeepLast: 1, Match: regexp.MustCompile(`^nightly-`)}, time.Now(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deleted(decisions); !slices.Equal(got, []string{"nightly-1", "nightly-2"}) {
+		t.Errorf("deleted %v", got)
+	}
+	tags, err := rg.GetTags(ctx, srv.Host+"/akkuman/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(tags)
+	if !slices.Equal(tags, []string{"1.0.0", "nightly-3"}) {
+		t.Errorf("got tags %v after prune", tags)
+	}
+
+	v, err := repo.Version(ctx, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Delete(ctx, v); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Version(ctx, "1.0.0"); err == nil {
+		t.Error("1.0.0 is still there")
+	}
+}
@@ -0,0 +1,119 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// https://cyclonedx.org/docs/1.5/json/
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// serialNumber formats id as the URN of a UUID
+func serialNumber(id string) string {
+	return fmt.Sprintf("urn:uuid:%s-%s-4%s-8%s-%s", id[0:8], id[8:12], id[13:16], id[17:20], id[20:32])
+}
+
+func generateCycloneDX(pkg *Package) ([]byte, error) {
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: serialNumber(documentID(pkg)),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: pkg.Created.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: toolName}}},
+			Component: cdxComponent{
+				Type:    "application",
+				BOMRef:  "package",
+				Name:    pkg.Name,
+				Version: pkg.Version,
+			},
+		},
+		Components: []cdxComponent{},
+	}
+	packageDependency := cdxDependency{Ref: "package", DependsOn: []string{}}
+	modules := make(map[string]bool)
+	for i, f := range pkg.Files {
+		fileRef := fmt.Sprintf("file-%d", i)
+		properties := []cdxProperty{
+			{Name: toolName + ":file:size", Value: fmt.Sprint(f.Size)},
+			{Name: toolName + ":file:mode", Value: f.Mode.String()},
+		}
+		if f.GoBuildInfo != nil {
+			properties = append(properties, cdxProperty{Name: toolName + ":go:version", Value: f.GoBuildInfo.GoVersion})
+		}
+		bom.Components = append(bom.Components, cdxComponent{
+			Type:       "file",
+			BOMRef:     fileRef,
+			Name:       f.Name,
+			Hashes:     []cdxHash{{Alg: "SHA-256", Content: f.SHA256}},
+			Properties: properties,
+		})
+		packageDependency.DependsOn = append(packageDependency.DependsOn, fileRef)
+		if f.GoBuildInfo == nil {
+			continue
+		}
+		fileDependency := cdxDependency{Ref: fileRef, DependsOn: []string{}}
+		for _, m := range goModules(f.GoBuildInfo) {
+			ref := purl(m)
+			if !modules[ref] {
+				modules[ref] = true
+				bom.Components = append(bom.Components, cdxComponent{
+					Type:    "library",
+					BOMRef:  ref,
+					Name:    m.Path,
+					Version: m.Version,
+					PURL:    ref,
+				})
+			}
+			fileDependency.DependsOn = append(fileDependency.DependsOn, ref)
+		}
+		bom.Dependencies = append(bom.Dependencies, fileDependency)
+	}
+	bom.Dependencies = append([]cdxDependency{packageDependency}, bom.Dependencies...)
+	return json.MarshalIndent(bom, "", "  ")
+}
@@ -0,0 +1,206 @@
+// Package sbom generates SPDX and CycloneDX software bills of materials listing the files
+// of a package and the Go modules embedded in its Go binaries
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/archive"
+)
+
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx"
+	FormatCycloneDX Format = "cyclonedx"
+
+	toolName = "blob-uploader"
+)
+
+// ParseFormat parses the name of a SBOM format, spdx or cyclonedx
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatSPDX, FormatCycloneDX:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown SBOM format %q, expected spdx or cyclonedx", name)
+}
+
+// ArtifactType returns the artifactType of the SBOM when it is attached to a package
+func (f Format) ArtifactType() string {
+	if f == FormatCycloneDX {
+		return "application/vnd.cyclonedx+json"
+	}
+	return "application/spdx+json"
+}
+
+// FileName returns the conventional file name of the SBOM of the package name
+func (f Format) FileName(name string) string {
+	if f == FormatCycloneDX {
+		return name + ".cdx.json"
+	}
+	return name + ".spdx.json"
+}
+
+// File is a regular file of a package
+type File struct {
+	Name   string
+	SHA256 string
+	Size   int64
+	Mode   fs.FileMode
+	// GoBuildInfo is the build info of a Go binary, nil for other files
+	GoBuildInfo *debug.BuildInfo
+}
+
+// Package is the subject of a SBOM
+type Package struct {
+	Name    string
+	Version string
+	Files   []File
+	// Created is the time the SBOM was created
+	Created time.Time
+}
+
+// ScanArchive returns the regular files of the tar.gz file at filePath
+func ScanArchive(filePath string) ([]File, error) {
+	var files []File
+	err := archive.Walk(filePath, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := scan(strings.TrimPrefix(path.Clean("/"+hdr.Name), "/"), r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		f.Mode = hdr.FileInfo().Mode()
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
+
+// ScanFile returns the File of the file at filePath, named after its base name
+func ScanFile(filePath string) (File, error) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return File{}, err
+	}
+	r, err := os.Open(filePath)
+	if err != nil {
+		return File{}, err
+	}
+	defer r.Close()
+	f, err := scan(filepath.Base(filePath), r)
+	if err != nil {
+		return File{}, fmt.Errorf("%s: %w", filePath, err)
+	}
+	f.Mode = fi.Mode()
+	return f, nil
+}
+
+// isExecutable reports whether header starts with the magic of an ELF, Mach-O or PE file
+func isExecutable(header []byte) bool {
+	for _, magic := range [][]byte{
+		[]byte("\x7fELF"),
+		[]byte("MZ"),
+		{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf},
+		{0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+	} {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan hashes the content of r, executables are spooled to a temp file to read their Go build info
+func scan(name string, r io.Reader) (File, error) {
+	f := File{Name: name}
+	h := sha256.New()
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(4)
+	if !isExecutable(header) {
+		n, err := io.Copy(h, br)
+		if err != nil {
+			return f, err
+		}
+		f.Size = n
+		f.SHA256 = hex.EncodeToString(h.Sum(nil))
+		return f, nil
+	}
+	tmp, err := os.CreateTemp("", "sbom-*")
+	if err != nil {
+		return f, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	n, err := io.Copy(io.MultiWriter(tmp, h), br)
+	if err != nil {
+		return f, err
+	}
+	f.Size = n
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	// not a Go binary when the build info can't be read
+	if info, err := buildinfo.Read(tmp); err == nil {
+		f.GoBuildInfo = info
+	}
+	return f, nil
+}
+
+// goModules returns the modules of a Go binary, its main module first, replacements applied
+func goModules(info *debug.BuildInfo) []debug.Module {
+	var modules []debug.Module
+	if info.Main.Path != "" {
+		modules = append(modules, info.Main)
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		modules = append(modules, *dep)
+	}
+	return modules
+}
+
+// purl returns the package URL of a Go module
+func purl(m debug.Module) string {
+	if m.Version == "" || m.Version == "(devel)" {
+		return "pkg:golang/" + m.Path
+	}
+	return fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version)
+}
+
+// Generate returns the SBOM of pkg as JSON
+func Generate(format Format, pkg *Package) ([]byte, error) {
+	switch format {
+	case FormatSPDX:
+		return generateSPDX(pkg)
+	case FormatCycloneDX:
+		return generateCycloneDX(pkg)
+	}
+	return nil, fmt.Errorf("unknown SBOM format %q", format)
+}
+
+// documentID returns a stable identifier of the content of pkg
+func documentID(pkg *Package) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", pkg.Name, pkg.Version)
+	for _, f := range pkg.Files {
+		fmt.Fprintf(h, "%s %s\n", f.SHA256, f.Name)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,81 @@
+package sbom
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akkuman/blob-uploader/pkg/compress"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	_ "github.com/akkuman/blob-uploader/testinit"
+)
+
+func TestGenerate(t *testing.T) {
+	// the test binary is a Go binary with build info
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targzPath, err := compress.CompressToTmpFile([]string{"./_testdata/wget", exe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(targzPath)
+	files, err := ScanArchive(targzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	wgetSHA256, err := util.CalcFileSHA256("./_testdata/wget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Name != "_testdata/wget" || files[0].SHA256 != wgetSHA256 || files[0].GoBuildInfo != nil {
+		t.Errorf("unexpected wget entry %+v", files[0])
+	}
+	if files[1].Name != strings.TrimPrefix(filepath.ToSlash(exe), "/") || files[1].GoBuildInfo == nil {
+		t.Fatalf("no Go build info in %+v", files[1])
+	}
+
+	pkg := &Package{Name: "wget", Version: "1.21.4", Files: files, Created: time.Unix(0, 0)}
+	for _, x := range []struct {
+		format Format
+		want   []string
+	}{
+		{FormatSPDX, []string{`"spdxVersion": "SPDX-2.3"`, `"checksumValue": "` + wgetSHA256, `"referenceLocator": "pkg:golang/github.com/akkuman/blob-uploader`}},
+		{FormatCycloneDX, []string{`"bomFormat": "CycloneDX"`, `"content": "` + wgetSHA256, `"purl": "pkg:golang/github.com/akkuman/blob-uploader`}},
+	} {
+		t.Run(string(x.format), func(t *testing.T) {
+			data, err := Generate(x.format, pkg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range x.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("%s not found in\n%s", want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, x := range []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{"spdx", FormatSPDX, false},
+		{"CycloneDX", FormatCycloneDX, false},
+		{"syft", "", true},
+	} {
+		got, err := ParseFormat(x.name)
+		if got != x.want || (err != nil) != x.wantErr {
+			t.Errorf("%s: got %q, %v", x.name, got, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// https://spdx.github.io/spdx-spec/v2.3/
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxFile struct {
+	FileName  string         `json:"fileName"`
+	SPDXID    string         `json:"SPDXID"`
+	Checksums []spdxChecksum `json:"checksums"`
+	Comment   string         `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func generateSPDX(pkg *Package) ([]byte, error) {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%s", pkg.Name, pkg.Version),
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s-%s", pkg.Name, pkg.Version, documentID(pkg)),
+		CreationInfo: spdxCreationInfo{
+			Created:  pkg.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName},
+		},
+		Packages: []spdxPackage{{
+			Name:             pkg.Name,
+			SPDXID:           "SPDXRef-Package",
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+		}},
+		Files: []spdxFile{},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: "SPDXRef-Package",
+		}},
+	}
+	modules := make(map[string]string)
+	for i, f := range pkg.Files {
+		fileID := fmt.Sprintf("SPDXRef-File-%d", i)
+		doc.Files = append(doc.Files, spdxFile{
+			FileName:  "./" + f.Name,
+			SPDXID:    fileID,
+			Checksums: []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: f.SHA256}},
+			Comment:   fmt.Sprintf("size: %d, mode: %s", f.Size, f.Mode),
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-Package",
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: fileID,
+		})
+		if f.GoBuildInfo == nil {
+			continue
+		}
+		for _, m := range goModules(f.GoBuildInfo) {
+			moduleID, ok := modules[purl(m)]
+			if !ok {
+				moduleID = fmt.Sprintf("SPDXRef-GoModule-%d", len(modules))
+				modules[purl(m)] = moduleID
+				doc.Packages = append(doc.Packages, spdxPackage{
+					Name:             m.Path,
+					SPDXID:           moduleID,
+					VersionInfo:      m.Version,
+					DownloadLocation: "NOASSERTION",
+					LicenseConcluded: "NOASSERTION",
+					ExternalRefs: []spdxExternalRef{{
+						ReferenceCategory: "PACKAGE-MANAGER",
+						ReferenceType:     "purl",
+						ReferenceLocator:  purl(m),
+					}},
+				})
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      fileID,
+				RelationshipType:   "CONTAINS",
+				RelatedSPDXElement: moduleID,
+			})
+		}
+		doc.Files[len(doc.Files)-1].Comment += ", built with " + f.GoBuildInfo.GoVersion
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -0,0 +1,168 @@
+// Package sign signs and verifies package manifest digests with local ed25519 or ECDSA keys,
+// in the simple signing format of cosign, see
+// https://github.com/sigstore/cosign/blob/main/specs/SIGNATURE_SPEC.md
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// MediaTypeSimpleSigning is the media type of the signed payload layers
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// AnnotationSignature holds the base64 encoded signature of a payload layer
+	AnnotationSignature = "dev.cosignproject.cosign/signature"
+
+	simpleSigningType = "cosign container image signature"
+)
+
+var (
+	// ErrNoSignature is returned when the package has no signature
+	ErrNoSignature = errors.New("no signature")
+	// ErrInvalidSignature is returned when no signature of the package is valid for the key
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// SimpleSigning is the payload which is signed
+type SimpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]any `json:"optional"`
+}
+
+// Signature is a payload and its signature
+type Signature struct {
+	Payload   []byte
+	Signature []byte
+}
+
+// Payload returns the simple signing payload of the manifest digest of the repository dockerReference
+// (e.g. ghcr.io/example/hello)
+func Payload(dockerReference string, digest string) ([]byte, error) {
+	var ss SimpleSigning
+	ss.Critical.Identity.DockerReference = dockerReference
+	ss.Critical.Image.DockerManifestDigest = digest
+	ss.Critical.Type = simpleSigningType
+	return json.Marshal(ss)
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS #8 or SEC 1 (EC PRIVATE KEY) ed25519 or ECDSA private key
+func LoadPrivateKey(filePath string) (crypto.Signer, error) {
+	block, err := readPEM(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "EC PRIVATE KEY" {
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if strings.Contains(block.Type, "ENCRYPTED") {
+		return nil, fmt.Errorf("%s: encrypted private keys are not supported", filePath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported key type %T, expected ed25519 or ECDSA", filePath, key)
+}
+
+// LoadPublicKey reads a PEM encoded PKIX ed25519 or ECDSA public key, such as cosign.pub
+func LoadPublicKey(filePath string) (crypto.PublicKey, error) {
+	block, err := readPEM(filePath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported key type %T, expected ed25519 or ECDSA", filePath, key)
+}
+
+func readPEM(filePath string) (*pem.Block, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", filePath)
+	}
+	return block, nil
+}
+
+// Sign signs payload, ECDSA keys sign its SHA-256 digest
+func Sign(key crypto.Signer, payload []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, payload, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(payload)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// VerifyPayload reports whether signature is the signature of payload made with the private key of pub
+func VerifyPayload(pub crypto.PublicKey, payload []byte, signature []byte) bool {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	}
+	return false
+}
+
+// Verify succeeds when one of sigs is signed by pub and its payload is about the manifest digest of the
+// repository dockerReference (e.g. ghcr.io/example/hello), a signature made for another repository is refused
+func Verify(pub crypto.PublicKey, dockerReference string, digest string, sigs []Signature) error {
+	if len(sigs) == 0 {
+		return fmt.Errorf("%s: %w", digest, ErrNoSignature)
+	}
+	for _, sig := range sigs {
+		if !VerifyPayload(pub, sig.Payload, sig.Signature) {
+			continue
+		}
+		var ss SimpleSigning
+		err := json.Unmarshal(sig.Payload, &ss)
+		if err != nil {
+			continue
+		}
+		if ss.Critical.Type == simpleSigningType && ss.Critical.Image.DockerManifestDigest == digest &&
+			ss.Critical.Identity.DockerReference == dockerReference {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", digest, ErrInvalidSignature)
+}
+
+// SignatureTag returns the tag of the signatures of the manifest digest, e.g. sha256-<hex>.sig
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
@@ -0,0 +1,106 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDigest = "sha256:5fb1f81b5ec69f79b7131d7257c44e14affda91d835a62f3928d662910b593a8"
+
+// writeKeys writes key and its public key as PEM files and returns their paths
+func writeKeys(t *testing.T, key crypto.Signer) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath := filepath.Join(dir, "key.pem")
+	pubPath := filepath.Join(dir, "pub.pem")
+	err = os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv}), 0600)
+	if err == nil {
+		err = os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0664)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath
+}
+
+func TestSignVerify(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	for _, x := range []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{"ed25519", edKey},
+		{"ecdsa", ecKey},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			privPath, pubPath := writeKeys(t, x.key)
+			key, err := LoadPrivateKey(privPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := LoadPublicKey(pubPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, err := Payload("ghcr.io/example/hello", testDigest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := Sign(key, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherSignature, _ := Sign(otherKey, payload)
+			otherPayload, _ := Payload("ghcr.io/example/hello", "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+			otherPayloadSignature, _ := Sign(key, otherPayload)
+			otherRepoPayload, _ := Payload("ghcr.io/other/hello", testDigest)
+			otherRepoSignature, _ := Sign(key, otherRepoPayload)
+
+			tests := []struct {
+				name string
+				sigs []Signature
+				want error
+			}{
+				{"valid", []Signature{{payload, signature}}, nil},
+				{"one valid of several", []Signature{{payload, otherSignature}, {payload, signature}}, nil},
+				{"unsigned", nil, ErrNoSignature},
+				{"other key", []Signature{{payload, otherSignature}}, ErrInvalidSignature},
+				{"other digest", []Signature{{otherPayload, otherPayloadSignature}}, ErrInvalidSignature},
+				{"other repository", []Signature{{otherRepoPayload, otherRepoSignature}}, ErrInvalidSignature},
+				{"tampered payload", []Signature{{append(payload[:len(payload):len(payload)], ' '), signature}}, ErrInvalidSignature},
+			}
+			for _, tt := range tests {
+				err := Verify(pub, "ghcr.io/example/hello", testDigest, tt.sigs)
+				if !errors.Is(err, tt.want) {
+					t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSignatureTag(t *testing.T) {
+	want := "sha256-5fb1f81b5ec69f79b7131d7257c44e14affda91d835a62f3928d662910b593a8.sig"
+	if got := SignatureTag(testDigest); got != want {
+		t.Errorf("%s != %s", got, want)
+	}
+}
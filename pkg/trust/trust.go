@@ -0,0 +1,222 @@
+// Package trust checks the packages about to be downloaded against a trust policy: which
+// repositories are allowed, which keys are trusted to sign them and what they must carry
+package trust
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/pkg/provenance"
+	"github.com/akkuman/blob-uploader/pkg/sbom"
+	"github.com/akkuman/blob-uploader/pkg/sign"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrRefused is returned when a package violates the trust policy
+var ErrRefused = errors.New("refused by trust policy")
+
+// Policy is the trust policy of downloads, it is loaded from a YAML file, e.g.
+//
+//	repositories:
+//	  - pattern: ghcr.io/example/*
+//	    keys:
+//	      - keys/example.pub
+//	    require_sbom: true
+//	    require_provenance: true
+//	    min_version: 1.2.0
+//	  - pattern: ghcr.io/pkgforge/*
+//	deny_digests:
+//	  - sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+//
+// A package is allowed when its repository matches one of the patterns, the first matching
+// rule applies. The key files are relative to the directory of the policy file.
+//
+// Patterns are matched per path component: * and the other path.Match wildcards don't cross /,
+// so ghcr.io/example/* doesn't match ghcr.io/example/team/wget, while a ** component matches one
+// or more components, e.g. ghcr.io/example/** matches both.
+type Policy struct {
+	Repositories []Rule   `yaml:"repositories"`
+	DenyDigests  []string `yaml:"deny_digests"`
+}
+
+type Rule struct {
+	// Pattern is a glob matched against registry/repository, e.g. ghcr.io/example/* or ghcr.io/example/**
+	Pattern string `yaml:"pattern"`
+	// Keys are the PEM encoded public keys trusted to sign the packages, no signature is required when empty
+	Keys              []string `yaml:"keys"`
+	RequireSBOM       bool     `yaml:"require_sbom"`
+	RequireProvenance bool     `yaml:"require_provenance"`
+	// MinVersion is the lowest version allowed, the tags which aren't versions are refused when it is set
+	MinVersion string `yaml:"min_version"`
+
+	keys []crypto.PublicKey
+}
+
+// Package is what is known about a package when it is checked
+type Package struct {
+	// Repository is the registry/repository of the package, e.g. ghcr.io/example/hello
+	Repository string
+	Tag        string
+	// Digest is the digest of the index
+	Digest string
+	// ManifestDigests are the digests of the platform manifests of the index
+	ManifestDigests []string
+	// Signatures are the signatures of the index, only needed when the rule has keys
+	Signatures []sign.Signature
+	// ArtifactTypes are the artifact types of the referrers of the index and of the platform manifest,
+	// only needed when the rule requires a SBOM or a provenance
+	ArtifactTypes []string
+}
+
+// Load reads the policy file at filePath and the keys it refers to
+func Load(filePath string) (*Policy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, filepath.Dir(filePath))
+}
+
+// Parse parses a YAML policy, the key files are relative to baseDir
+func Parse(data []byte, baseDir string) (*Policy, error) {
+	p := &Policy{}
+	err := yaml.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("parse trust policy failed: %w", err)
+	}
+	for i := range p.Repositories {
+		rule := &p.Repositories[i]
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("repository rule without pattern")
+		}
+		for _, elem := range strings.Split(rule.Pattern, "/") {
+			if _, err := path.Match(elem, ""); err != nil {
+				return nil, fmt.Errorf("repository pattern %s: %w", rule.Pattern, err)
+			}
+		}
+		if rule.MinVersion != "" && !util.IsVersion(rule.MinVersion) {
+			return nil, fmt.Errorf("repository %s: min_version %q is not a version", rule.Pattern, rule.MinVersion)
+		}
+		for _, keyFile := range rule.Keys {
+			if !filepath.IsAbs(keyFile) {
+				keyFile = filepath.Join(baseDir, keyFile)
+			}
+			pub, err := sign.LoadPublicKey(keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("repository %s: %w", rule.Pattern, err)
+			}
+			rule.keys = append(rule.keys, pub)
+		}
+	}
+	for _, digest := range p.DenyDigests {
+		if !strings.HasPrefix(digest, "sha256:") {
+			return nil, fmt.Errorf("denied digest %q is not in the form of sha256:<hex>", digest)
+		}
+	}
+	return p, nil
+}
+
+// Rule returns the rule of the repository (e.g. ghcr.io/example/hello), it fails when no rule allows it
+func (p *Policy) Rule(repository string) (*Rule, error) {
+	for i := range p.Repositories {
+		if match(strings.Split(p.Repositories[i].Pattern, "/"), strings.Split(repository, "/")) {
+			return &p.Repositories[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: repository %s is not allowed", ErrRefused, repository)
+}
+
+// match reports whether the components of a repository match the components of a pattern,
+// a ** component matches one or more components
+func match(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 1; i <= len(name); i++ {
+			if match(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && match(pattern[1:], name[1:])
+}
+
+// Signed reports whether the rule requires signatures
+func (r *Rule) Signed() bool {
+	return len(r.keys) > 0
+}
+
+// NeedsReferrers reports whether the rule requires a SBOM or a provenance referrer
+func (r *Rule) NeedsReferrers() bool {
+	return r.RequireSBOM || r.RequireProvenance
+}
+
+// Check checks pkg against the policy, the error explains every violation
+func (p *Policy) Check(pkg *Package) error {
+	rule, err := p.Rule(pkg.Repository)
+	if err != nil {
+		return err
+	}
+	var reasons []string
+	for _, denied := range p.DenyDigests {
+		for _, digest := range append([]string{pkg.Digest}, pkg.ManifestDigests...) {
+			if digest == denied {
+				reasons = append(reasons, fmt.Sprintf("digest %s is denied", digest))
+			}
+		}
+	}
+	if rule.MinVersion != "" {
+		cmp, err := util.CompareVersions(pkg.Tag, rule.MinVersion)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("tag %s is not a version, the minimum version is %s", pkg.Tag, rule.MinVersion))
+		} else if cmp < 0 {
+			reasons = append(reasons, fmt.Sprintf("version %s is lower than the minimum version %s", pkg.Tag, rule.MinVersion))
+		}
+	}
+	if rule.Signed() && !rule.verify(pkg) {
+		reasons = append(reasons, fmt.Sprintf("not signed by a key trusted for %s", rule.Pattern))
+	}
+	if rule.RequireSBOM && !hasArtifactType(pkg.ArtifactTypes, sbom.FormatSPDX.ArtifactType(), sbom.FormatCycloneDX.ArtifactType()) {
+		reasons = append(reasons, "no SBOM is attached")
+	}
+	if rule.RequireProvenance && !hasArtifactType(pkg.ArtifactTypes, provenance.ArtifactTypeStatement, provenance.ArtifactTypeEnvelope) {
+		reasons = append(reasons, "no provenance is attached")
+	}
+	if len(reasons) > 0 {
+		return fmt.Errorf("%w: %s", ErrRefused, strings.Join(reasons, "; "))
+	}
+	return nil
+}
+
+// verify reports whether the index of pkg is signed by one of the keys of the rule
+func (r *Rule) verify(pkg *Package) bool {
+	for _, pub := range r.keys {
+		if sign.Verify(pub, pkg.Repository, pkg.Digest, pkg.Signatures) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasArtifactType(artifactTypes []string, wanted ...string) bool {
+	for _, t := range artifactTypes {
+		for _, w := range wanted {
+			if t == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package trust
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/pkg/provenance"
+	"github.com/akkuman/blob-uploader/pkg/sbom"
+	"github.com/akkuman/blob-uploader/pkg/sign"
+)
+
+const (
+	testDigest   = "sha256:5fb1f81b5ec69f79b7131d7257c44e14affda91d835a62f3928d662910b593a8"
+	deniedDigest = "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+)
+
+const testPolicy = `
+repositories:
+  - pattern: ghcr.io/example/*
+    keys:
+      - example.pub
+    require_sbom: true
+    require_provenance: true
+    min_version: 1.2.0
+  - pattern: ghcr.io/pkgforge/*
+  - pattern: ghcr.io/team/**
+deny_digests:
+  - ` + deniedDigest + `
+`
+
+func TestCheck(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "example.pub"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0664)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "trust.yaml"), []byte(testPolicy), 0664)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(filepath.Join(dir, "trust.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := sign.Payload("ghcr.io/example/hello", testDigest)
+	sig, err := sign.Sign(key, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := []sign.Signature{{Payload: payload, Signature: sig}}
+	attached := []string{sbom.FormatSPDX.ArtifactType(), provenance.ArtifactTypeEnvelope}
+
+	tests := []struct {
+		name    string
+		pkg     Package
+		reasons []string
+	}{
+		{"trusted", Package{Repository: "ghcr.io/example/hello", Tag: "1.2.0", Digest: testDigest, Signatures: signed, ArtifactTypes: attached}, nil},
+		{"other repository", Package{Repository: "docker.io/library/hello", Tag: "1.2.0", Digest: testDigest}, []string{"is not allowed"}},
+		{"nested repository", Package{Repository: "ghcr.io/example/tools/hello", Tag: "1.2.0", Digest: testDigest}, []string{"is not allowed"}},
+		{"nested repository of a ** pattern", Package{Repository: "ghcr.io/team/tools/hello", Tag: "latest", Digest: testDigest}, nil},
+		{"owner of a ** pattern", Package{Repository: "ghcr.io/team", Tag: "latest", Digest: testDigest}, []string{"is not allowed"}},
+		{"any package of a repository without rules", Package{Repository: "ghcr.io/pkgforge/wget", Tag: "latest", Digest: testDigest}, nil},
+		{"denied manifest", Package{Repository: "ghcr.io/pkgforge/wget", Tag: "1.0", Digest: testDigest, ManifestDigests: []string{deniedDigest}}, []string{"is denied"}},
+		{"old version", Package{Repository: "ghcr.io/example/hello", Tag: "v1.1.9", Digest: testDigest, Signatures: signed, ArtifactTypes: attached}, []string{"lower than the minimum version 1.2.0"}},
+		{"not a version", Package{Repository: "ghcr.io/example/hello", Tag: "nightly", Digest: testDigest, Signatures: signed, ArtifactTypes: attached}, []string{"is not a version"}},
+		{"unsigned and bare", Package{Repository: "ghcr.io/example/hello", Tag: "1.3.0", Digest: testDigest}, []string{"not signed", "no SBOM", "no provenance"}},
+		{"signature of another digest", Package{Repository: "ghcr.io/example/hello", Tag: "1.3.0", Digest: deniedDigest, Signatures: signed, ArtifactTypes: attached}, []string{"is denied", "not signed"}},
+	}
+	for _, tt := range tests {
+		err := p.Check(&tt.pkg)
+		if len(tt.reasons) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrRefused) {
+			t.Errorf("%s: got %v, want refused", tt.name, err)
+			continue
+		}
+		for _, reason := range tt.reasons {
+			if !strings.Contains(err.Error(), reason) {
+				t.Errorf("%s: %q doesn't explain %q", tt.name, err, reason)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, data := range []string{
+		"repositories:\n  - keys: [a.pub]\n",
+		"repositories:\n  - pattern: ghcr.io/[\n",
+		"repositories:\n  - pattern: ghcr.io/*\n    min_version: latest\n",
+		"repositories:\n  - pattern: ghcr.io/*\n    keys: [missing.pub]\n",
+		"deny_digests: [2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae]\n",
+	} {
+		if _, err := Parse([]byte(data), t.TempDir()); err == nil {
+			t.Errorf("%q is accepted", data)
+		}
+	}
+}
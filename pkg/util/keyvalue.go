@@ -0,0 +1,54 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ParseKeyValue parses text in the form of key=value
+func ParseKeyValue(text string) (key string, value string, err error) {
+	key, value, ok := strings.Cut(text, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("%q is not in the form of key=value", text)
+	}
+	return key, value, nil
+}
+
+// ParseKeyValues parses a list of key=value into a map, later keys override earlier ones
+func ParseKeyValues(texts []string) (map[string]string, error) {
+	m := make(map[string]string, len(texts))
+	for _, text := range texts {
+		k, v, err := ParseKeyValue(text)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// ReadKeyValueFile reads a file containing one key=value per line,
+// blank lines and lines starting with # are ignored
+func ReadKeyValueFile(filePath string) (map[string]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var texts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		texts = append(texts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ParseKeyValues(texts)
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseKeyValue(t *testing.T) {
+	for _, x := range []struct {
+		text       string
+		key, value string
+		ok         bool
+	}{
+		{"a=b", "a", "b", true},
+		{" a =b", "a", "b", true},
+		{"a=", "a", "", true},
+		{"a=b=c", "a", "b=c", true},
+		{"org.opencontainers.image.url=https://example.com/?q=1", "org.opencontainers.image.url", "https://example.com/?q=1", true},
+		{"=b", "", "", false},
+		{" =b", "", "", false},
+		{"a", "", "", false},
+		{"", "", "", false},
+	} {
+		key, value, err := ParseKeyValue(x.text)
+		if (err == nil) != x.ok {
+			t.Errorf("ParseKeyValue(%q): unexpected error %v", x.text, err)
+			continue
+		}
+		if key != x.key || value != x.value {
+			t.Errorf("ParseKeyValue(%q) = %q, %q, want %q, %q", x.text, key, value, x.key, x.value)
+		}
+	}
+}
+
+func TestReadKeyValueFile(t *testing.T) {
+	for _, x := range []struct {
+		name    string
+		content string
+		want    map[string]string
+		ok      bool
+	}{
+		{"empty", "", map[string]string{}, true},
+		{"comments and blank lines", "# comment\n\n  # indented comment\na=b\n\n", map[string]string{"a": "b"}, true},
+		{"equal sign in value", "a=b=c\n", map[string]string{"a": "b=c"}, true},
+		{"later keys override", "a=1\nb=2\na=3\n", map[string]string{"a": "3", "b": "2"}, true},
+		{"crlf", "a=b\r\nc=d\r\n", map[string]string{"a": "b", "c": "d"}, true},
+		{"empty key", "a=b\n=c\n", nil, false},
+		{"missing equal sign", "a\n", nil, false},
+	} {
+		filePath := filepath.Join(t.TempDir(), "annotations")
+		err := os.WriteFile(filePath, []byte(x.content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadKeyValueFile(filePath)
+		if (err == nil) != x.ok {
+			t.Errorf("%s: unexpected error %v", x.name, err)
+			continue
+		}
+		if x.ok && !maps.Equal(got, x.want) {
+			t.Errorf("%s: got %v, want %v", x.name, got, x.want)
+		}
+	}
+	if _, err := ReadKeyValueFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("a missing file is read")
+	}
+}
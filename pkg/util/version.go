@@ -0,0 +1,79 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two versions such as 1.2.0, v1.10 or 2.0.0-rc.1 and returns -1, 0 or +1.
+// The numeric parts are compared in order, missing parts count as 0, and a pre-release
+// (the part after "-") is lower than the release itself.
+func CompareVersions(a string, b string) (int, error) {
+	na, pa, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	nb, pb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(na) || i < len(nb); i++ {
+		var x, y int
+		if i < len(na) {
+			x = na[i]
+		}
+		if i < len(nb) {
+			y = nb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	switch {
+	case pa == pb:
+		return 0, nil
+	case pa == "":
+		return 1, nil
+	case pb == "":
+		return -1, nil
+	case pa < pb:
+		return -1, nil
+	}
+	return 1, nil
+}
+
+// SemverRelease matches the tags of semver releases, e.g. 1.2.0 or v1.2.0, pre-releases excluded
+const SemverRelease = `^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(\+[0-9A-Za-z.-]+)?$`
+
+var semverRelease = regexp.MustCompile(SemverRelease)
+
+// IsSemverRelease reports whether tag matches SemverRelease
+func IsSemverRelease(tag string) bool {
+	return semverRelease.MatchString(tag)
+}
+
+// IsVersion reports whether text is a version accepted by CompareVersions
+func IsVersion(text string) bool {
+	_, _, err := parseVersion(text)
+	return err == nil
+}
+
+// parseVersion splits a version into its numeric parts and its pre-release, build metadata is dropped
+func parseVersion(text string) ([]int, string, error) {
+	v, _, _ := strings.Cut(strings.TrimPrefix(text, "v"), "+")
+	v, pre, _ := strings.Cut(v, "-")
+	var nums []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, "", fmt.Errorf("%q is not a version", text)
+		}
+		nums = append(nums, n)
+	}
+	return nums, pre, nil
+}
@@ -0,0 +1,31 @@
+package util
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	for _, x := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"v1.2", "1.2.0", 0},
+		{"1.10.0", "1.9.3", 1},
+		{"1.2.0-rc.1", "1.2.0", -1},
+		{"1.2.0-rc.1", "1.2.0-rc.2", -1},
+		{"2", "1.99.99", 1},
+		{"1.2.0+build.5", "1.2.0", 0},
+	} {
+		got, err := CompareVersions(x.a, x.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != x.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", x.a, x.b, got, x.want)
+		}
+	}
+	for _, v := range []string{"latest", "1.x", ""} {
+		if IsVersion(v) {
+			t.Errorf("%q is a version", v)
+		}
+	}
+}
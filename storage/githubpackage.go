@@ -2,9 +2,14 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/akkuman/blob-uploader/oci"
 	"github.com/akkuman/blob-uploader/pkg/regctl"
@@ -27,22 +32,117 @@ func NewGithubPackageStorage(ociInstance *oci.OCI, registry *regctl.Registry) *G
 	}
 }
 
-func (s *GithubPackageStorage) Upload(ctx context.Context, imageRef string, platform util.Platform, imageSource string, reader io.Reader) error {
+// anonymousRegistry returns the client used to pull, it shares the options of the registry if any
+func (s *GithubPackageStorage) anonymousRegistry() *regctl.AnonymousRegistry {
+	if s.registry != nil {
+		return &s.registry.AnonymousRegistry
+	}
+	return regctl.NewAnonymousRegistry()
+}
+
+func (s *GithubPackageStorage) Upload(ctx context.Context, imageRef string, platform util.Platform, imageSource string, reader io.Reader, opts ...UploadOption) error {
+	opt := &uploadOptions{}
+	for _, o := range opts {
+		o(opt)
+	}
 	r, err := ref.New(imageRef)
 	if err != nil {
 		return err
 	}
 	imageRef = fmt.Sprintf("%s:%s", r.Repository, r.Tag)
-	blobFilePath, err := util.WriteToTempFile(reader, "blob.*.tar.gz")
+	// reader may be nil when the package only consists of the files of WithFiles
+	var blobFilePath string
+	if reader != nil {
+		blobFilePath, err = util.WriteToTempFile(reader, "blob.*.tar.gz")
+		if err != nil {
+			return fmt.Errorf("write blob to file failed: %w", err)
+		}
+		defer os.Remove(blobFilePath)
+	}
+	buildOpts, err := opt.buildOptions(r)
 	if err != nil {
-		return fmt.Errorf("write blob to file failed: %w", err)
+		return err
+	}
+	// build builds the package into the layout of o and returns the digest of its index, created overrides
+	// the created annotation unless blank and replaces is the digest the tag pointed to before, if any
+	build := func(o *oci.OCI, created string, replaces string) (string, error) {
+		extra := make(map[string]string)
+		if created != "" {
+			extra[oci.AnnotationCreated] = created
+		}
+		if replaces != "" {
+			extra[oci.AnnotationReplaces] = replaces
+		}
+		err := o.BuildOCI(ctx, platform, blobFilePath, r.Tag, imageSource, append(slices.Clone(buildOpts), oci.WithAnnotations(extra))...)
+		if err != nil {
+			return "", fmt.Errorf("build oci failed: %w", err)
+		}
+		d, err := oci.OpenLayout(o.GetRootDir()).Resolve(r.Tag)
+		return d.Digest, err
+	}
+	if opt.dryRun {
+		_, err = build(s.ociInstance, "", "")
+		return err
+	}
+	fullRef := s.registry.GetRefFullName(imageRef)
+	remoteDigest, err := s.registry.Digest(ctx, fullRef)
+	if err != nil && !errors.Is(err, regctl.ErrNotFound) {
+		return fmt.Errorf("get digest of %s: %w", fullRef, err)
+	}
+	if remoteDigest != "" {
+		annotations, err := opt.buildAnnotations(r)
+		if err != nil {
+			return err
+		}
+		// the comparison builds go to a throwaway layout so that only the pushed build is left in ociInstance
+		same := func(created string, replaces string) (bool, error) {
+			o := oci.NewOCI()
+			defer o.Close()
+			digest, err := build(o, created, replaces)
+			return digest == remoteDigest, err
+		}
+		// a package built with a given created annotation (e.g. from SOURCE_DATE_EPOCH) matches the remote tag
+		// unless the tag records a replaced digest, the remote manifest isn't needed then
+		upToDate := false
+		if annotations[oci.AnnotationCreated] != "" {
+			upToDate, err = same("", "")
+			if err != nil {
+				return err
+			}
+		}
+		if !upToDate {
+			var remoteAnnotations map[string]string
+			remoteDigest, remoteAnnotations, err = s.registry.Annotations(ctx, fullRef)
+			if err != nil {
+				return fmt.Errorf("get manifest of %s: %w", fullRef, err)
+			}
+			// the created annotation is the only difference between two builds of the same content, unless it is
+			// given the package is built as created at the time of the remote tag, and replacing the same digest
+			// as the remote tag
+			created := ""
+			if annotations[oci.AnnotationCreated] == "" {
+				created = remoteAnnotations[oci.AnnotationCreated]
+			}
+			if created != "" || remoteAnnotations[oci.AnnotationReplaces] != "" {
+				upToDate, err = same(created, remoteAnnotations[oci.AnnotationReplaces])
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if upToDate {
+			return fmt.Errorf("%s@%s: %w", fullRef, remoteDigest, ErrUpToDate)
+		}
+		if opt.immutable(r.Tag) && !opt.overwrite {
+			return fmt.Errorf("%s points to %s already, refusing to overwrite it: %w", fullRef, remoteDigest, ErrImmutableTag)
+		}
 	}
-	defer os.Remove(blobFilePath)
-	err = s.ociInstance.BuildOCI(ctx, platform, blobFilePath, s.registry.GetVersion(imageRef), imageSource)
+	// the content changed, the package is built as created now and records the digest it replaces
+	_, err = build(s.ociInstance, "", remoteDigest)
 	if err != nil {
-		return fmt.Errorf("build oci failed: %w", err)
+		return err
 	}
-	defer s.ociInstance.Close()
+	// the blobs which the registry has already are skipped
 	err = s.registry.ImageCopy(ctx, s.ociInstance.GetRootDir(), imageRef)
 	if err != nil {
 		return fmt.Errorf("image copy: %w", err)
@@ -50,30 +150,135 @@ func (s *GithubPackageStorage) Upload(ctx context.Context, imageRef string, plat
 	return nil
 }
 
-func (s *GithubPackageStorage) Download(ctx context.Context, imageRef string, platform util.Platform, writer io.Writer) error {
-	r, err := ref.New(imageRef)
+func (s *GithubPackageStorage) Download(ctx context.Context, imageRef string, platform util.Platform, writer io.Writer, opts ...DownloadOption) error {
+	refName, fileDigest, err := s.Locate(ctx, imageRef, platform, opts...)
 	if err != nil {
 		return err
 	}
-	rg := regctl.NewAnonymousRegistry()
+	h := sha256.New()
+	err = s.anonymousRegistry().DownloadBlob(ctx, refName, fileDigest, io.MultiWriter(writer, h))
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != fileDigest {
+		return fmt.Errorf("%s: digest of the downloaded blob is sha256:%s, not sha256:%s", refName, got, fileDigest)
+	}
+	return nil
+}
+
+// digestOf returns the sha256 digest of data, e.g. sha256:<hex>
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Locate resolves imageRef and returns the ref of the resolved tag
+// and the hex digest of the blob which Download writes
+func (s *GithubPackageStorage) Locate(ctx context.Context, imageRef string, platform util.Platform, opts ...DownloadOption) (refName string, hexdigest string, err error) {
+	opt := &downloadOptions{}
+	for _, o := range opts {
+		o(opt)
+	}
+	rg := s.anonymousRegistry()
+	refName, indexDigest, mf, err := s.resolve(ctx, rg, imageRef, platform)
+	if err != nil {
+		return "", "", err
+	}
+	for _, verifier := range opt.verifiers {
+		err = verifier(ctx, refName, indexDigest)
+		if err != nil {
+			return "", "", fmt.Errorf("verify %s: %w", refName, err)
+		}
+	}
+	if opt.metadata != nil {
+		annotations := make(map[string]string)
+		for k, v := range mf.Get("annotations").Map() {
+			annotations[k] = v.String()
+		}
+		md, err := ParseMetadata(annotations)
+		if err != nil {
+			return "", "", err
+		}
+		*opt.metadata = *md
+	}
+	hexdigest = mf.Get(`annotations.dev\.pkgforge\.bin\.digest`).String()
+	if opt.fileName == "" && hexdigest == "" {
+		return "", "", fmt.Errorf("%s: %w", refName, ErrNoArchive)
+	}
+	if opt.fileName != "" {
+		manifestDigest := mf.Get("digest").String()
+		manifest, err := rg.GetImageManifest(ctx, refName, manifestDigest)
+		if err != nil {
+			return "", "", err
+		}
+		if digestOf([]byte(manifest)) != manifestDigest {
+			return "", "", fmt.Errorf("%s: the manifest doesn't match its digest %s", refName, manifestDigest)
+		}
+		hexdigest, err = findLayerByTitle(manifest, opt.fileName)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", refName, err)
+		}
+	}
+	return refName, hexdigest, nil
+}
+
+// findLayerByTitle returns the hex digest of the layer whose title annotation is fileName
+func findLayerByTitle(manifest string, fileName string) (string, error) {
+	var titles []string
+	for _, layer := range gjson.Get(manifest, "layers").Array() {
+		title := layer.Get(`annotations.org\.opencontainers\.image\.title`).String()
+		if title == fileName {
+			return strings.TrimPrefix(layer.Get("digest").String(), "sha256:"), nil
+		}
+		if title != "" {
+			titles = append(titles, title)
+		}
+	}
+	return "", fmt.Errorf("file %s not found, available files: %s", fileName, strings.Join(titles, ", "))
+}
+
+func (s *GithubPackageStorage) GetMetadata(ctx context.Context, imageRef string, platform util.Platform) (*Metadata, error) {
+	rg := s.anonymousRegistry()
+	_, _, mf, err := s.resolve(ctx, rg, imageRef, platform)
+	if err != nil {
+		return nil, err
+	}
+	annotations := make(map[string]string)
+	for k, v := range mf.Get("annotations").Map() {
+		annotations[k] = v.String()
+	}
+	return ParseMetadata(annotations)
+}
+
+// resolve resolves the tag of imageRef and returns the digest of its index and the index entry of platform
+func (s *GithubPackageStorage) resolve(ctx context.Context, rg *regctl.AnonymousRegistry, imageRef string, platform util.Platform) (refName string, indexDigest string, mf gjson.Result, err error) {
+	r, err := ref.New(imageRef)
+	if err != nil {
+		return
+	}
 	if r.Tag == "latest" {
-		tags, err := rg.GetTags(ctx, imageRef)
+		var tags []string
+		tags, err = rg.GetTags(ctx, imageRef)
 		if err != nil {
-			return err
+			return
+		}
+		tags = regctl.PackageTags(tags)
+		if len(tags) == 0 {
+			err = fmt.Errorf("%s has no tag: %w", imageRef, regctl.ErrNotFound)
+			return
 		}
 		r.Tag = tags[len(tags)-1]
 	}
-	refName := fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Tag)
+	refName = fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Tag)
 	manifest, err := rg.GetManifest(ctx, refName)
 	if err != nil {
-		return err
+		return
 	}
-	var fileDigest string
-	for _, mf := range gjson.Get(manifest, "manifests").Array() {
+	indexDigest = digestOf([]byte(manifest))
+	for _, mf = range gjson.Get(manifest, "manifests").Array() {
 		if mf.Get("platform.architecture").String() == platform.Arch && mf.Get("platform.os").String() == platform.OS {
-			fileDigest = mf.Get(`annotations.dev\.pkgforge\.bin\.digest`).String()
-			break
+			return refName, indexDigest, mf, nil
 		}
 	}
-	return rg.DownloadBlob(ctx, refName, fileDigest, writer)
+	return refName, indexDigest, gjson.Result{}, fmt.Errorf("%w: %s in %s", ErrPlatformNotFound, platform.String(), refName)
 }
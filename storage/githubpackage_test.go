@@ -1,53 +1,322 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/akkuman/blob-uploader/oci"
-	"github.com/akkuman/blob-uploader/pkg/compress"
 	"github.com/akkuman/blob-uploader/pkg/regctl"
+	"github.com/akkuman/blob-uploader/pkg/registry"
+	"github.com/akkuman/blob-uploader/pkg/registry/registrytest"
+	"github.com/akkuman/blob-uploader/pkg/sign"
 	"github.com/akkuman/blob-uploader/pkg/util"
 	_ "github.com/akkuman/blob-uploader/testinit"
 )
 
 func TestGithubPackageStorage(t *testing.T) {
-	username, ok := os.LookupEnv("GITHUB_USER")
-	if !ok {
-		t.Error("GITHUB_USER environment must to be set")
-		return
-	}
-	token, ok := os.LookupEnv("GITHUB_TOKEN")
-	if !ok {
-		t.Error("GITHUB_TOKEN environment must to be set")
-		return
-	}
-	reg := regctl.NewRegistry("ghcr.io", username, token)
+	srv := registrytest.New(t, registry.WithAuth("akkuman", "secret"))
+	reg := regctl.NewRegistry(srv.Host, "akkuman", "secret", regctl.WithPlainHTTP())
 	err := reg.Login()
 	if err != nil {
-		t.Error("connect github package error:", err)
-		return
+		t.Fatal("connect registry error:", err)
 	}
 	ociInstance := oci.NewOCI()
 	defer ociInstance.Close()
 	s := NewGithubPackageStorage(ociInstance, reg)
-	targzPath, err := compress.CompressToTmpFile([]string{"./_testdata/wget"})
+	_, blob := registrytest.Package(t)
+	imageSource := "https://github.com/akkuman/blob-uploader"
+	md := &Metadata{Description: "Internet file retriever", License: "GPL-3.0-or-later"}
+	err = s.Upload(context.Background(), "akkuman/wgettest:0.0.1", util.DefaultPlatform, imageSource, bytes.NewReader(blob),
+		WithMetadata(md), WithFiles("./_testdata/wget"))
 	if err != nil {
-		t.Error("compress to tar.gz failed:", err)
-		return
+		t.Fatal("upload to registry failed:", err)
 	}
-	defer os.Remove(targzPath)
-	f, err := os.Open(targzPath)
+
+	imageRef := srv.Host + "/akkuman/wgettest:0.0.1"
+	var buf bytes.Buffer
+	err = s.Download(context.Background(), imageRef, util.DefaultPlatform, &buf)
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal("download from registry failed:", err)
 	}
-	defer f.Close()
-	imageSource := "https://github.com/akkuman/blob-uploader"
-	err = s.Upload(context.Background(), "akkuman/wgettest:0.0.1", util.DefaultPlatform, imageSource, f)
+	if !bytes.Equal(buf.Bytes(), blob) {
+		t.Error("downloaded content differs from the uploaded one")
+	}
+
+	buf.Reset()
+	err = s.Download(context.Background(), srv.Host+"/akkuman/wgettest", util.DefaultPlatform, &buf, WithFileName("wget"))
+	if err != nil {
+		t.Fatal("download file from registry failed:", err)
+	}
+	want, _ := os.ReadFile("./_testdata/wget")
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("downloaded file differs from the uploaded one")
+	}
+
+	got, err := s.GetMetadata(context.Background(), imageRef, util.DefaultPlatform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "wgettest" || got.Version != "0.0.1" || got.License != md.License {
+		t.Errorf("unexpected metadata %+v", got)
+	}
+
+	var downloaded Metadata
+	err = s.Download(context.Background(), imageRef, util.DefaultPlatform, io.Discard, WithMetadataOut(&downloaded))
 	if err != nil {
-		t.Error("upload to github packages failed:", err)
-		return
+		t.Fatal(err)
+	}
+	if downloaded.Name != got.Name || downloaded.Version != got.Version || downloaded.License != got.License {
+		t.Errorf("downloaded metadata %+v, want %+v", downloaded, got)
+	}
+
+	err = s.Download(context.Background(), imageRef, util.Platform{OS: "linux", Arch: "arm64"}, &buf)
+	if err == nil {
+		t.Error("download of a missing platform must fail")
+	}
+}
+
+func TestGithubPackageStorageVerifier(t *testing.T) {
+	srv := registrytest.New(t, registry.WithAuth("akkuman", "secret"))
+	reg := regctl.NewRegistry(srv.Host, "akkuman", "secret", regctl.WithPlainHTTP())
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := registrytest.PushPackage(t, srv, "akkuman", "secret", "akkuman/wgettest", "1.0", "1.1")
+	ctx := context.Background()
+	// only 1.0 is signed
+	signedRef := srv.Host + "/akkuman/wgettest:1.0"
+	digest, err := reg.Digest(ctx, signedRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := sign.Payload(srv.Host+"/akkuman/wgettest", digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := sign.Sign(key, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reg.PushSignature(ctx, signedRef, digest, sign.Signature{Payload: payload, Signature: signature})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := func(ctx context.Context, refName string, digest string) error {
+		sigs, err := reg.Signatures(ctx, refName, digest)
+		if err != nil {
+			return err
+		}
+		return sign.Verify(key.Public(), srv.Host+"/akkuman/wgettest", digest, sigs)
+	}
+
+	s := NewGithubPackageStorage(nil, reg)
+	tests := []struct {
+		tag  string
+		want error
+	}{
+		{"1.0", nil},
+		{"1.1", sign.ErrNoSignature},
+		// the signature tag is not taken for the latest version
+		{"latest", sign.ErrNoSignature},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err = s.Download(ctx, srv.Host+"/akkuman/wgettest:"+tt.tag, util.DefaultPlatform, &buf, WithVerifier(verifier))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.tag, err, tt.want)
+		}
+		if err == nil && !bytes.Equal(buf.Bytes(), blob) {
+			t.Errorf("%s: downloaded content differs from the uploaded one", tt.tag)
+		}
+		if err != nil && buf.Len() > 0 {
+			t.Errorf("%s: content written before verification", tt.tag)
+		}
+	}
+}
+
+func TestGithubPackageStorageUpToDate(t *testing.T) {
+	var blobUploads, manifestPuts, manifestGets atomic.Int32
+	handler := registry.New(registry.WithAuth("akkuman", "secret"))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/"):
+			manifestGets.Add(1)
+		case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/blobs/uploads/"):
+			blobUploads.Add(1)
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/"):
+			manifestPuts.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	reg := regctl.NewRegistry(strings.TrimPrefix(s.URL, "http://"), "akkuman", "secret", regctl.WithPlainHTTP())
+	_, blob := registrytest.Package(t)
+	ctx := context.Background()
+	upload := func(opts ...UploadOption) error {
+		ociInstance := oci.NewOCI()
+		defer ociInstance.Close()
+		return NewGithubPackageStorage(ociInstance, reg).Upload(ctx, "akkuman/wgettest:1.0", util.DefaultPlatform, "", bytes.NewReader(blob), opts...)
+	}
+	err := upload(WithAnnotations(map[string]string{oci.AnnotationCreated: "2020-01-01T00:00:00Z"}))
+	if err != nil {
+		t.Fatal("upload to registry failed:", err)
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		upToDate    bool
+		// getManifest tells whether the remote manifest is fetched for the comparison, HEAD is enough otherwise
+		getManifest bool
+	}{
+		// a reproducible build is compared without fetching the remote manifest
+		{"same created", map[string]string{oci.AnnotationCreated: "2020-01-01T00:00:00Z"}, true, false},
+		// the created annotation of the remote tag is reused
+		{"same content", nil, true, true},
+		{"new annotation", map[string]string{"org.example.channel": "stable"}, false, true},
+		{"same content again", map[string]string{"org.example.channel": "stable"}, true, true},
+		{"given created", map[string]string{"org.example.channel": "stable", oci.AnnotationCreated: "2024-01-01T00:00:00Z"}, false, true},
+		// the remote tag records the replaced digest now
+		{"given created again", map[string]string{"org.example.channel": "stable", oci.AnnotationCreated: "2024-01-01T00:00:00Z"}, true, true},
+	}
+	for _, x := range tests {
+		blobUploads.Store(0)
+		manifestPuts.Store(0)
+		manifestGets.Store(0)
+		err = upload(WithAnnotations(x.annotations))
+		if x.upToDate != errors.Is(err, ErrUpToDate) || (!x.upToDate && err != nil) {
+			t.Fatalf("%s: got %v, want up to date %v", x.name, err, x.upToDate)
+		}
+		// the blobs are in the registry already whatever the annotations
+		if n := blobUploads.Load(); n != 0 {
+			t.Errorf("%s: uploaded %d blobs", x.name, n)
+		}
+		if n := manifestPuts.Load(); (n == 0) != x.upToDate {
+			t.Errorf("%s: put %d manifests", x.name, n)
+		}
+		if n := manifestGets.Load(); x.upToDate && (n > 0) != x.getManifest {
+			t.Errorf("%s: got %d manifests", x.name, n)
+		}
+	}
+}
+
+func TestGithubPackageStorageImmutableTags(t *testing.T) {
+	srv := registrytest.New(t, registry.WithAuth("akkuman", "secret"))
+	reg := regctl.NewRegistry(srv.Host, "akkuman", "secret", regctl.WithPlainHTTP())
+	_, blob := registrytest.Package(t)
+	ctx := context.Background()
+	release := regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+	upload := func(tag string, description string, opts ...UploadOption) error {
+		ociInstance := oci.NewOCI()
+		defer ociInstance.Close()
+		opts = append(opts, WithImmutableTags(release), WithAnnotations(map[string]string{oci.AnnotationDescription: description}))
+		return NewGithubPackageStorage(ociInstance, reg).Upload(ctx, "akkuman/wgettest:"+tag, util.DefaultPlatform, "", bytes.NewReader(blob), opts...)
+	}
+	for _, tag := range []string{"1.0.0", "nightly"} {
+		err := upload(tag, "first")
+		if err != nil {
+			t.Fatal("upload to registry failed:", err)
+		}
+	}
+	first, err := reg.Digest(ctx, srv.Host+"/akkuman/wgettest:1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tag         string
+		description string
+		overwrite   bool
+		want        error
+		// replaces is the expected replaces annotation of the tag after the upload,
+		// "before" stands for the digest of the tag before the upload
+		replaces string
+	}{
+		{"1.0.0", "first", false, ErrUpToDate, ""},
+		{"1.0.0", "second", false, ErrImmutableTag, ""},
+		{"1.0.0", "second", true, nil, first},
+		// the same content as the forced upload
+		{"1.0.0", "second", false, ErrUpToDate, first},
+		{"nightly", "second", false, nil, "before"},
+	}
+	for _, x := range tests {
+		before, err := reg.Digest(ctx, srv.Host+"/akkuman/wgettest:"+x.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var opts []UploadOption
+		if x.overwrite {
+			opts = append(opts, WithOverwrite())
+		}
+		err = upload(x.tag, x.description, opts...)
+		if !errors.Is(err, x.want) || (x.want == nil && err != nil) {
+			t.Fatalf("%s %s: got %v, want %v", x.tag, x.description, err, x.want)
+		}
+		digest, annotations, err := reg.Annotations(ctx, srv.Host+"/akkuman/wgettest:"+x.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (digest == before) != (x.want != nil) {
+			t.Errorf("%s %s: the tag points to %s, it pointed to %s", x.tag, x.description, digest, before)
+		}
+		replaces := x.replaces
+		if replaces == "before" {
+			replaces = before
+		}
+		if annotations[oci.AnnotationReplaces] != replaces {
+			t.Errorf("%s %s: replaces %q, want %q", x.tag, x.description, annotations[oci.AnnotationReplaces], replaces)
+		}
+	}
+}
+
+func TestGithubPackageStorageLayoutBlobs(t *testing.T) {
+	srv := registrytest.New(t, registry.WithAuth("akkuman", "secret"))
+	reg := regctl.NewRegistry(srv.Host, "akkuman", "secret", regctl.WithPlainHTTP())
+	registrytest.PushPackage(t, srv, "akkuman", "secret", "akkuman/wgettest", "1.0")
+	_, blob := registrytest.Package(t)
+	rootDir := filepath.Join(t.TempDir(), "layout")
+	ociInstance, err := oci.NewOCIWithRootDir(rootDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the content changed, the comparison build must not be left in the layout
+	err = NewGithubPackageStorage(ociInstance, reg).Upload(context.Background(), "akkuman/wgettest:1.0", util.DefaultPlatform, "", bytes.NewReader(blob),
+		WithAnnotations(map[string]string{oci.AnnotationDescription: "changed"}))
+	if err != nil {
+		t.Fatal("upload to registry failed:", err)
+	}
+	documents, err := ociInstance.Documents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var referenced []string
+	for _, d := range documents {
+		referenced = append(referenced, strings.TrimPrefix(d.Descriptor.Digest, "sha256:"))
+	}
+	entries, err := os.ReadDir(filepath.Join(rootDir, "blobs", "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blobs []string
+	for _, e := range entries {
+		blobs = append(blobs, e.Name())
+	}
+	slices.Sort(referenced)
+	referenced = slices.Compact(referenced)
+	if !slices.Equal(blobs, referenced) {
+		t.Errorf("the layout holds the blobs %v, the pushed index references %v", blobs, referenced)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// LayoutScheme is the prefix of the refs stored in local OCI layouts
+const LayoutScheme = "ocidir://"
+
+var (
+	layoutNameRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+	layoutTagRegexp  = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+)
+
+// IsLayoutRef reports whether imageRef is stored in a local OCI layout
+func IsLayoutRef(imageRef string) bool {
+	return strings.HasPrefix(imageRef, LayoutScheme)
+}
+
+// ParseLayoutRef parses ocidir://<root>:<name>[:<tag>], e.g. ocidir:///srv/packages:wget:1.2.
+// Every package is a separate OCI layout in <root>/<name>, the returned ref has
+// Path set to that directory, Repository set to name and Tag default to latest.
+func ParseLayoutRef(imageRef string) (ref.Ref, error) {
+	parts := strings.Split(strings.TrimPrefix(imageRef, LayoutScheme), ":")
+	if !IsLayoutRef(imageRef) || len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return ref.Ref{}, fmt.Errorf("invalid layout ref %s, expected %s<root>:<name>[:<tag>]", imageRef, LayoutScheme)
+	}
+	r := ref.Ref{
+		Scheme:     "ocidir",
+		Reference:  imageRef,
+		Path:       filepath.Join(parts[0], parts[1]),
+		Repository: parts[1],
+		Tag:        "latest",
+	}
+	if len(parts) == 3 {
+		r.Tag = parts[2]
+	}
+	if !layoutNameRegexp.MatchString(r.Repository) {
+		return ref.Ref{}, fmt.Errorf("invalid package name %q in %s", r.Repository, imageRef)
+	}
+	if !layoutTagRegexp.MatchString(r.Tag) {
+		return ref.Ref{}, fmt.Errorf("invalid tag %q in %s", r.Tag, imageRef)
+	}
+	return r, nil
+}
+
+// OCILayoutStorage stores packages in local OCI layout directories
+type OCILayoutStorage struct {
+	ociInstance *oci.OCI
+}
+
+var _ Storage = &OCILayoutStorage{}
+
+func NewOCILayoutStorage(ociInstance *oci.OCI) *OCILayoutStorage {
+	return &OCILayoutStorage{
+		ociInstance: ociInstance,
+	}
+}
+
+func (s *OCILayoutStorage) Upload(ctx context.Context, imageRef string, platform util.Platform, imageSource string, reader io.Reader, opts ...UploadOption) error {
+	opt := &uploadOptions{}
+	for _, o := range opts {
+		o(opt)
+	}
+	r, err := ParseLayoutRef(imageRef)
+	if err != nil {
+		return err
+	}
+	var blobFilePath string
+	if reader != nil {
+		blobFilePath, err = util.WriteToTempFile(reader, "blob.*.tar.gz")
+		if err != nil {
+			return fmt.Errorf("write blob to file failed: %w", err)
+		}
+		defer os.Remove(blobFilePath)
+	}
+	buildOpts, err := opt.buildOptions(r)
+	if err != nil {
+		return err
+	}
+	err = s.ociInstance.BuildOCI(ctx, platform, blobFilePath, r.Tag, imageSource, buildOpts...)
+	if err != nil {
+		return fmt.Errorf("build oci failed: %w", err)
+	}
+	if opt.dryRun {
+		return nil
+	}
+	err = oci.OpenLayout(r.Path).Put(ctx, oci.OpenLayout(s.ociInstance.GetRootDir()), r.Tag)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", imageRef, err)
+	}
+	return nil
+}
+
+func (s *OCILayoutStorage) Download(ctx context.Context, imageRef string, platform util.Platform, writer io.Writer, opts ...DownloadOption) error {
+	opt := &downloadOptions{}
+	for _, o := range opts {
+		o(opt)
+	}
+	layout, mf, err := s.resolve(imageRef, platform)
+	if err != nil {
+		return err
+	}
+	if opt.metadata != nil {
+		md, err := ParseMetadata(mf.Annotations)
+		if err != nil {
+			return err
+		}
+		*opt.metadata = *md
+	}
+	fileDigest := mf.Annotations[oci.AnnotationBinDigest]
+	if opt.fileName == "" && fileDigest == "" {
+		return fmt.Errorf("%s: %w", imageRef, ErrNoArchive)
+	}
+	if opt.fileName != "" {
+		manifest, err := layout.Manifest(mf)
+		if err != nil {
+			return err
+		}
+		var titles []string
+		fileDigest = ""
+		for _, layer := range manifest.Layers {
+			title := layer.Annotations[oci.AnnotationTitle]
+			if title == opt.fileName {
+				fileDigest = layer.Digest
+				break
+			}
+			if title != "" {
+				titles = append(titles, title)
+			}
+		}
+		if fileDigest == "" {
+			return fmt.Errorf("%s: file %s not found, available files: %s", imageRef, opt.fileName, strings.Join(titles, ", "))
+		}
+	}
+	f, err := layout.OpenBlob(fileDigest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(writer, f)
+	return err
+}
+
+func (s *OCILayoutStorage) GetMetadata(ctx context.Context, imageRef string, platform util.Platform) (*Metadata, error) {
+	_, mf, err := s.resolve(imageRef, platform)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMetadata(mf.Annotations)
+}
+
+// resolve resolves the tag of imageRef and returns the index entry of platform,
+// latest is the last tag put into the layout when no such tag exists
+func (s *OCILayoutStorage) resolve(imageRef string, platform util.Platform) (*oci.Layout, oci.Descriptor, error) {
+	r, err := ParseLayoutRef(imageRef)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	layout := oci.OpenLayout(r.Path)
+	tags, err := layout.Tags()
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	if len(tags) == 0 {
+		return nil, oci.Descriptor{}, fmt.Errorf("no package found in %s", r.Path)
+	}
+	if r.Tag == "latest" && !slices.Contains(tags, "latest") {
+		r.Tag = tags[len(tags)-1]
+	}
+	d, err := layout.Resolve(r.Tag)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	index, err := layout.Index(d)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	for _, mf := range index.Manifests {
+		if mf.Platform != nil && mf.Platform.Architecture == platform.Arch && mf.Platform.OS == platform.OS {
+			return layout, mf, nil
+		}
+	}
+	return nil, oci.Descriptor{}, fmt.Errorf("%w: %s in %s", ErrPlatformNotFound, platform.String(), imageRef)
+}
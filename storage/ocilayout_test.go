@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/registry/registrytest"
+	"github.com/akkuman/blob-uploader/pkg/util"
+	_ "github.com/akkuman/blob-uploader/testinit"
+)
+
+func TestParseLayoutRef(t *testing.T) {
+	for _, x := range []struct {
+		imageRef string
+		path     string
+		name     string
+		tag      string
+		wantErr  bool
+	}{
+		{"ocidir:///srv/packages:wget:1.2", "/srv/packages/wget", "wget", "1.2", false},
+		{"ocidir:///srv/packages:akkuman/wget", "/srv/packages/akkuman/wget", "akkuman/wget", "latest", false},
+		{"ocidir://packages:wget:1.2", "packages/wget", "wget", "1.2", false},
+		{"ocidir:///srv/packages", "", "", "", true},
+		{"ocidir:///srv/packages:Wget:1.2", "", "", "", true},
+		{"ocidir:///srv/packages:wget:-1", "", "", "", true},
+		{"ghcr.io/akkuman/wget:1.2", "", "", "", true},
+	} {
+		t.Run(x.imageRef, func(t *testing.T) {
+			r, err := ParseLayoutRef(x.imageRef)
+			if (err != nil) != x.wantErr {
+				t.Fatalf("error %v, want error %v", err, x.wantErr)
+			}
+			if err == nil && (r.Path != x.path || r.Repository != x.name || r.Tag != x.tag) {
+				t.Errorf("got %s %s %s, want %s %s %s", r.Path, r.Repository, r.Tag, x.path, x.name, x.tag)
+			}
+		})
+	}
+}
+
+func TestOCILayoutStorage(t *testing.T) {
+	_, blob := registrytest.Package(t)
+	root := t.TempDir()
+	ctx := context.Background()
+	arm64 := util.Platform{OS: "linux", Arch: "arm64"}
+	upload := func(tag string, platform util.Platform, opts ...UploadOption) {
+		t.Helper()
+		ociInstance := oci.NewOCI()
+		defer ociInstance.Close()
+		s := NewOCILayoutStorage(ociInstance)
+		imageRef := fmt.Sprintf("ocidir://%s:wget:%s", root, tag)
+		err := s.Upload(ctx, imageRef, platform, "https://github.com/akkuman/blob-uploader", bytes.NewReader(blob), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload("1.0", util.DefaultPlatform)
+	upload("1.1", util.DefaultPlatform, WithMetadata(&Metadata{Description: "Internet file retriever"}))
+	upload("1.1", arm64, WithFiles("./_testdata/wget"))
+
+	s := NewOCILayoutStorage(nil)
+	for _, x := range []struct {
+		tag      string
+		platform util.Platform
+		opts     []DownloadOption
+		wantErr  bool
+	}{
+		{"1.0", util.DefaultPlatform, nil, false},
+		{"1.1", util.DefaultPlatform, nil, false},
+		{"1.1", arm64, nil, false},
+		{"latest", arm64, nil, false},
+		{"1.0", arm64, nil, true},
+		{"2.0", util.DefaultPlatform, nil, true},
+		{"1.1", arm64, []DownloadOption{WithFileName("wget")}, false},
+		{"1.1", arm64, []DownloadOption{WithFileName("missing")}, true},
+	} {
+		t.Run(fmt.Sprintf("%s %s", x.tag, x.platform.String()), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := s.Download(ctx, fmt.Sprintf("ocidir://%s:wget:%s", root, x.tag), x.platform, &buf, x.opts...)
+			if (err != nil) != x.wantErr {
+				t.Fatalf("error %v, want error %v", err, x.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := blob
+			if len(x.opts) > 0 {
+				want, _ = os.ReadFile("./_testdata/wget")
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Error("downloaded content differs from the uploaded one")
+			}
+		})
+	}
+
+	// a package of files only has no tar.gz to download without a file name
+	ociInstance := oci.NewOCI()
+	defer ociInstance.Close()
+	filesRef := fmt.Sprintf("ocidir://%s:files:1.0", root)
+	err := NewOCILayoutStorage(ociInstance).Upload(ctx, filesRef, util.DefaultPlatform, "", nil, WithFiles("./_testdata/wget"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Download(ctx, filesRef, util.DefaultPlatform, io.Discard)
+	if !errors.Is(err, ErrNoArchive) {
+		t.Errorf("download of a package of files only: got %v, want %v", err, ErrNoArchive)
+	}
+
+	md, err := s.GetMetadata(ctx, fmt.Sprintf("ocidir://%s:wget:1.1", root), util.DefaultPlatform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Name != "wget" || md.Version != "1.1" || md.Description != "Internet file retriever" {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+	tags, err := oci.OpenLayout(filepath.Join(root, "wget")).Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tags) != "[1.0 1.1]" {
+		t.Errorf("tags %v != [1.0 1.1]", tags)
+	}
+}
@@ -2,17 +2,256 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"os"
+	"path"
+	"regexp"
 
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/akkuman/blob-uploader/pkg/regctl"
 	"github.com/akkuman/blob-uploader/pkg/util"
+	"github.com/regclient/regclient/types/ref"
 )
 
+// AnnotationMetadata holds the JSON encoded Metadata of a package
+const AnnotationMetadata = "dev.pkgforge.package.metadata"
+
+// Metadata is the catalog record of a package
 type Metadata struct {
-	Arch string
-	OS string
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Description  string   `json:"description,omitempty"`
+	Homepage     string   `json:"homepage,omitempty"`
+	License      string   `json:"license,omitempty"`
+	Maintainers  []string `json:"maintainers,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	Binaries     []string `json:"binaries,omitempty"`
+}
+
+// LoadMetadata reads Metadata from a JSON file
+func LoadMetadata(filePath string) (*Metadata, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{}
+	err = json.Unmarshal(data, md)
+	if err != nil {
+		return nil, fmt.Errorf("parse metadata failed: %w", err)
+	}
+	return md, nil
 }
 
+// Annotations serializes the metadata into annotations, the whole record is stored
+// as JSON in AnnotationMetadata and the fields having a standard OCI key are copied to it
+func (md *Metadata) Annotations() (map[string]string, error) {
+	data, err := json.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	annotations := map[string]string{
+		AnnotationMetadata: string(data),
+	}
+	for k, v := range map[string]string{
+		oci.AnnotationTitle:       md.Name,
+		oci.AnnotationVersion:     md.Version,
+		oci.AnnotationDescription: md.Description,
+		oci.AnnotationURL:         md.Homepage,
+		oci.AnnotationLicenses:    md.License,
+	} {
+		if v != "" {
+			annotations[k] = v
+		}
+	}
+	return annotations, nil
+}
+
+// ParseMetadata parses the metadata back from annotations, when AnnotationMetadata is missing
+// the metadata is built from the standard OCI annotations
+func ParseMetadata(annotations map[string]string) (*Metadata, error) {
+	md := &Metadata{}
+	if data, ok := annotations[AnnotationMetadata]; ok {
+		err := json.Unmarshal([]byte(data), md)
+		if err != nil {
+			return nil, fmt.Errorf("parse metadata failed: %w", err)
+		}
+		return md, nil
+	}
+	md.Name = annotations[oci.AnnotationTitle]
+	md.Version = annotations[oci.AnnotationVersion]
+	md.Description = annotations[oci.AnnotationDescription]
+	md.Homepage = annotations[oci.AnnotationURL]
+	md.License = annotations[oci.AnnotationLicenses]
+	return md, nil
+}
+
+// ErrPlatformNotFound is returned when the package has no build for the requested platform
+var ErrPlatformNotFound = errors.New("platform not found")
+
+// ErrUpToDate is returned by Upload when the registry has the package already, nothing is pushed
+var ErrUpToDate = errors.New("up to date")
+
+// ErrNoArchive is returned by Download when no file name is given and the package has no tar.gz layer,
+// only files added with WithFiles
+var ErrNoArchive = errors.New("the package has no tar.gz layer")
+
+// ErrImmutableTag is returned by Upload when the tag is immutable and points to another digest already
+var ErrImmutableTag = regctl.ErrImmutableTag
+
 type Storage interface {
-	Upload(ctx context.Context, imageRef string, platform util.Platform, imageSource string, reader io.Reader) error
-	Download(ctx context.Context, imageRef string, platform util.Platform, writer io.Writer) error
+	// Upload builds the package in the *oci.OCI the storage was created with and pushes it to imageRef.
+	// The storage doesn't own the *oci.OCI, the caller must Close it to remove its temporary layout.
+	Upload(ctx context.Context, imageRef string, platform util.Platform, imageSource string, reader io.Reader, opts ...UploadOption) error
+	Download(ctx context.Context, imageRef string, platform util.Platform, writer io.Writer, opts ...DownloadOption) error
+	GetMetadata(ctx context.Context, imageRef string, platform util.Platform) (*Metadata, error)
+}
+
+type uploadOptions struct {
+	annotations   map[string]string
+	metadata      *Metadata
+	artifactType  string
+	files         []string
+	dryRun        bool
+	immutableTags []*regexp.Regexp
+	overwrite     bool
+}
+
+type UploadOption func(*uploadOptions)
+
+// WithAnnotations sets extra annotations of the uploaded package
+func WithAnnotations(annotations map[string]string) UploadOption {
+	return func(o *uploadOptions) {
+		o.annotations = annotations
+	}
+}
+
+// WithMetadata stores the package metadata in the annotations, it takes precedence over WithAnnotations
+func WithMetadata(md *Metadata) UploadOption {
+	return func(o *uploadOptions) {
+		o.metadata = md
+	}
+}
+
+// WithArtifactType uploads the package as an OCI 1.1 artifact manifest with the given artifactType
+func WithArtifactType(artifactType string) UploadOption {
+	return func(o *uploadOptions) {
+		o.artifactType = artifactType
+	}
+}
+
+// WithFiles uploads every file as a separate layer named after the file
+func WithFiles(filePaths ...string) UploadOption {
+	return func(o *uploadOptions) {
+		o.files = append(o.files, filePaths...)
+	}
+}
+
+// WithDryRun builds the OCI layout without pushing it to the registry
+func WithDryRun() UploadOption {
+	return func(o *uploadOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithImmutableTags refuses to overwrite the tags matching any of patterns once they point to a digest
+func WithImmutableTags(patterns ...*regexp.Regexp) UploadOption {
+	return func(o *uploadOptions) {
+		o.immutableTags = append(o.immutableTags, patterns...)
+	}
+}
+
+// WithOverwrite overwrites the immutable tags anyway
+func WithOverwrite() UploadOption {
+	return func(o *uploadOptions) {
+		o.overwrite = true
+	}
+}
+
+// immutable reports whether tag matches one of the immutable tag patterns
+func (o *uploadOptions) immutable(tag string) bool {
+	for _, re := range o.immutableTags {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildOptions converts the upload options to the options of oci.BuildOCI
+func (o *uploadOptions) buildOptions(r ref.Ref) ([]oci.BuildOption, error) {
+	annotations, err := o.buildAnnotations(r)
+	if err != nil {
+		return nil, err
+	}
+	opts := []oci.BuildOption{oci.WithAnnotations(annotations)}
+	if o.artifactType != "" {
+		opts = append(opts, oci.WithArtifactType(o.artifactType))
+	}
+	if len(o.files) > 0 {
+		opts = append(opts, oci.WithFiles(o.files...))
+	}
+	return opts, nil
+}
+
+// buildAnnotations merges the annotations and the metadata of the package r
+func (o *uploadOptions) buildAnnotations(r ref.Ref) (map[string]string, error) {
+	annotations := maps.Clone(o.annotations)
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if o.metadata == nil {
+		return annotations, nil
+	}
+	md := *o.metadata
+	if md.Name == "" {
+		md.Name = path.Base(r.Repository)
+	}
+	if md.Version == "" && r.Tag != "latest" {
+		md.Version = r.Tag
+	}
+	mdAnnotations, err := md.Annotations()
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(annotations, mdAnnotations)
+	return annotations, nil
+}
+
+type downloadOptions struct {
+	fileName  string
+	verifiers []Verifier
+	metadata  *Metadata
+}
+
+// Verifier checks the manifest digest of the resolved ref before anything is downloaded,
+// e.g. that it is signed by a trusted key
+type Verifier func(ctx context.Context, refName string, digest string) error
+
+type DownloadOption func(*downloadOptions)
+
+// WithFileName downloads only the layer whose org.opencontainers.image.title is fileName
+func WithFileName(fileName string) DownloadOption {
+	return func(o *downloadOptions) {
+		o.fileName = fileName
+	}
+}
+
+// WithVerifier refuses to download the package unless verifier accepts its manifest digest,
+// it can be given several times and every verifier must accept it
+func WithVerifier(verifier Verifier) DownloadOption {
+	return func(o *downloadOptions) {
+		o.verifiers = append(o.verifiers, verifier)
+	}
+}
+
+// WithMetadataOut stores in md the package metadata of the platform entry the download is resolved to,
+// unlike GetMetadata it can't be from another version pushed to the tag meanwhile
+func WithMetadataOut(md *Metadata) DownloadOption {
+	return func(o *downloadOptions) {
+		o.metadata = md
+	}
 }
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/akkuman/blob-uploader/oci"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestMetadataAnnotations(t *testing.T) {
+	md := &Metadata{
+		Name:         "wget",
+		Version:      "1.21.4",
+		Description:  "Internet file retriever",
+		Homepage:     "https://www.gnu.org/software/wget/",
+		License:      "GPL-3.0-or-later",
+		Maintainers:  []string{"akkuman"},
+		Dependencies: []string{"openssl"},
+		Binaries:     []string{"wget"},
+	}
+	annotations, err := md.Annotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if annotations[oci.AnnotationLicenses] != md.License {
+		t.Errorf("%s != %s", annotations[oci.AnnotationLicenses], md.License)
+	}
+	parsed, err := ParseMetadata(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(md, parsed) {
+		t.Errorf("%+v != %+v", parsed, md)
+	}
+	delete(annotations, AnnotationMetadata)
+	parsed, err = ParseMetadata(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Name != md.Name || parsed.Homepage != md.Homepage || parsed.Binaries != nil {
+		t.Errorf("unexpected metadata from standard annotations: %+v", parsed)
+	}
+}
+
+func TestBuildAnnotationsWithMetadata(t *testing.T) {
+	r, err := ref.New("ghcr.io/akkuman/wget:1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &uploadOptions{}
+	WithAnnotations(map[string]string{"a": "b", oci.AnnotationTitle: "hello"})(opt)
+	WithMetadata(&Metadata{Description: "desc"})(opt)
+	annotations, err := opt.buildAnnotations(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"a":                       "b",
+		oci.AnnotationTitle:       "wget",
+		oci.AnnotationVersion:     "1.2.0",
+		oci.AnnotationDescription: "desc",
+	} {
+		if annotations[k] != v {
+			t.Errorf("%s: %s != %s", k, annotations[k], v)
+		}
+	}
+}